@@ -1,24 +1,137 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"faas-api/internal/config"
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/logging"
+	"faas-api/internal/service"
+	"faas-api/internal/tracing"
 	"faas-api/platform/authenticator"
 	"faas-api/platform/router"
+	"flag"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
 
-	auth, err := authenticator.New()
+	cfg, opts, err := config.LoadFromOS()
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load the configuration: %v", err)
+	}
+
+	if opts.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("Failed to print the configuration: %v", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := logging.Setup(cfg.Logging, cfg.Secrets()...); err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.MigrateNamespaces != "" {
+		if err := migrateNamespaces(cfg, opts.MigrateNamespaces); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	auth, err := authenticator.New(cfg.Auth)
 	if err != nil {
 		log.Fatalf("Failed to initialize the authenticator: %v", err)
 	}
+	logging.AddSecrets(auth.Secrets()...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
 
-	rtr := router.New(auth)
+	if cfg.DrainFile != "" {
+		if err := os.WriteFile(cfg.DrainFile, nil, 0o644); err != nil {
+			log.Fatalf("Failed to create the drain file: %v", err)
+		}
+	}
 
-	log.Print("Server listening on http://localhost:8090/")
-	if err := http.ListenAndServe("0.0.0.0:8090", rtr); err != nil {
+	server := &http.Server{
+		Addr:    cfg.ListenAddress,
+		Handler: router.New(ctx, cfg, auth),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.WithField("address", cfg.ListenAddress).Info("server listening")
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
 		log.Fatalf("There was an error with the http server: %v", err)
+	case <-ctx.Done():
+	}
+
+	// Readiness fails from now on. Keep serving until the Service has stopped
+	// sending requests here, or they would be refused.
+	log.WithField("delay", cfg.ShutdownDelay.String()).Info("shutting down, waiting to be taken out of the service")
+	time.Sleep(cfg.ShutdownDelay.Std())
+
+	// Stop accepting requests and let in-flight builds and deploys finish.
+	log.WithField("timeout", cfg.ShutdownTimeout.String()).Info("waiting for in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Std())
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Warn("shutdown timed out, closing remaining connections")
+		server.Close()
+	}
+	// No build is running any more: let the Docker daemon stop.
+	if cfg.DrainFile != "" {
+		if err := os.Remove(cfg.DrainFile); err != nil {
+			log.WithError(err).Warn("failed to remove the drain file")
+		}
+	}
+
+	// Export the spans of the last requests.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.WithError(err).Warn("failed to flush traces")
+	}
+	log.Info("server stopped")
+}
+
+// migrateNamespaces assigns the legacy namespaces listed in the file at path to
+// their owners.
+func migrateNamespaces(cfg *config.Config, path string) error {
+	migrations, err := namespace.LoadMigrations(path)
+	if err != nil {
+		return err
+	}
+	client, _, err := service.Connect(cfg.Kubernetes)
+	if err != nil {
+		return fmt.Errorf("failed to connect to kubernetes: %w", err)
 	}
+	return namespace.Migrate(context.Background(), client, migrations)
 }
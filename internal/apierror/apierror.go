@@ -0,0 +1,186 @@
+// Package apierror gives platform errors stable codes and HTTP statuses and writes
+// them as RFC 7807 problems. Errors of the Kubernetes API and the Docker daemon are
+// classified by their type, so that handlers do not match on messages.
+package apierror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"faas-api/internal/logging"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// Error is an error with a code from pkg/api/v1.
+type Error struct {
+	Code string
+	// Detail is the message shown to clients for client errors. It includes the
+	// messages of the causes, so server errors only log it.
+	Detail string
+	// Fields are the invalid fields of a validation_failed error.
+	Fields []apiv1.FieldError
+	// Err is the cause, if any.
+	Err error
+
+	// public is the part of Detail written by the platform itself, which is all
+	// clients see of server errors.
+	public string
+}
+
+// New returns an error with code and a detail formatted as with fmt.Sprintf.
+func New(code, format string, args ...interface{}) *Error {
+	detail := fmt.Sprintf(format, args...)
+	return &Error{Code: code, Detail: detail, public: detail}
+}
+
+// Invalid returns a validation_failed error for the given fields.
+func Invalid(fields ...apiv1.FieldError) *Error {
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = f.Message
+	}
+	detail := strings.Join(msgs, "; ")
+	return &Error{Code: apiv1.CodeValidationFailed, Detail: detail, Fields: fields, public: detail}
+}
+
+// Field returns a validation_failed error for one field.
+func Field(field, format string, args ...interface{}) *Error {
+	return Invalid(apiv1.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Wrap returns err with the code it is classified with, or fallback if it is not
+// classified. msg, if not empty, prefixes the detail; it is all clients see of the
+// message of err if the result is a server error.
+func Wrap(err error, fallback, msg string) *Error {
+	e := From(err)
+	if e.Code == apiv1.CodeInternal {
+		e.Code = fallback
+	}
+	if msg != "" {
+		e.Detail = msg + ": " + e.Detail
+		if e.public != "" {
+			msg += ": " + e.public
+		}
+		e.public = msg
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil && e.Detail == "" {
+		return e.Err.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Status returns the HTTP status of e.
+func (e *Error) Status() int { return apiv1.CodeStatus(e.Code) }
+
+// From returns err as an *Error. Errors wrapping an *Error keep its code and fields
+// with their own message; other errors are classified by type, as internal if they
+// are not recognized.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return &Error{Code: e.Code, Detail: err.Error(), Fields: e.Fields, Err: err, public: e.public}
+	}
+	out := &Error{Code: classify(err), Detail: err.Error(), Err: err}
+	if out.Code == apiv1.CodeValidationFailed {
+		out.Fields = causes(err)
+	}
+	return out
+}
+
+func classify(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return apiv1.CodeTimeout
+
+	case apierrors.IsNotFound(err):
+		return apiv1.CodeNotFound
+	case apierrors.IsAlreadyExists(err):
+		return apiv1.CodeAlreadyExists
+	case apierrors.IsConflict(err):
+		return apiv1.CodeConflict
+	case apierrors.IsResourceExpired(err), apierrors.IsGone(err):
+		return apiv1.CodeExpired
+	case apierrors.IsInvalid(err):
+		return apiv1.CodeValidationFailed
+	case apierrors.IsBadRequest(err):
+		return apiv1.CodeInvalidRequest
+	case apierrors.IsForbidden(err) && isQuotaError(err):
+		return apiv1.CodeQuotaExceeded
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), apierrors.IsServiceUnavailable(err),
+		apierrors.IsTooManyRequests(err), utilnet.IsConnectionRefused(err):
+		return apiv1.CodeClusterUnavailable
+
+	case client.IsErrConnectionFailed(err), errdefs.IsUnavailable(err):
+		return apiv1.CodeBuilderUnavailable
+	case errdefs.IsInvalidParameter(err):
+		return apiv1.CodeInvalidRequest
+	}
+	return apiv1.CodeInternal
+}
+
+// isQuotaError tells whether a Forbidden error comes from the ResourceQuota
+// admission of a tenant namespace rather than from RBAC. The API reports both with
+// the Forbidden reason; only the message tells them apart.
+func isQuotaError(err error) bool {
+	var status apierrors.APIStatus
+	return errors.As(err, &status) && strings.Contains(status.Status().Message, "exceeded quota")
+}
+
+// causes returns the invalid fields of a Kubernetes Invalid error.
+func causes(err error) []apiv1.FieldError {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return nil
+	}
+	var fields []apiv1.FieldError
+	for _, c := range status.Status().Details.Causes {
+		fields = append(fields, apiv1.FieldError{Field: c.Field, Message: c.Message})
+	}
+	return fields
+}
+
+// Problem returns the problem describing err for the request of c. The detail of
+// server errors is limited to the messages written by the platform, or the title of
+// their code, as the messages of their causes may describe the cluster or the
+// builder.
+func Problem(c *gin.Context, err error) *apiv1.ProblemDetails {
+	e := From(err)
+	detail := e.Detail
+	if e.Status() >= http.StatusInternalServerError {
+		detail = e.public
+	}
+	p := apiv1.NewProblem(e.Code, detail)
+	if p.Detail == "" {
+		p.Detail, p.Error = p.Title, p.Title
+	}
+	p.Errors = e.Fields
+	p.Instance = c.Request.URL.Path
+	p.RequestID = logging.RequestID(c)
+	return p
+}
+
+// Abort stops the request of c with the problem describing err. The causes of
+// server errors are logged with the id of the request, which their problem carries.
+func Abort(c *gin.Context, err error) {
+	p := Problem(c, err)
+	if p.Status >= http.StatusInternalServerError {
+		logging.From(c).WithError(err).WithField("code", p.Code).Error("request failed")
+	}
+	c.Header("Content-Type", apiv1.ProblemContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
@@ -0,0 +1,150 @@
+package apierror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"faas-api/internal/logging"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var services = schema.GroupResource{Group: "serving.knative.dev", Resource: "services"}
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{apierrors.NewNotFound(services, "hello"), apiv1.CodeNotFound},
+		{fmt.Errorf("failed to deploy: %w", apierrors.NewAlreadyExists(services, "hello")), apiv1.CodeAlreadyExists},
+		{apierrors.NewConflict(services, "hello", errors.New("modified")), apiv1.CodeConflict},
+		{apierrors.NewBadRequest("bad"), apiv1.CodeInvalidRequest},
+		{apierrors.NewResourceExpired("too old"), apiv1.CodeExpired},
+		{apierrors.NewForbidden(services, "hello", errors.New(`exceeded quota: tenant-quota, requested: count/services.serving.knative.dev=1`)), apiv1.CodeQuotaExceeded},
+		{apierrors.NewForbidden(services, "hello", errors.New("RBAC: access denied")), apiv1.CodeInternal},
+		{apierrors.NewServiceUnavailable("etcd"), apiv1.CodeClusterUnavailable},
+		{apierrors.NewTooManyRequests("slow down", 1), apiv1.CodeClusterUnavailable},
+		{client.ErrorConnectionFailed("unix:///var/run/docker.sock"), apiv1.CodeBuilderUnavailable},
+		{errdefs.Unavailable(errors.New("daemon shutting down")), apiv1.CodeBuilderUnavailable},
+		{fmt.Errorf("waiting: %w", context.DeadlineExceeded), apiv1.CodeTimeout},
+		{fmt.Errorf("%w: denied", New(apiv1.CodePushFailed, "failed to push")), apiv1.CodePushFailed},
+		{errors.New("boom"), apiv1.CodeInternal},
+	}
+
+	for _, tt := range tests {
+		e := From(tt.err)
+		require.Equal(t, tt.code, e.Code, "%v", tt.err)
+		require.Equal(t, tt.err.Error(), e.Detail)
+		require.ErrorIs(t, e, tt.err)
+	}
+}
+
+func TestFromInvalid(t *testing.T) {
+	err := apierrors.NewInvalid(schema.GroupKind{Group: "serving.knative.dev", Kind: "Service"}, "hello", field.ErrorList{
+		field.Invalid(field.NewPath("metadata", "name"), "Hello", "must be lowercase"),
+	})
+
+	e := From(err)
+	require.Equal(t, apiv1.CodeValidationFailed, e.Code)
+	require.Len(t, e.Fields, 1)
+	require.Equal(t, "metadata.name", e.Fields[0].Field)
+	require.Contains(t, e.Fields[0].Message, "must be lowercase")
+
+	wrapped := From(fmt.Errorf("invalid function request: %w", Field("runtime", "runtime is required")))
+	require.Equal(t, apiv1.CodeValidationFailed, wrapped.Code)
+	require.Equal(t, []apiv1.FieldError{{Field: "runtime", Message: "runtime is required"}}, wrapped.Fields)
+	require.Equal(t, "invalid function request: runtime is required", wrapped.Detail)
+}
+
+func TestWrap(t *testing.T) {
+	e := Wrap(errors.New("exit code 1"), apiv1.CodeBuildFailed, "failed to build")
+	require.Equal(t, apiv1.CodeBuildFailed, e.Code, "unclassified errors take the fallback")
+	require.Equal(t, "failed to build: exit code 1", e.Detail)
+
+	e = Wrap(client.ErrorConnectionFailed("tcp://docker:2375"), apiv1.CodeBuildFailed, "failed to build")
+	require.Equal(t, apiv1.CodeBuilderUnavailable, e.Code, "classified errors keep their code")
+	require.Equal(t, http.StatusServiceUnavailable, e.Status())
+}
+
+func TestAbort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.Middleware)
+	router.POST("/api/functions", func(c *gin.Context) {
+		switch c.Query("fail") {
+		case "build":
+			Abort(c, Wrap(errors.New("daemon exited"), apiv1.CodeBuildFailed, "failed to build"))
+		case "internal":
+			Abort(c, fmt.Errorf("failed to list: %w", errors.New("dial tcp 10.96.0.1:443: connection refused")))
+		default:
+			Abort(c, Invalid(
+				apiv1.FieldError{Field: "runtime", Message: "runtime is required"},
+				apiv1.FieldError{Field: "name", Message: "name is required"},
+			))
+		}
+	})
+	var logged bytes.Buffer
+	logger := log.StandardLogger()
+	out, formatter := logger.Out, logger.Formatter
+	t.Cleanup(func() {
+		logger.SetOutput(out)
+		logger.SetFormatter(formatter)
+	})
+	logger.SetOutput(&logged)
+	logger.SetFormatter(&log.JSONFormatter{})
+
+	r := httptest.NewRequest(http.MethodPost, "/api/functions", nil)
+	r.Header.Set(logging.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, apiv1.ProblemContentType, w.Header().Get("Content-Type"))
+	var p apiv1.ProblemDetails
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	require.Equal(t, "urn:faas.dev:problem:validation_failed", p.Type)
+	require.Equal(t, apiv1.CodeValidationFailed, p.Code)
+	require.Equal(t, http.StatusBadRequest, p.Status)
+	require.NotEmpty(t, p.Title)
+	require.Equal(t, "runtime is required; name is required", p.Detail)
+	require.Equal(t, p.Detail, p.Error)
+	require.Equal(t, "/api/functions", p.Instance)
+	require.Equal(t, "req-1", p.RequestID)
+	require.Len(t, p.Errors, 2)
+	require.NotContains(t, logged.String(), "runtime is required", "client errors are not logged")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/functions?fail=build", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	p = apiv1.ProblemDetails{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	require.Equal(t, apiv1.CodeBuildFailed, p.Code)
+	require.Equal(t, "failed to build", p.Detail, "only the message of the platform is shown")
+	require.Contains(t, logged.String(), `"error":"failed to build: daemon exited"`)
+	require.Contains(t, logged.String(), `"request_id":"`+p.RequestID+`"`, "the cause is logged with the request id")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/functions?fail=internal", nil))
+	p = apiv1.ProblemDetails{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	require.Equal(t, apiv1.CodeInternal, p.Code)
+	require.Equal(t, "Internal error", p.Detail, "unclassified errors get the title of their code")
+	require.Equal(t, p.Detail, p.Error)
+	require.NotContains(t, w.Body.String(), "10.96.0.1")
+	require.Contains(t, logged.String(), "10.96.0.1")
+}
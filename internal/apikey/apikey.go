@@ -0,0 +1,190 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"faas-api/internal/apierror"
+	"faas-api/internal/credential"
+	"faas-api/internal/k8/store"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
+)
+
+// Prefix identifies platform API keys, e.g. "faas_ak_<id>_<secret>".
+const Prefix = "faas_ak_"
+
+// lastUsedResolution limits how often the last-used timestamp is written back.
+const lastUsedResolution = time.Minute
+
+const recordKind = "api-key"
+
+var (
+	ErrInvalidKey = errors.New("invalid api key")
+	ErrRevoked    = errors.New("api key has been revoked")
+	ErrExpired    = errors.New("api key has expired")
+)
+
+// Key is the stored representation of an API key. The secret part of the key is
+// never stored, only its SHA-256 hash.
+type Key struct {
+	ID         string     `json:"id"`
+	Label      string     `json:"label"`
+	Namespace  string     `json:"namespace"`
+	Function   string     `json:"function,omitempty"` // empty means every function in Namespace
+	Hash       string     `json:"hash,omitempty"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreateRequest describes a new API key.
+type CreateRequest struct {
+	Label     string     `json:"label"`
+	Function  string     `json:"function"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Allows reports whether the key may invoke the named function.
+func (k *Key) Allows(function string) bool {
+	return k.Function == "" || k.Function == function
+}
+
+// Redacted returns a copy of the key that is safe to return to clients.
+func (k Key) Redacted() Key {
+	k.Hash = ""
+	return k
+}
+
+// Manager creates, lists, revokes and verifies API keys.
+type Manager struct {
+	store *store.Store[Key]
+	now   func() time.Time
+}
+
+func NewManager(client dynamic.Interface) *Manager {
+	return &Manager{
+		store: store.New[Key](client, recordKind),
+		now:   time.Now,
+	}
+}
+
+// Create issues a new key for namespace and returns it together with the plaintext
+// token, which is only available at creation time.
+func (m *Manager) Create(ctx context.Context, namespace, createdBy string, req CreateRequest) (*Key, string, error) {
+	if req.Label == "" {
+		return nil, "", apierror.Field("label", "label is required")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(m.now()) {
+		return nil, "", apierror.Field("expires_at", "expires_at must be in the future")
+	}
+
+	cred, err := credential.New(Prefix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &Key{
+		ID:        cred.ID,
+		Label:     req.Label,
+		Namespace: namespace,
+		Function:  req.Function,
+		Hash:      cred.Hash,
+		CreatedBy: createdBy,
+		CreatedAt: m.now().UTC(),
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	if err := m.store.Create(ctx, namespace, cred.ID, nil, key); err != nil {
+		return nil, "", err
+	}
+
+	return key, cred.Token, nil
+}
+
+// List returns the keys of a namespace without their hashes.
+func (m *Manager) List(ctx context.Context, namespace string) ([]Key, error) {
+	keys, err := m.store.List(ctx, namespace, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		keys[i] = keys[i].Redacted()
+	}
+	return keys, nil
+}
+
+// Revoke marks a key as revoked. Revoked keys are kept so they still show up in listings.
+func (m *Manager) Revoke(ctx context.Context, namespace, id string) (*Key, error) {
+	key, err := m.store.Update(ctx, namespace, id, func(key *Key) error {
+		if key.RevokedAt == nil {
+			now := m.now().UTC()
+			key.RevokedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	redacted := key.Redacted()
+	return &redacted, nil
+}
+
+// Authenticate verifies a presented token. Callers must still check Allows for the
+// function being accessed.
+func (m *Manager) Authenticate(ctx context.Context, token string) (*Key, error) {
+	id, secret, ok := credential.Parse(Prefix, token)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	key, _, err := m.store.Find(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+
+	if !credential.Verify(key.Hash, secret) {
+		return nil, ErrInvalidKey
+	}
+
+	now := m.now()
+	if key.RevokedAt != nil {
+		return nil, ErrRevoked
+	}
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		used, err := m.store.Update(ctx, key.Namespace, key.ID, func(k *Key) error {
+			if k.RevokedAt != nil {
+				return ErrRevoked
+			}
+			lastUsed := now.UTC()
+			k.LastUsedAt = &lastUsed
+			return nil
+		})
+		switch {
+		case errors.Is(err, ErrRevoked):
+			return nil, ErrRevoked
+		case err != nil:
+			log.WithError(err).WithField("key", key.ID).Warn("failed to record api key usage")
+		default:
+			key = used
+		}
+	}
+
+	return key, nil
+}
+
+// IsKey reports whether token looks like a platform API key.
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
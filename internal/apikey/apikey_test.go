@@ -0,0 +1,100 @@
+package apikey
+
+import (
+	"testing"
+	"time"
+
+	"faas-api/internal/k8/store"
+	"faas-api/internal/k8/store/storetest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManager() *Manager {
+	return NewManager(storetest.NewClient())
+}
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	m := newTestManager()
+
+	key, token, err := m.Create(t.Context(), "github-jane", "jane", CreateRequest{Label: "partner", Function: "hello"})
+	require.NoError(t, err)
+	require.True(t, IsKey(token))
+	require.NotContains(t, key.Hash, token, "only the hash of the secret is stored")
+
+	got, err := m.Authenticate(t.Context(), token)
+	require.NoError(t, err)
+	require.Equal(t, "github-jane", got.Namespace)
+	require.NotNil(t, got.LastUsedAt, "last used timestamp should be recorded")
+	require.True(t, got.Allows("hello"))
+	require.False(t, got.Allows("other"))
+
+	_, err = m.Authenticate(t.Context(), token+"x")
+	require.ErrorIs(t, err, ErrInvalidKey)
+
+	keys, err := m.List(t.Context(), "github-jane")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Empty(t, keys[0].Hash, "listed keys must not include the hash")
+}
+
+func TestNamespaceWideKey(t *testing.T) {
+	m := newTestManager()
+
+	_, token, err := m.Create(t.Context(), "github-jane", "jane", CreateRequest{Label: "all"})
+	require.NoError(t, err)
+
+	got, err := m.Authenticate(t.Context(), token)
+	require.NoError(t, err)
+	require.True(t, got.Allows("anything"))
+}
+
+func TestRevokedKeyIsRejected(t *testing.T) {
+	m := newTestManager()
+
+	key, token, err := m.Create(t.Context(), "github-jane", "jane", CreateRequest{Label: "partner"})
+	require.NoError(t, err)
+
+	revoked, err := m.Revoke(t.Context(), "github-jane", key.ID)
+	require.NoError(t, err)
+	require.NotNil(t, revoked.RevokedAt)
+
+	_, err = m.Authenticate(t.Context(), token)
+	require.ErrorIs(t, err, ErrRevoked)
+
+	_, err = m.Revoke(t.Context(), "github-jane", "missing")
+	require.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestRevokeBetweenLoadAndLastUsedUpdate(t *testing.T) {
+	client := storetest.NewClient()
+	admin := NewManager(client)
+	key, token, err := admin.Create(t.Context(), "github-jane", "jane", CreateRequest{Label: "partner"})
+	require.NoError(t, err)
+
+	// The key is revoked after Authenticate has loaded it, before it records its use.
+	m := NewManager(storetest.BeforeUpdate(client, func() {
+		_, err := admin.Revoke(t.Context(), "github-jane", key.ID)
+		require.NoError(t, err)
+	}))
+	_, err = m.Authenticate(t.Context(), token)
+	require.ErrorIs(t, err, ErrRevoked)
+
+	stored, err := admin.store.Get(t.Context(), "github-jane", key.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.RevokedAt, "recording the use must not undo the revocation")
+	_, err = admin.Authenticate(t.Context(), token)
+	require.ErrorIs(t, err, ErrRevoked)
+}
+
+func TestExpiredKeyIsRejected(t *testing.T) {
+	m := newTestManager()
+
+	expires := time.Now().Add(time.Hour)
+	_, token, err := m.Create(t.Context(), "github-jane", "jane", CreateRequest{Label: "partner", ExpiresAt: &expires})
+	require.NoError(t, err)
+
+	m.now = func() time.Time { return expires.Add(time.Second) }
+	_, err = m.Authenticate(t.Context(), token)
+	require.ErrorIs(t, err, ErrExpired)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"errors"
+	"faas-api/internal/apierror"
+	"faas-api/internal/apikey"
+	"faas-api/internal/audit"
+	"faas-api/internal/k8/store"
+	"faas-api/internal/org"
+	apiv1 "faas-api/pkg/api/v1"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKeyHandler issues an API key for the caller's functions. The plaintext
+// key is only returned in this response.
+func (p *Platform) CreateAPIKeyHandler(c *gin.Context) {
+	var req apikey.CreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInvalidRequest, "invalid api key request"))
+		return
+	}
+
+	ns, ok := p.callerNamespace(c, org.RoleDeveloper)
+	if !ok {
+		return
+	}
+
+	key, token, err := apikey.NewManager(p.Client).Create(c, ns, c.GetString("username"), req)
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to create api key"))
+		return
+	}
+	details := audit.From(c)
+	details.Resource = key.ID
+	details.After = map[string]interface{}{"label": key.Label, "function": key.Function, "expires_at": key.ExpiresAt}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":     token,
+		"api_key": key.Redacted(),
+	})
+}
+
+func (p *Platform) ListAPIKeysHandler(c *gin.Context) {
+	ns, ok := p.callerNamespace(c, org.RoleViewer)
+	if !ok {
+		return
+	}
+
+	keys, err := apikey.NewManager(p.Client).List(c, ns)
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to list api keys"))
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+func (p *Platform) RevokeAPIKeyHandler(c *gin.Context) {
+	ns, ok := p.callerNamespace(c, org.RoleDeveloper)
+	if !ok {
+		return
+	}
+
+	key, err := apikey.NewManager(p.Client).Revoke(c, ns, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "api key not found"))
+			return
+		}
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to revoke api key"))
+		return
+	}
+	audit.From(c).Before = map[string]interface{}{"label": key.Label, "function": key.Function}
+
+	c.JSON(http.StatusOK, key)
+}
@@ -0,0 +1,319 @@
+// Package audit records who changed what on the platform. Events are appended as
+// JSON Lines to a file that is only ever opened for appending.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Results of an audited action.
+const (
+	ResultSuccess = "success"
+	ResultDenied  = "denied"
+	ResultFailure = "failure"
+)
+
+// Actor is the identity that performed an action.
+type Actor struct {
+	Subject  string `json:"subject"`
+	Username string `json:"username,omitempty"`
+	Provider string `json:"provider,omitempty"`
+}
+
+// Resource is the object an action was performed on.
+type Resource struct {
+	Kind string `json:"kind"`
+	Name string `json:"name,omitempty"`
+}
+
+// Event is one audited action. Before and After summarize the resource around the
+// change; they never contain secrets such as environment variable values or tokens.
+type Event struct {
+	ID        string                 `json:"id"`
+	Time      time.Time              `json:"time"`
+	Action    string                 `json:"action"`
+	Result    string                 `json:"result"`
+	Status    int                    `json:"status,omitempty"`
+	Actor     Actor                  `json:"actor"`
+	Tenant    string                 `json:"tenant,omitempty"`
+	Resource  Resource               `json:"resource"`
+	Before    map[string]interface{} `json:"before,omitempty"`
+	After     map[string]interface{} `json:"after,omitempty"`
+	SourceIP  string                 `json:"source_ip,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// Filter selects events. Zero fields match everything.
+type Filter struct {
+	Since, Until time.Time
+	// Actor matches the subject or username of the actor.
+	Actor string
+	// Action matches the action, or every action of a kind when it ends with ".*".
+	Action string
+	// Resource matches the resource name, or "kind/name".
+	Resource string
+	Tenant   string
+	// Visible further restricts the events to the ones the caller may see.
+	Visible func(*Event) bool
+}
+
+// Matches reports whether e is selected by f.
+func (f *Filter) Matches(e *Event) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	if f.Actor != "" && f.Actor != e.Actor.Subject && f.Actor != e.Actor.Username {
+		return false
+	}
+	if f.Action != "" {
+		if prefix, ok := strings.CutSuffix(f.Action, "*"); ok {
+			if !strings.HasPrefix(e.Action, prefix) {
+				return false
+			}
+		} else if f.Action != e.Action {
+			return false
+		}
+	}
+	if f.Resource != "" && f.Resource != e.Resource.Name && f.Resource != e.Resource.Kind+"/"+e.Resource.Name {
+		return false
+	}
+	if f.Tenant != "" && f.Tenant != e.Tenant {
+		return false
+	}
+	return f.Visible == nil || f.Visible(e)
+}
+
+// Log is an append-only audit log file. A nil *Log records nothing.
+type Log struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens the log at path for appending, creating it if needed.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	// Terminate a line cut short by a crash, so the next event starts on its own line.
+	if complete, err := endsWithNewline(path); err != nil {
+		file.Close()
+		return nil, err
+	} else if !complete {
+		if _, err := file.Write([]byte{'\n'}); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write audit log: %w", err)
+		}
+	}
+	return &Log{path: path, file: file}, nil
+}
+
+// endsWithNewline reports whether the file at path is empty or ends with a newline.
+func endsWithNewline(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	if info.Size() == 0 {
+		return true, nil
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return false, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return last[0] == '\n', nil
+}
+
+// Append writes e to the log, setting its id and time if they are empty.
+func (l *Log) Append(e *Event) error {
+	if e.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		e.ID = id
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return nil
+}
+
+// Query returns the last limit events selected by f, most recent first. A limit of
+// zero returns all of them. The log is read from its end, so recent events are
+// found without reading the whole file.
+func (l *Log) Query(f Filter, limit int) ([]Event, error) {
+	var events []Event
+	err := l.scanBackward(f, func(e *Event) bool {
+		events = append(events, *e)
+		return limit == 0 || len(events) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Export writes the events selected by f to w as JSON Lines, oldest first.
+func (l *Log) Export(w io.Writer, f Filter) error {
+	return l.scan(f, func(_ *Event, line []byte) error {
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+		_, err := w.Write([]byte{'\n'})
+		return err
+	})
+}
+
+// scan calls fn with every event selected by f and its encoded line, oldest first.
+func (l *Log) scan(f Filter, fn func(*Event, []byte) error) error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			// A line cut short by a crash is skipped rather than failing every query.
+			continue
+		}
+		if !f.Matches(&e) {
+			continue
+		}
+		if err := fn(&e, line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return nil
+}
+
+// readChunk is how much of the log scanBackward reads at once.
+var readChunk = 64 * 1024
+
+// maxLine bounds the length of an event, longer lines are skipped as corrupt.
+const maxLine = 1024 * 1024
+
+// scanBackward calls fn with every event selected by f, newest first, until fn
+// returns false.
+func (l *Log) scanBackward(f Filter, fn func(*Event) bool) error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	// match reports whether to go on after the line.
+	match := func(line []byte) bool {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || len(line) > maxLine {
+			return true
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			// A line cut short by a crash is skipped rather than failing every query.
+			return true
+		}
+		return !f.Matches(&e) || fn(&e)
+	}
+
+	// head is the start of a line whose beginning is in a chunk not read yet.
+	var head []byte
+	buf := make([]byte, readChunk)
+	for end := info.Size(); end > 0; {
+		n := min(int64(len(buf)), end)
+		end -= n
+		if _, err := file.ReadAt(buf[:n], end); err != nil {
+			return fmt.Errorf("failed to read audit log: %w", err)
+		}
+		chunk := append(buf[:n:n], head...)
+		first := bytes.IndexByte(chunk, '\n')
+		if first < 0 {
+			if len(chunk) > maxLine+1 {
+				chunk = nil
+			}
+			head = append(head[:0:0], chunk...)
+			continue
+		}
+		for rest := chunk[first+1:]; len(rest) > 0; {
+			i := bytes.LastIndexByte(rest, '\n')
+			if !match(rest[i+1:]) {
+				return nil
+			}
+			rest = rest[:max(i, 0)]
+		}
+		head = append(head[:0:0], chunk[:first]...)
+	}
+	match(head)
+	return nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate audit event id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
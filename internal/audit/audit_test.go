@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"faas-api/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestLog(t *testing.T) *Log {
+	l, err := Open(filepath.Join(t.TempDir(), "audit", "audit.jsonl"))
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestAppendAndQuery(t *testing.T) {
+	l := openTestLog(t)
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	events := []Event{
+		{Action: "function.deploy", Actor: Actor{Subject: "github|1", Username: "jane"}, Tenant: "jane-ns", Resource: Resource{Kind: "function", Name: "hello"}},
+		{Action: "apikey.create", Actor: Actor{Subject: "github|1", Username: "jane"}, Tenant: "jane-ns", Resource: Resource{Kind: "apikey", Name: "k1"}},
+		{Action: "function.delete", Actor: Actor{Subject: "github|2", Username: "bob"}, Tenant: "acme-ns", Resource: Resource{Kind: "function", Name: "hello"}},
+	}
+	for i := range events {
+		events[i].Time = start.Add(time.Duration(i) * time.Hour)
+		events[i].Result = ResultSuccess
+		require.NoError(t, l.Append(&events[i]))
+		require.NotEmpty(t, events[i].ID)
+	}
+
+	all, err := l.Query(Filter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	require.Equal(t, "function.delete", all[0].Action, "most recent first")
+
+	latest, err := l.Query(Filter{}, 1)
+	require.NoError(t, err)
+	require.Len(t, latest, 1)
+	require.Equal(t, events[2].ID, latest[0].ID)
+
+	for name, tc := range map[string]struct {
+		filter Filter
+		want   []string
+	}{
+		"actor subject":  {Filter{Actor: "github|2"}, []string{"function.delete"}},
+		"actor username": {Filter{Actor: "jane"}, []string{"apikey.create", "function.deploy"}},
+		"resource":       {Filter{Resource: "hello"}, []string{"function.delete", "function.deploy"}},
+		"kind/resource":  {Filter{Resource: "apikey/k1"}, []string{"apikey.create"}},
+		"action prefix":  {Filter{Action: "function.*"}, []string{"function.delete", "function.deploy"}},
+		"time range":     {Filter{Since: start.Add(time.Hour), Until: start.Add(2 * time.Hour)}, []string{"apikey.create"}},
+		"tenant":         {Filter{Tenant: "acme-ns"}, []string{"function.delete"}},
+		"visible":        {Filter{Visible: func(e *Event) bool { return e.Tenant == "jane-ns" }}, []string{"apikey.create", "function.deploy"}},
+	} {
+		got, err := l.Query(tc.filter, 0)
+		require.NoError(t, err, name)
+		actions := []string{}
+		for _, e := range got {
+			actions = append(actions, e.Action)
+		}
+		require.Equal(t, tc.want, actions, name)
+	}
+}
+
+func TestQueryReadsBackwardAcrossChunks(t *testing.T) {
+	previous := readChunk
+	readChunk = 7 // far shorter than an event
+	t.Cleanup(func() { readChunk = previous })
+
+	l := openTestLog(t)
+	for i := range 20 {
+		require.NoError(t, l.Append(&Event{Action: "token.create", Resource: Resource{Kind: "token", Name: strconv.Itoa(i)}}))
+	}
+	// A line cut short by a crash is skipped.
+	_, err := l.file.Write([]byte(`{"action":"tok`))
+	require.NoError(t, err)
+
+	all, err := l.Query(Filter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, all, 20)
+	for i, e := range all {
+		require.Equal(t, strconv.Itoa(19-i), e.Resource.Name)
+	}
+
+	latest, err := l.Query(Filter{Resource: "token/3"}, 5)
+	require.NoError(t, err)
+	require.Len(t, latest, 1)
+}
+
+func TestExport(t *testing.T) {
+	l := openTestLog(t)
+	for _, action := range []string{"token.create", "token.revoke", "session.login"} {
+		require.NoError(t, l.Append(&Event{Action: action, Result: ResultSuccess}))
+	}
+	// A line cut short by a crash does not break reading the log.
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"id":"trunc`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// Events appended after reopening the log start on a new line.
+	require.NoError(t, l.Close())
+	reopened, err := Open(l.path)
+	require.NoError(t, err)
+	defer reopened.Close()
+	require.NoError(t, reopened.Append(&Event{Action: "token.create", Result: ResultSuccess}))
+
+	var out bytes.Buffer
+	require.NoError(t, reopened.Export(&out, Filter{Action: "token.*"}))
+
+	var actions []string
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		actions = append(actions, e.Action)
+	}
+	require.Equal(t, []string{"token.create", "token.revoke", "token.create"}, actions, "oldest first")
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := openTestLog(t)
+
+	router := gin.New()
+	router.Use(logging.Middleware, func(c *gin.Context) {
+		c.Set("sub", "github|1")
+		c.Set("username", "jane")
+		c.Next()
+	})
+	router.DELETE("/functions/:name", l.Middleware("function.delete", "function"), func(c *gin.Context) {
+		d := From(c)
+		d.Tenant = "jane-ns"
+		d.Before = map[string]interface{}{"image": "registry/hello"}
+		if c.Param("name") == "missing" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "function not found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, req := range []struct{ name, id string }{{"hello", "req-hello"}, {"missing", "forged\"}\nid"}} {
+		r := httptest.NewRequest(http.MethodDelete, "/functions/"+req.name, nil)
+		r.Header.Set(logging.RequestIDHeader, req.id)
+		r.RemoteAddr = "10.0.0.7:4242"
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	events, err := l.Query(Filter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	failed, deleted := events[0], events[1]
+	require.Equal(t, "function.delete", deleted.Action)
+	require.Equal(t, ResultSuccess, deleted.Result)
+	require.Equal(t, http.StatusNoContent, deleted.Status)
+	require.Equal(t, Actor{Subject: "github|1", Username: "jane"}, deleted.Actor)
+	require.Equal(t, "jane-ns", deleted.Tenant)
+	require.Equal(t, Resource{Kind: "function", Name: "hello"}, deleted.Resource)
+	require.Equal(t, "registry/hello", deleted.Before["image"])
+	require.Equal(t, "10.0.0.7", deleted.SourceIP)
+	require.Equal(t, "req-hello", deleted.RequestID)
+
+	require.Equal(t, ResultFailure, failed.Result)
+	require.Equal(t, http.StatusNotFound, failed.Status)
+	require.Equal(t, "function not found", failed.Error)
+	require.Regexp(t, "^[0-9a-f]{32}$", failed.RequestID, "malformed request ids are replaced")
+
+	// Handlers of routes that are not audited can describe their events safely.
+	From(&gin.Context{}).Tenant = "ignored"
+}
@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"faas-api/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const detailsKey = "audit_details"
+
+// Details are filled in by handlers of audited routes with what only they know.
+type Details struct {
+	Tenant   string
+	Resource string
+	Before   map[string]interface{}
+	After    map[string]interface{}
+}
+
+// From returns the details of the audit event of the request. On routes that are
+// not audited the details are discarded.
+func From(c *gin.Context) *Details {
+	if d, ok := c.Value(detailsKey).(*Details); ok {
+		return d
+	}
+	return &Details{}
+}
+
+// Middleware records an event with action for every request to the route once its
+// handler has run. The resource name defaults to the :name, :id or :org path parameter.
+func (l *Log) Middleware(action, kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d := &Details{}
+		for _, param := range []string{"name", "id", "org"} {
+			if v := c.Param(param); v != "" {
+				d.Resource = v
+				break
+			}
+		}
+		c.Set(detailsKey, d)
+		w := &errorCapture{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		c.Next()
+
+		status := c.Writer.Status()
+		e := Event{
+			Action:   action,
+			Result:   result(status),
+			Status:   status,
+			Tenant:   d.Tenant,
+			Resource: Resource{Kind: kind, Name: d.Resource},
+			Before:   d.Before,
+			After:    d.After,
+		}
+		if status >= http.StatusBadRequest {
+			e.Error = w.message()
+		}
+		l.Record(c, e)
+	}
+}
+
+// Record appends e to the log, filling in the actor, source IP and request id from
+// c where e leaves them empty. The request id is the one assigned by
+// logging.Middleware, never taken unchecked from the request headers. Failures are
+// logged, not returned, so that auditing never fails the request itself.
+func (l *Log) Record(c *gin.Context, e Event) {
+	if l == nil {
+		return
+	}
+	if e.Actor.Subject == "" {
+		e.Actor = Actor{
+			Subject:  c.GetString("sub"),
+			Username: c.GetString("username"),
+			Provider: c.GetString("provider"),
+		}
+	}
+	if e.Result == "" {
+		e.Result = ResultSuccess
+	}
+	e.SourceIP = c.ClientIP()
+	e.RequestID = logging.RequestID(c)
+
+	if err := l.Append(&e); err != nil {
+		log.WithError(err).WithField("action", e.Action).Error("failed to record audit event")
+	}
+}
+
+func result(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ResultDenied
+	case status >= http.StatusBadRequest:
+		return ResultFailure
+	default:
+		return ResultSuccess
+	}
+}
+
+// maxErrorBody bounds how much of an error response is kept for the event.
+const maxErrorBody = 4096
+
+// errorCapture keeps the body of error responses, to record their error message.
+type errorCapture struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *errorCapture) Write(b []byte) (int, error) {
+	if w.Status() >= http.StatusBadRequest && w.body.Len() < maxErrorBody {
+		w.body.Write(b[:min(len(b), maxErrorBody-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// message returns the "error" field of a JSON error response.
+func (w *errorCapture) message() string {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(w.body.Bytes(), &body) != nil {
+		return ""
+	}
+	return body.Error
+}
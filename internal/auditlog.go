@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"faas-api/internal/apierror"
+	"faas-api/internal/audit"
+	"faas-api/internal/function"
+	"faas-api/internal/logging"
+	"faas-api/internal/org"
+	apiv1 "faas-api/pkg/api/v1"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// auditFilter builds the filter of an audit query from the since, until, actor,
+// action, resource and tenant query parameters. Platform admins see every event;
+// other callers see the events of the namespace they act on and their own actions.
+// It writes an error response and returns false if the query is invalid.
+func (p *Platform) auditFilter(c *gin.Context) (audit.Filter, bool) {
+	f := audit.Filter{
+		Actor:    c.Query("actor"),
+		Action:   c.Query("action"),
+		Resource: c.Query("resource"),
+		Tenant:   c.Query("tenant"),
+	}
+	for param, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := c.Query(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "%s must be an RFC 3339 time", param))
+				return f, false
+			}
+			*t = parsed
+		}
+	}
+
+	sub := c.GetString("sub")
+	if p.Sessions != nil && p.Sessions.IsAdmin(sub) {
+		return f, true
+	}
+
+	// Only admins of an organization may read its audit trail.
+	ns, ok := p.callerNamespace(c, org.RoleAdmin)
+	if !ok {
+		return f, false
+	}
+	personal := c.Query("org") == "" && c.GetString("namespace") == ""
+	f.Visible = func(e *audit.Event) bool {
+		return e.Tenant == ns || (personal && e.Actor.Subject == sub)
+	}
+	return f, true
+}
+
+// ListAuditEventsHandler returns the most recent audit events matching the query,
+// newest first, up to limit (default 100, at most 1000).
+func (p *Platform) ListAuditEventsHandler(c *gin.Context) {
+	if p.Audit == nil {
+		apierror.Abort(c, apierror.New(apiv1.CodeUnavailable, "audit log is not configured"))
+		return
+	}
+
+	limit := defaultAuditLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "limit must be a number between 1 and %d", maxAuditLimit))
+			return
+		}
+		limit = n
+	}
+
+	f, ok := p.auditFilter(c)
+	if !ok {
+		return
+	}
+
+	events, err := p.Audit.Query(f, limit)
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to query audit log"))
+		return
+	}
+	if events == nil {
+		events = []audit.Event{}
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// ExportAuditEventsHandler streams every audit event matching the query as JSON
+// Lines, oldest first.
+func (p *Platform) ExportAuditEventsHandler(c *gin.Context) {
+	if p.Audit == nil {
+		apierror.Abort(c, apierror.New(apiv1.CodeUnavailable, "audit log is not configured"))
+		return
+	}
+
+	f, ok := p.auditFilter(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	c.Status(http.StatusOK)
+	if err := p.Audit.Export(c.Writer, f); err != nil {
+		// The status has been sent already; the client sees a truncated export.
+		logging.From(c).WithError(err).Error("failed to export audit log")
+	}
+}
+
+// functionSummary describes a function for the audit log. Only the names of
+// environment variables are kept, as their values may be secrets.
+func functionSummary(fn *apiv1.Function) map[string]interface{} {
+	env := make([]string, 0, len(fn.Env))
+	for _, e := range fn.Env {
+		env = append(env, e.Name)
+	}
+	return map[string]interface{}{
+		"image":      fn.Image,
+		"runtime":    fn.Runtime,
+		"visibility": fn.Visibility,
+		"labels":     fn.Labels,
+		"env":        env,
+	}
+}
+
+func envNames(vars []function.EnvVar) []string {
+	names := make([]string, 0, len(vars))
+	for _, v := range vars {
+		names = append(names, v.Key)
+	}
+	return names
+}
@@ -0,0 +1,391 @@
+// Package config holds the configuration of the API server. Values are taken, in
+// increasing order of precedence, from the defaults, a YAML file, environment
+// variables and command line flags, and are validated once at startup.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the configuration of the API server. Every field tagged with env can be
+// set with that environment variable and with the flag of the same name in lower
+// case with dashes, e.g. COOKIE_DOMAIN and --cookie-domain.
+type Config struct {
+	// ListenAddress is the address the HTTP server listens on.
+	ListenAddress string `json:"listenAddress" env:"LISTEN_ADDRESS"`
+	// ShutdownTimeout bounds how long in-flight requests, such as builds, may run
+	// after SIGTERM before the server exits anyway.
+	ShutdownTimeout Duration `json:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDelay is how long the server keeps accepting requests after SIGTERM
+	// with its readiness failing, so that it is taken out of the Service first.
+	ShutdownDelay Duration `json:"shutdownDelay" env:"SHUTDOWN_DELAY"`
+	// DrainFile, if set, is created at startup and removed once in-flight requests
+	// have finished on shutdown. The Docker daemon waits for its removal to stop.
+	DrainFile string `json:"drainFile" env:"DRAIN_FILE"`
+	// PlatformAdmins are the subjects that may see and manage every user's sessions
+	// and audit events.
+	PlatformAdmins []string `json:"platformAdmins" env:"PLATFORM_ADMINS"`
+
+	Logging    Logging    `json:"logging"`
+	Kubernetes Kubernetes `json:"kubernetes"`
+	Cookie     Cookie     `json:"cookie"`
+	Registry   Registry   `json:"registry"`
+	Auth       Auth       `json:"auth"`
+	Tenant     Tenant     `json:"tenant"`
+	Session    Session    `json:"session"`
+	Audit      Audit      `json:"audit"`
+	Invoke     Invoke     `json:"invoke"`
+	Metrics    Metrics    `json:"metrics"`
+	Tracing    Tracing    `json:"tracing"`
+}
+
+// Logging configures the server's log output.
+type Logging struct {
+	// Level is the minimum level logged: debug, info, warn or error.
+	Level string `json:"level" env:"LOG_LEVEL"`
+	// Format is json, for log collectors, or text.
+	Format string `json:"format" env:"LOG_FORMAT"`
+}
+
+// Kubernetes selects the cluster the server manages. Inside a pod it uses the pod's
+// service account unless a kubeconfig or context is given; outside a cluster it uses
+// the kubeconfig, ~/.kube/config by default.
+type Kubernetes struct {
+	Kubeconfig string `json:"kubeconfig" env:"KUBECONFIG"`
+	Context    string `json:"context" env:"KUBE_CONTEXT"`
+}
+
+// Cookie configures the session cookie.
+type Cookie struct {
+	Secret Secret `json:"secret" env:"COOKIE_SECRET"`
+	// Domain is empty or "localhost" for local development.
+	Domain string `json:"domain" env:"COOKIE_DOMAIN"`
+	Secure bool   `json:"secure" env:"COOKIE_SECURE"`
+}
+
+// Registry is the container registry function images are pushed to.
+type Registry struct {
+	Address  string `json:"address" env:"DOCKER_REGISTRY"`
+	Username string `json:"username" env:"DOCKER_USERNAME"`
+	Password Secret `json:"password" env:"DOCKER_PASSWORD"`
+}
+
+// Auth configures how users and workloads log in.
+type Auth struct {
+	// ProvidersFile lists the identity providers. Without it, Auth0 is configured
+	// from the Auth0 section.
+	ProvidersFile string `json:"providersFile" env:"IDENTITY_PROVIDERS_CONFIG"`
+	// MachineIdentityFile lists the issuers trusted for workload JWTs.
+	MachineIdentityFile string `json:"machineIdentityFile" env:"MACHINE_IDENTITY_CONFIG"`
+	Auth0               Auth0  `json:"auth0"`
+}
+
+// Auth0 is the identity provider used when no providers file is given.
+type Auth0 struct {
+	Domain       string `json:"domain" env:"AUTH0_DOMAIN"`
+	ClientID     string `json:"clientID" env:"AUTH0_CLIENT_ID"`
+	ClientSecret Secret `json:"clientSecret" env:"AUTH0_CLIENT_SECRET"`
+	CallbackURL  string `json:"callbackURL" env:"AUTH0_CALLBACK_URL"`
+}
+
+// Tenant configures the guard rails provisioned in tenant namespaces.
+type Tenant struct {
+	TemplateFile      string   `json:"templateFile" env:"TENANT_TEMPLATE_FILE"`
+	ReconcileInterval Duration `json:"reconcileInterval" env:"TENANT_RECONCILE_INTERVAL"`
+}
+
+// Session configures server-side browser sessions.
+type Session struct {
+	Namespace       string   `json:"namespace" env:"SESSION_NAMESPACE"`
+	IdleTimeout     Duration `json:"idleTimeout" env:"SESSION_IDLE_TIMEOUT"`
+	AbsoluteTimeout Duration `json:"absoluteTimeout" env:"SESSION_ABSOLUTE_TIMEOUT"`
+}
+
+// Audit configures the audit log.
+type Audit struct {
+	LogFile string `json:"logFile" env:"AUDIT_LOG_FILE"`
+}
+
+// Metrics configures the labels of the Prometheus metrics.
+type Metrics struct {
+	// FunctionLabels adds function names as labels, which multiplies the number of
+	// series by the number of functions.
+	FunctionLabels bool `json:"functionLabels" env:"METRICS_FUNCTION_LABELS"`
+	// Runtimes are reported by name; other runtimes are reported as "other".
+	Runtimes []string `json:"runtimes" env:"METRICS_RUNTIMES"`
+}
+
+// Tracing configures the export of OpenTelemetry traces.
+type Tracing struct {
+	// Endpoint is the URL of the OTLP/HTTP collector, such as
+	// http://otel-collector:4318. Traces are not exported when it is empty.
+	Endpoint string `json:"endpoint" env:"TRACING_ENDPOINT"`
+	// SampleRatio is the fraction of the traces started by the server that are
+	// sampled. Requests carrying a trace context follow the caller's decision.
+	SampleRatio float64 `json:"sampleRatio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// Invoke configures the invocation gateway.
+type Invoke struct {
+	MaxBodyBytes int64       `json:"maxBodyBytes" env:"INVOKE_MAX_BODY_BYTES"`
+	Timeout      Duration    `json:"timeout" env:"INVOKE_TIMEOUT"`
+	Async        InvokeAsync `json:"async"`
+}
+
+// InvokeAsync configures asynchronous invocations.
+type InvokeAsync struct {
+	MaxAttempts    int      `json:"maxAttempts" env:"INVOKE_ASYNC_MAX_ATTEMPTS"`
+	Timeout        Duration `json:"timeout" env:"INVOKE_ASYNC_TIMEOUT"`
+	MaxResultBytes int64    `json:"maxResultBytes" env:"INVOKE_ASYNC_MAX_RESULT_BYTES"`
+	Retention      Duration `json:"retention" env:"INVOKE_ASYNC_RETENTION"`
+	// Workers bounds the invocations run at once and QueueSize those waiting for a
+	// worker; further invocations are refused with 503.
+	Workers   int `json:"workers" env:"INVOKE_ASYNC_WORKERS"`
+	QueueSize int `json:"queueSize" env:"INVOKE_ASYNC_QUEUE_SIZE"`
+}
+
+// Default returns the configuration used for everything that is not set.
+func Default() *Config {
+	return &Config{
+		ListenAddress:   "0.0.0.0:8090",
+		ShutdownTimeout: Duration(2 * time.Minute),
+		ShutdownDelay:   Duration(10 * time.Second),
+		Logging: Logging{
+			Level:  "info",
+			Format: "json",
+		},
+		Tenant: Tenant{
+			ReconcileInterval: Duration(5 * time.Minute),
+		},
+		Session: Session{
+			Namespace:       "default",
+			IdleTimeout:     Duration(12 * time.Hour),
+			AbsoluteTimeout: Duration(7 * 24 * time.Hour),
+		},
+		Audit: Audit{
+			LogFile: "/var/lib/faas/audit/audit.jsonl",
+		},
+		Metrics: Metrics{
+			Runtimes: []string{"nodejs", "python", "go", "java", "ruby", "php", "dotnet", "rust"},
+		},
+		Tracing: Tracing{
+			SampleRatio: 1,
+		},
+		Invoke: Invoke{
+			MaxBodyBytes: 6 << 20,
+			Timeout:      Duration(30 * time.Second),
+			Async: InvokeAsync{
+				MaxAttempts:    3,
+				Timeout:        Duration(15 * time.Minute),
+				MaxResultBytes: 1 << 20,
+				Retention:      Duration(time.Hour),
+				Workers:        16,
+				QueueSize:      256,
+			},
+		},
+	}
+}
+
+// LoadFile applies the YAML file at path. Unknown fields are an error.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks the configuration, reporting every problem at once.
+func (c *Config) Validate() error {
+	var errs []error
+	problem := func(field, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+	required := func(field, value string) {
+		if value == "" {
+			problem(field, "is required")
+		}
+	}
+	positive := func(field string, value int64) {
+		if value <= 0 {
+			problem(field, "must be positive")
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		problem("listenAddress (LISTEN_ADDRESS)", "must be host:port: %v", err)
+	}
+	positive("shutdownTimeout (SHUTDOWN_TIMEOUT)", int64(c.ShutdownTimeout))
+	if c.ShutdownDelay < 0 {
+		problem("shutdownDelay (SHUTDOWN_DELAY)", "must not be negative")
+	}
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		problem("logging.level (LOG_LEVEL)", "must be debug, info, warn or error")
+	}
+	if c.Logging.Format != "json" && c.Logging.Format != "text" {
+		problem("logging.format (LOG_FORMAT)", "must be json or text")
+	}
+	required("cookie.secret (COOKIE_SECRET)", c.Cookie.Secret.Value())
+
+	required("registry.address (DOCKER_REGISTRY)", c.Registry.Address)
+	required("registry.username (DOCKER_USERNAME)", c.Registry.Username)
+	required("registry.password (DOCKER_PASSWORD)", c.Registry.Password.Value())
+
+	if c.Auth.ProvidersFile == "" {
+		required("auth.auth0.domain (AUTH0_DOMAIN, or IDENTITY_PROVIDERS_CONFIG)", c.Auth.Auth0.Domain)
+		required("auth.auth0.clientID (AUTH0_CLIENT_ID)", c.Auth.Auth0.ClientID)
+		required("auth.auth0.clientSecret (AUTH0_CLIENT_SECRET)", c.Auth.Auth0.ClientSecret.Value())
+		required("auth.auth0.callbackURL (AUTH0_CALLBACK_URL)", c.Auth.Auth0.CallbackURL)
+	}
+
+	positive("tenant.reconcileInterval (TENANT_RECONCILE_INTERVAL)", int64(c.Tenant.ReconcileInterval))
+	required("session.namespace (SESSION_NAMESPACE)", c.Session.Namespace)
+	positive("session.idleTimeout (SESSION_IDLE_TIMEOUT)", int64(c.Session.IdleTimeout))
+	positive("session.absoluteTimeout (SESSION_ABSOLUTE_TIMEOUT)", int64(c.Session.AbsoluteTimeout))
+	required("audit.logFile (AUDIT_LOG_FILE)", c.Audit.LogFile)
+	positive("invoke.maxBodyBytes (INVOKE_MAX_BODY_BYTES)", c.Invoke.MaxBodyBytes)
+	positive("invoke.timeout (INVOKE_TIMEOUT)", int64(c.Invoke.Timeout))
+	positive("invoke.async.maxAttempts (INVOKE_ASYNC_MAX_ATTEMPTS)", int64(c.Invoke.Async.MaxAttempts))
+	positive("invoke.async.timeout (INVOKE_ASYNC_TIMEOUT)", int64(c.Invoke.Async.Timeout))
+	positive("invoke.async.maxResultBytes (INVOKE_ASYNC_MAX_RESULT_BYTES)", c.Invoke.Async.MaxResultBytes)
+	positive("invoke.async.retention (INVOKE_ASYNC_RETENTION)", int64(c.Invoke.Async.Retention))
+	positive("invoke.async.workers (INVOKE_ASYNC_WORKERS)", int64(c.Invoke.Async.Workers))
+	positive("invoke.async.queueSize (INVOKE_ASYNC_QUEUE_SIZE)", int64(c.Invoke.Async.QueueSize))
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem("tracing.endpoint (TRACING_ENDPOINT)", "must be an http or https URL")
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problem("tracing.sampleRatio (TRACING_SAMPLE_RATIO)", "must be between 0 and 1")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Secrets returns the values of the secrets of the configuration, to be kept out of
+// the logs.
+func (c *Config) Secrets() []string {
+	return []string{c.Cookie.Secret.Value(), c.Registry.Password.Value(), c.Auth.Auth0.ClientSecret.Value()}
+}
+
+// Print writes the configuration as YAML with its secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// Duration is a time.Duration written as a string such as "5m" in the config file.
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration { return time.Duration(d) }
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\": %w", err)
+	}
+	return d.Set(s)
+}
+
+func (d *Duration) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Secret is a credential, given either inline or as the path of a file holding it,
+// such as a mounted Kubernetes secret. In the config file a file is written as
+// {file: /path}; in the environment and on the command line as <NAME>_FILE and
+// --<name>-file. Secrets are redacted when the configuration is printed.
+type Secret struct {
+	value string
+	// File is read by Resolve.
+	File string
+}
+
+// NewSecret returns an inline secret.
+func NewSecret(value string) Secret { return Secret{value: value} }
+
+// Value returns the secret. Files are only read by Resolve.
+func (s Secret) Value() string { return s.value }
+
+// Resolve reads the secret from its file, if it has one. Trailing newlines, which
+// most tools add when writing files, are removed.
+func (s *Secret) Resolve() error {
+	if s.File == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.File)
+	if err != nil {
+		return fmt.Errorf("failed to read secret file: %w", err)
+	}
+	s.value = strings.TrimRight(string(data), "\r\n")
+	return nil
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	switch {
+	case s.File != "":
+		return json.Marshal(map[string]string{"file": s.File})
+	case s.value != "":
+		return json.Marshal("<redacted>")
+	default:
+		return json.Marshal("")
+	}
+}
+
+func (s *Secret) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err == nil {
+		*s = Secret{value: value}
+		return nil
+	}
+	var ref struct {
+		File string `json:"file"`
+	}
+	if err := json.Unmarshal(b, &ref); err != nil || ref.File == "" {
+		return errors.New("secret must be a string or {file: <path>}")
+	}
+	*s = Secret{File: ref.File}
+	return nil
+}
+
+// String keeps secrets out of logs and error messages.
+func (s Secret) String() string {
+	if s.value == "" && s.File == "" {
+		return ""
+	}
+	return "<redacted>"
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+listenAddress: 127.0.0.1:9000
+cookie:
+  domain: file.example.com
+session:
+  idleTimeout: 1h
+  absoluteTimeout: 2h
+invoke:
+  timeout: 10s
+`)
+
+	c, opts, err := Load(
+		[]string{"--config", file, "--session-idle-timeout", "30m"},
+		env(map[string]string{
+			"SESSION_IDLE_TIMEOUT": "45m",
+			"COOKIE_DOMAIN":        " env.example.com ",
+			"COOKIE_SECURE":        "true",
+			"PLATFORM_ADMINS":      "github|1, oidc|2,",
+			"TRACING_SAMPLE_RATIO": "0.25",
+		}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, file, opts.File)
+
+	require.Equal(t, "127.0.0.1:9000", c.ListenAddress, "file over default")
+	require.Equal(t, "env.example.com", c.Cookie.Domain, "env over file")
+	require.True(t, c.Cookie.Secure)
+	require.Equal(t, 30*time.Minute, c.Session.IdleTimeout.Std(), "flag over env")
+	require.Equal(t, 2*time.Hour, c.Session.AbsoluteTimeout.Std())
+	require.Equal(t, 10*time.Second, c.Invoke.Timeout.Std())
+	require.Equal(t, int64(6<<20), c.Invoke.MaxBodyBytes, "default")
+	require.Equal(t, []string{"github|1", "oidc|2"}, c.PlatformAdmins)
+	require.Equal(t, 0.25, c.Tracing.SampleRatio)
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, _, err := Load(nil, env(map[string]string{"INVOKE_TIMEOUT": "soon"}))
+	require.ErrorContains(t, err, "INVOKE_TIMEOUT")
+
+	file := writeFile(t, "config.yaml", "cookie:\n  domian: example.com\n")
+	_, _, err = Load([]string{"--config", file}, env(nil))
+	require.ErrorContains(t, err, "domian", "unknown fields are rejected")
+
+	_, _, err = Load(nil, env(map[string]string{"DOCKER_PASSWORD_FILE": "/does/not/exist"}))
+	require.ErrorContains(t, err, "registry.password")
+}
+
+func TestSecretFiles(t *testing.T) {
+	password := writeFile(t, "password", "s3cret\n")
+	clientSecret := writeFile(t, "client-secret", "from-flag")
+	file := writeFile(t, "config.yaml", "cookie:\n  secret: {file: "+writeFile(t, "cookie", "cookie-secret")+"}\n")
+
+	c, _, err := Load(
+		[]string{"--config", file, "--auth0-client-secret-file", clientSecret},
+		env(map[string]string{"DOCKER_PASSWORD_FILE": password}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", c.Registry.Password.Value())
+	require.Equal(t, "from-flag", c.Auth.Auth0.ClientSecret.Value())
+	require.Equal(t, "cookie-secret", c.Cookie.Secret.Value())
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.ListenAddress = "8090"
+	c.Session.IdleTimeout = 0
+	c.Tracing = Tracing{Endpoint: "otel-collector:4318", SampleRatio: 2}
+	c.Logging.Format = "logfmt"
+
+	err := c.Validate()
+	require.Error(t, err)
+	for _, want := range []string{
+		"listenAddress (LISTEN_ADDRESS): must be host:port",
+		"cookie.secret (COOKIE_SECRET): is required",
+		"registry.password (DOCKER_PASSWORD): is required",
+		"auth.auth0.clientID (AUTH0_CLIENT_ID): is required",
+		"session.idleTimeout (SESSION_IDLE_TIMEOUT): must be positive",
+		"logging.format (LOG_FORMAT): must be json or text",
+		"tracing.endpoint (TRACING_ENDPOINT): must be an http or https URL",
+		"tracing.sampleRatio (TRACING_SAMPLE_RATIO): must be between 0 and 1",
+	} {
+		require.ErrorContains(t, err, want)
+	}
+
+	c = Default()
+	c.Cookie.Secret = NewSecret("cookie")
+	c.Registry = Registry{Address: "registry.example.com", Username: "faas", Password: NewSecret("pw")}
+	c.Auth.ProvidersFile = "/etc/faas/providers.yaml"
+	require.NoError(t, c.Validate())
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	c := Default()
+	c.Cookie.Secret = NewSecret("cookie-secret")
+	c.Registry.Password = NewSecret("registry-password")
+	c.Auth.Auth0.ClientSecret = Secret{File: "/var/run/secrets/auth0"}
+
+	var out bytes.Buffer
+	require.NoError(t, c.Print(&out))
+	require.NotContains(t, out.String(), "cookie-secret")
+	require.NotContains(t, out.String(), "registry-password")
+	require.Contains(t, out.String(), "<redacted>")
+	require.Contains(t, out.String(), "file: /var/run/secrets/auth0")
+
+	// The printed configuration can be loaded back.
+	reloaded := Default()
+	require.NoError(t, reloaded.LoadFile(writeFile(t, "printed.yaml", out.String())))
+	require.Equal(t, c.Invoke, reloaded.Invoke)
+}
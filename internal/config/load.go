@@ -0,0 +1,208 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Options are the command line options that are not configuration values.
+type Options struct {
+	// File is the YAML config file, from --config or CONFIG_FILE.
+	File string
+	// PrintConfig asks to print the configuration and exit.
+	PrintConfig bool
+	// MigrateNamespaces is a YAML file mapping legacy namespaces to their owners, to
+	// migrate before exiting; see namespace.LoadMigrations.
+	MigrateNamespaces string
+}
+
+// Load builds the configuration from the defaults, the config file, the environment
+// looked up with getenv and the command line arguments args. It does not validate
+// the result, so that an invalid configuration can still be printed.
+func Load(args []string, getenv func(string) (string, bool)) (*Config, Options, error) {
+	c := Default()
+	var opts Options
+
+	fs := flag.NewFlagSet("faas-api", flag.ContinueOnError)
+	fs.StringVar(&opts.File, "config", "", "YAML config `file` (CONFIG_FILE)")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the configuration with secrets redacted and exit")
+	fs.StringVar(&opts.MigrateNamespaces, "migrate-namespaces", "", "assign the legacy namespaces listed in the YAML `file` to their owners and exit")
+
+	// Flags are applied last, after the file and the environment.
+	var fromFlags []func() error
+	fields := c.fields()
+	for _, f := range fields {
+		f := f
+		fs.Func(flagName(f.env), f.path+" ("+f.env+")", func(v string) error {
+			fromFlags = append(fromFlags, func() error { return f.set(v) })
+			return nil
+		})
+		if f.secret != nil {
+			fs.Func(flagName(f.env)+"-file", "file holding "+f.path+" ("+f.env+"_FILE)", func(v string) error {
+				fromFlags = append(fromFlags, func() error { *f.secret = Secret{File: v}; return nil })
+				return nil
+			})
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, opts, err
+	}
+
+	if opts.File == "" {
+		opts.File, _ = getenv("CONFIG_FILE")
+	}
+	if opts.File != "" {
+		if err := c.LoadFile(opts.File); err != nil {
+			return nil, opts, err
+		}
+	}
+
+	for _, f := range fields {
+		if v, ok := getenv(f.env); ok {
+			if err := f.set(strings.TrimSpace(v)); err != nil {
+				return nil, opts, fmt.Errorf("invalid %s: %w", f.env, err)
+			}
+		}
+		if f.secret == nil {
+			continue
+		}
+		if v, ok := getenv(f.env + "_FILE"); ok && v != "" {
+			*f.secret = Secret{File: strings.TrimSpace(v)}
+		}
+	}
+
+	for _, apply := range fromFlags {
+		if err := apply(); err != nil {
+			return nil, opts, err
+		}
+	}
+
+	for _, f := range fields {
+		if f.secret == nil {
+			continue
+		}
+		if err := f.secret.Resolve(); err != nil {
+			return nil, opts, fmt.Errorf("%s (%s): %w", f.path, f.env, err)
+		}
+	}
+	return c, opts, nil
+}
+
+// LoadFromOS loads the configuration from the process's arguments and environment.
+func LoadFromOS() (*Config, Options, error) {
+	return Load(os.Args[1:], os.LookupEnv)
+}
+
+// field is a configuration value that can be set from the environment.
+type field struct {
+	path   string
+	env    string
+	set    func(string) error
+	secret *Secret
+}
+
+var (
+	secretType   = reflect.TypeOf(Secret{})
+	durationType = reflect.TypeOf(Duration(0))
+)
+
+// fields lists the values of c tagged with env.
+func (c *Config) fields() []field {
+	var fields []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			path := prefix + strings.Split(sf.Tag.Get("json"), ",")[0]
+			fv := v.Field(i)
+			env := sf.Tag.Get("env")
+			if env == "" {
+				if fv.Kind() == reflect.Struct && fv.Type() != secretType {
+					walk(fv, path+".")
+				}
+				continue
+			}
+
+			f := field{path: path, env: env, set: setter(fv)}
+			if fv.Type() == secretType {
+				f.secret = fv.Addr().Interface().(*Secret)
+			}
+			fields = append(fields, f)
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return fields
+}
+
+// setter returns a function parsing a string into v.
+func setter(v reflect.Value) func(string) error {
+	switch {
+	case v.Type() == secretType:
+		return func(s string) error {
+			v.Set(reflect.ValueOf(NewSecret(s)))
+			return nil
+		}
+	case v.Type() == durationType:
+		return v.Addr().Interface().(*Duration).Set
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return func(s string) error {
+			v.SetString(s)
+			return nil
+		}
+	case reflect.Bool:
+		return func(s string) error {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return err
+			}
+			v.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int64:
+		return func(s string) error {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return err
+			}
+			v.SetInt(n)
+			return nil
+		}
+	case reflect.Float64:
+		return func(s string) error {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return err
+			}
+			v.SetFloat(f)
+			return nil
+		}
+	case reflect.Slice:
+		return func(s string) error {
+			var items []string
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			v.Set(reflect.ValueOf(items))
+			return nil
+		}
+	}
+	panic(fmt.Sprintf("config: unsupported field type %s", v.Type()))
+}
+
+// flagName turns an environment variable name into a flag name, e.g. COOKIE_DOMAIN
+// into cookie-domain.
+func flagName(env string) string {
+	return strings.ToLower(strings.ReplaceAll(env, "_", "-"))
+}
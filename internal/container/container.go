@@ -3,46 +3,30 @@ package container
 import (
 	"context"
 	"fmt"
-	"os"
-	"strings"
+
+	"faas-api/internal/config"
 
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
 	log "github.com/sirupsen/logrus"
 )
 
-
-
-func Auth(ctx context.Context, cli *client.Client) error {
-	ServerAddress, ok := os.LookupEnv("DOCKER_REGISTRY")
-	if !ok {
-		return fmt.Errorf("failed to get DOCKER_REGISTRY env")
-	}
-	defer cli.Close()
-	Username, ok := os.LookupEnv("DOCKER_USERNAME")
-	if !ok {
-		return fmt.Errorf("failed to get DOCKER_USERNAME env")
-	}
-	Password, ok := os.LookupEnv("DOCKER_PASSWORD")
-	if !ok {
-		return fmt.Errorf("failed to get DOCKER_PASSWORD env")
-	}
-
+// Auth logs the Docker daemon in to the registry reg.
+func Auth(ctx context.Context, cli *client.Client, reg config.Registry) error {
 	authConfig := registry.AuthConfig{
-		Username:      strings.ReplaceAll(Username,"\n", ""),
-		Password:      strings.ReplaceAll(Password,"\n", ""),
-		ServerAddress: ServerAddress,
+		Username:      reg.Username,
+		Password:      reg.Password.Value(),
+		ServerAddress: reg.Address,
 	}
 	result, err := cli.RegistryLogin(ctx, authConfig)
 	if err != nil {
-		log.WithError(err).Error("failed to login to registry")
-		return err
+		return fmt.Errorf("failed to login to registry %s: %w", reg.Address, err)
 	}
 
 	log.WithField("status", result.Status).Info("login to registry")
 
 	if result.Status != "Login Succeeded" {
-		return err
+		return fmt.Errorf("failed to login to registry %s: %s", reg.Address, result.Status)
 	}
 
 	return nil
@@ -0,0 +1,74 @@
+// Package credential issues and verifies the bearer secrets of the platform: API
+// keys, personal access tokens and session tokens. A credential reads
+// "<prefix><id>_<secret>"; the id locates its record, and only the SHA-256 hash of
+// the secret is stored.
+package credential
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Credential is a newly issued credential.
+type Credential struct {
+	ID   string
+	Hash string
+	// Token is the plaintext credential, handed to its owner once and never stored.
+	Token string
+}
+
+// New issues a credential starting with prefix.
+func New(prefix string) (*Credential, error) {
+	id, err := randomString(6, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := RandomSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &Credential{ID: id, Hash: hash(secret), Token: prefix + id + "_" + secret}, nil
+}
+
+// RandomSecret returns 32 random bytes, base64url encoded.
+func RandomSecret() (string, error) {
+	return randomString(32, base64.RawURLEncoding.EncodeToString)
+}
+
+// Parse splits token into its id and secret. ok is false if token does not start
+// with prefix or is malformed.
+func Parse(prefix, token string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(token, prefix)
+	if !ok {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// Verify reports whether secret is the one hashed to storedHash. The comparison
+// takes constant time.
+func Verify(storedHash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(storedHash), []byte(hash(secret))) == 1
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return encode(b), nil
+}
@@ -0,0 +1,37 @@
+package credential
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAndVerify(t *testing.T) {
+	c, err := New("faas_ak_")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(c.Token, "faas_ak_"+c.ID+"_"))
+	require.NotContains(t, c.Token, c.Hash, "only the hash of the secret is stored")
+
+	id, secret, ok := Parse("faas_ak_", c.Token)
+	require.True(t, ok)
+	require.Equal(t, c.ID, id)
+	require.True(t, Verify(c.Hash, secret))
+	require.False(t, Verify(c.Hash, secret+"x"))
+
+	other, err := New("faas_ak_")
+	require.NoError(t, err)
+	require.NotEqual(t, c.Token, other.Token)
+}
+
+func TestParse(t *testing.T) {
+	for _, token := range []string{"", "faas_pat_abc_def", "faas_ak_", "faas_ak_abc", "faas_ak__def", "faas_ak_abc_"} {
+		_, _, ok := Parse("faas_ak_", token)
+		require.False(t, ok, token)
+	}
+
+	id, secret, ok := Parse("", "abc_def_ghi")
+	require.True(t, ok)
+	require.Equal(t, "abc", id)
+	require.Equal(t, "def_ghi", secret)
+}
@@ -0,0 +1,220 @@
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+
+	"faas-api/internal/k8/logs"
+	"faas-api/internal/service"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// State is the overall health of a function.
+type State string
+
+const (
+	StateReady     State = "ready"     // serving traffic on its latest revision
+	StateDeploying State = "deploying" // a revision is being rolled out
+	StateDegraded  State = "degraded"  // serving traffic, but the latest revision is failing
+	StateFailed    State = "failed"    // not serving traffic
+	StateUnknown   State = "unknown"
+)
+
+// Problem explains one thing that is wrong with a function.
+type Problem struct {
+	Source      string `json:"source"` // "service", "revision" or "pod"
+	Name        string `json:"name"`
+	Reason      string `json:"reason"`
+	Message     string `json:"message,omitempty"`
+	Explanation string `json:"explanation"`
+}
+
+// Diagnosis is the human-readable status of a function.
+type Diagnosis struct {
+	State                 State     `json:"state"`
+	Summary               string    `json:"summary"`
+	LatestCreatedRevision string    `json:"latestCreatedRevision,omitempty"`
+	LatestReadyRevision   string    `json:"latestReadyRevision,omitempty"`
+	Problems              []Problem `json:"problems,omitempty"`
+}
+
+// explanations turns well-known Kubernetes and Knative reasons into advice.
+var explanations = map[string]string{
+	"ImagePullBackOff":           "The function image could not be pulled. Check that the build was pushed and the registry is reachable.",
+	"ErrImagePull":               "The function image could not be pulled. Check that the build was pushed and the registry is reachable.",
+	"InvalidImageName":           "The function image name is invalid.",
+	"CrashLoopBackOff":           "The function keeps crashing on start. Check its logs, and that it listens on the PORT environment variable.",
+	"OOMKilled":                  "The function ran out of memory. Reduce its memory usage or raise its memory limit.",
+	"CreateContainerConfigError": "The function container could not be configured. Check its environment variables and secrets.",
+	"RevisionFailed":             "The latest revision failed to become ready.",
+	"RevisionMissing":            "The revision the service points at could not be found.",
+	"ContainerMissing":           "The function image could not be resolved.",
+	"ProgressDeadlineExceeded":   "The function did not become ready in time. It may be crashing or failing its readiness probe.",
+	"ExitCode":                   "The function container exited with an error. Check its logs.",
+}
+
+func explain(reason, fallback string) string {
+	if e, ok := explanations[reason]; ok {
+		return e
+	}
+	if fallback != "" {
+		return fallback
+	}
+	return "The function is not healthy."
+}
+
+// Diagnose derives a Diagnosis from the Knative Service, its revisions and its pods.
+func Diagnose(ksvc *service.KnativeService, revisions map[string]service.Revision, pods []corev1.Pod) Diagnosis {
+	d := Diagnosis{
+		LatestCreatedRevision: ksvc.Status.LatestCreatedRevisionName,
+		LatestReadyRevision:   ksvc.Status.LatestReadyRevisionName,
+	}
+
+	conditions := map[string]service.Condition{}
+	for _, c := range ksvc.Status.Conditions {
+		conditions[c.Type] = c
+	}
+
+	for _, t := range []string{"ConfigurationsReady", "RoutesReady"} {
+		if c, ok := conditions[t]; ok && c.Status == "False" {
+			d.Problems = append(d.Problems, Problem{
+				Source:      "service",
+				Name:        t,
+				Reason:      c.Reason,
+				Message:     c.Message,
+				Explanation: explain(c.Reason, c.Message),
+			})
+		}
+	}
+
+	if rev, ok := revisions[d.LatestCreatedRevision]; ok {
+		for _, c := range rev.Conditions {
+			if c.Type == "Ready" && c.Status == "False" {
+				d.Problems = append(d.Problems, Problem{
+					Source:      "revision",
+					Name:        rev.Name,
+					Reason:      c.Reason,
+					Message:     c.Message,
+					Explanation: explain(c.Reason, c.Message),
+				})
+			}
+		}
+	}
+
+	podFailing := false
+	for _, pod := range pods {
+		if p, ok := podProblem(pod); ok {
+			d.Problems = append(d.Problems, p)
+			podFailing = true
+		}
+	}
+
+	ready, hasReady := conditions["Ready"]
+	switch {
+	case !hasReady:
+		d.State = StateDeploying
+		d.Summary = "The function has been created and is waiting to be reconciled."
+	case ready.Status == "True" && d.LatestCreatedRevision != d.LatestReadyRevision && len(d.Problems) > 0:
+		d.State = StateDegraded
+		d.Summary = fmt.Sprintf("Serving revision %s, but the latest revision %s is failing.", d.LatestReadyRevision, d.LatestCreatedRevision)
+	case ready.Status == "True":
+		d.State = StateReady
+		d.Summary = "The function is ready and serving traffic."
+	case ready.Status == "False":
+		d.State = StateFailed
+		d.Summary = summarize(d.Problems, ready)
+	case podFailing:
+		d.State = StateFailed
+		d.Summary = summarize(d.Problems, ready)
+	case ready.Status == "Unknown":
+		d.State = StateDeploying
+		d.Summary = "The latest revision is being rolled out."
+	default:
+		d.State = StateUnknown
+		d.Summary = "The function status could not be determined."
+	}
+
+	return d
+}
+
+func summarize(problems []Problem, ready service.Condition) string {
+	if len(problems) > 0 {
+		return problems[len(problems)-1].Explanation
+	}
+	return explain(ready.Reason, ready.Message)
+}
+
+// podProblem reports the most relevant failure of a pod's user container.
+func podProblem(pod corev1.Pod) (Problem, bool) {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != logs.UserContainer {
+			continue
+		}
+		problem := Problem{Source: "pod", Name: pod.Name}
+
+		if w := cs.State.Waiting; w != nil && w.Reason != "" && w.Reason != "ContainerCreating" && w.Reason != "PodInitializing" {
+			problem.Reason, problem.Message = w.Reason, w.Message
+			// A crash loop caused by running out of memory is more useful to report as such.
+			if t := cs.LastTerminationState.Terminated; t != nil && t.Reason == "OOMKilled" {
+				problem.Reason = t.Reason
+			}
+		} else if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+			problem.Reason, problem.Message = t.Reason, t.Message
+		} else if t := cs.LastTerminationState.Terminated; t != nil && t.Reason == "OOMKilled" {
+			problem.Reason = t.Reason
+		} else {
+			continue
+		}
+
+		problem.Explanation = explain(problem.Reason, problem.Message)
+		return problem, true
+	}
+	return Problem{}, false
+}
+
+// Inspect diagnoses a single function.
+func Inspect(ctx context.Context, client dynamic.Interface, kube kubernetes.Interface, namespace, name string) (*Diagnosis, error) {
+	ksvc, err := service.GetKnativeService(ctx, client, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := InspectAll(ctx, client, kube, namespace, []service.KnativeService{*ksvc})
+	if err != nil {
+		return nil, err
+	}
+	d := all[name]
+	return &d, nil
+}
+
+// InspectAll diagnoses every given function of a namespace with one revision and
+// one pod listing.
+func InspectAll(ctx context.Context, client dynamic.Interface, kube kubernetes.Interface, namespace string, ksvcs []service.KnativeService) (map[string]Diagnosis, error) {
+	revisions, err := service.ListRevisions(ctx, client, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	podsByService := map[string][]corev1.Pod{}
+	if kube != nil {
+		pods, err := kube.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: logs.ServiceLabel})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods in namespace %s: %w", namespace, err)
+		}
+		for _, pod := range pods.Items {
+			svc := pod.Labels[logs.ServiceLabel]
+			podsByService[svc] = append(podsByService[svc], pod)
+		}
+	}
+
+	result := make(map[string]Diagnosis, len(ksvcs))
+	for i := range ksvcs {
+		name := ksvcs[i].Metadata.Name
+		result[name] = Diagnose(&ksvcs[i], revisions, podsByService[name])
+	}
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package diagnostics
+
+import (
+	"testing"
+
+	"faas-api/internal/service"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func ksvc(created, ready string, conditions ...service.Condition) *service.KnativeService {
+	svc := &service.KnativeService{}
+	svc.Metadata.Name = "hello"
+	svc.Status.LatestCreatedRevisionName = created
+	svc.Status.LatestReadyRevisionName = ready
+	svc.Status.Conditions = conditions
+	return svc
+}
+
+func userContainerPod(status corev1.ContainerStatus) corev1.Pod {
+	status.Name = "user-container"
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello-00001-deployment-abc"},
+		Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{status}},
+	}
+}
+
+func TestDiagnoseReady(t *testing.T) {
+	d := Diagnose(ksvc("hello-00001", "hello-00001", service.Condition{Type: "Ready", Status: "True"}), nil, nil)
+
+	require.Equal(t, StateReady, d.State)
+	require.Empty(t, d.Problems)
+}
+
+func TestDiagnoseImagePullBackOff(t *testing.T) {
+	svc := ksvc("hello-00001", "",
+		service.Condition{Type: "Ready", Status: "Unknown"},
+		service.Condition{Type: "ConfigurationsReady", Status: "Unknown"},
+	)
+	pod := userContainerPod(corev1.ContainerStatus{
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+	})
+
+	d := Diagnose(svc, nil, []corev1.Pod{pod})
+
+	require.Equal(t, StateFailed, d.State)
+	require.Len(t, d.Problems, 1)
+	require.Equal(t, "pod", d.Problems[0].Source)
+	require.Equal(t, "ImagePullBackOff", d.Problems[0].Reason)
+	require.Equal(t, explanations["ImagePullBackOff"], d.Summary)
+}
+
+func TestDiagnoseOOMKilledCrashLoop(t *testing.T) {
+	pod := userContainerPod(corev1.ContainerStatus{
+		State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+	})
+
+	d := Diagnose(ksvc("hello-00001", "", service.Condition{Type: "Ready", Status: "Unknown"}), nil, []corev1.Pod{pod})
+
+	require.Equal(t, StateFailed, d.State)
+	require.Equal(t, "OOMKilled", d.Problems[0].Reason)
+}
+
+func TestDiagnoseDegradedRevision(t *testing.T) {
+	svc := ksvc("hello-00002", "hello-00001", service.Condition{Type: "Ready", Status: "True"})
+	revisions := map[string]service.Revision{
+		"hello-00002": {
+			Name: "hello-00002",
+			Conditions: []service.Condition{
+				{Type: "Ready", Status: "False", Reason: "ProgressDeadlineExceeded", Message: "timed out"},
+			},
+		},
+	}
+
+	d := Diagnose(svc, revisions, nil)
+
+	require.Equal(t, StateDegraded, d.State)
+	require.Equal(t, "revision", d.Problems[0].Source)
+	require.Equal(t, "timed out", d.Problems[0].Message)
+}
+
+func TestDiagnoseFailedWithUnknownReason(t *testing.T) {
+	svc := ksvc("hello-00001", "",
+		service.Condition{Type: "Ready", Status: "False", Reason: "Custom", Message: "something broke"},
+		service.Condition{Type: "RoutesReady", Status: "False", Reason: "Custom", Message: "something broke"},
+	)
+
+	d := Diagnose(svc, nil, nil)
+
+	require.Equal(t, StateFailed, d.State)
+	require.Equal(t, "something broke", d.Summary)
+}
+
+func TestInspect(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "hello", "namespace": "default"},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True"},
+			},
+		},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		service.RevisionGVR: "RevisionList",
+	}, obj)
+
+	d, err := Inspect(t.Context(), client, fake.NewClientset(), "default", "hello")
+	require.NoError(t, err)
+	require.Equal(t, StateReady, d.State)
+}
@@ -0,0 +1,161 @@
+// Package fake provides in-memory backends for the handlers, to run them without a
+// Docker daemon or a cluster.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"faas-api/internal/function"
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/resource"
+	"faas-api/internal/service"
+	apiv1 "faas-api/pkg/api/v1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var functionResource = schema.GroupResource{Group: "serving.knative.dev", Resource: "services"}
+
+// ImageBuilder records the functions it is asked to build and names their images
+// <Registry>/<name> without building anything.
+type ImageBuilder struct {
+	Registry string
+	// Err, if set, is returned by Build.
+	Err error
+
+	mu    sync.Mutex
+	Built []string
+}
+
+func (b *ImageBuilder) Build(ctx context.Context, f *function.FunctionRequest) (string, error) {
+	if b.Err != nil {
+		return "", b.Err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Built = append(b.Built, f.Name)
+	return fmt.Sprintf("%s/%s", b.Registry, f.Name), nil
+}
+
+// Deployer keeps deployed functions in memory. Every function is ready as soon as it
+// is deployed. List returns all functions of a namespace, sorted by name, and ignores
+// the list options. Like resource.Knative, Get and List redact environment values.
+type Deployer struct {
+	mu        sync.Mutex
+	functions map[string]apiv1.Function
+}
+
+func key(namespace, name string) string { return namespace + "/" + name }
+
+func (d *Deployer) Deploy(ctx context.Context, svc *service.Service) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.functions == nil {
+		d.functions = map[string]apiv1.Function{}
+	}
+	k := key(svc.Namespace, svc.FunctionName)
+	if _, exists := d.functions[k]; exists {
+		return apierrors.NewAlreadyExists(functionResource, svc.FunctionName)
+	}
+
+	fn := apiv1.Function{
+		APIVersion:  apiv1.APIVersion,
+		Kind:        apiv1.KindFunction,
+		Name:        svc.FunctionName,
+		Namespace:   svc.Namespace,
+		Description: svc.Description,
+		Labels:      svc.Labels,
+		Visibility:  svc.Visibility,
+		Runtime:     svc.Runtime,
+		Image:       svc.Image,
+		Status:      apiv1.Status{State: apiv1.StateReady},
+	}
+	for _, e := range svc.Env {
+		fn.Env = append(fn.Env, apiv1.EnvVar{Name: e.Name, Value: e.Value})
+	}
+	d.functions[k] = fn
+	return nil
+}
+
+func (d *Deployer) Get(ctx context.Context, namespace, name string) (*apiv1.Function, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn, ok := d.functions[key(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(functionResource, name)
+	}
+	fn.Env = apiv1.RedactEnv(fn.Env)
+	return &fn, nil
+}
+
+func (d *Deployer) Env(ctx context.Context, namespace, name string) ([]apiv1.EnvVar, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn, ok := d.functions[key(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(functionResource, name)
+	}
+	return fn.Env, nil
+}
+
+func (d *Deployer) List(ctx context.Context, namespace string, opts resource.ListOptions) (*apiv1.FunctionList, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	items := []apiv1.Function{}
+	for _, fn := range d.functions {
+		if fn.Namespace == namespace {
+			fn.Env = apiv1.RedactEnv(fn.Env)
+			items = append(items, fn)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return &apiv1.FunctionList{APIVersion: apiv1.APIVersion, Kind: apiv1.KindList, Items: items}, nil
+}
+
+func (d *Deployer) Delete(ctx context.Context, namespace, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := key(namespace, name)
+	if _, ok := d.functions[k]; !ok {
+		return apierrors.NewNotFound(functionResource, name)
+	}
+	delete(d.functions, k)
+	return nil
+}
+
+// Namespaces gives every owner the namespace named after their subject, see
+// namespace.NameForSubject, and records which namespaces were created and provisioned.
+type Namespaces struct {
+	mu          sync.Mutex
+	Created     map[string]bool
+	Provisioned map[string]bool
+}
+
+func (n *Namespaces) Resolve(ctx context.Context, owner namespace.Owner) (string, error) {
+	return namespace.NameForSubject(owner.Subject), nil
+}
+
+func (n *Namespaces) CreateOrGet(ctx context.Context, owner namespace.Owner) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ns := namespace.NameForSubject(owner.Subject)
+	if n.Created == nil {
+		n.Created = map[string]bool{}
+	}
+	n.Created[ns] = true
+	return ns, nil
+}
+
+func (n *Namespaces) Provision(ctx context.Context, name string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.Provisioned == nil {
+		n.Provisioned = map[string]bool{}
+	}
+	n.Provisioned[name] = true
+	return nil
+}
@@ -3,40 +3,98 @@ package function
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"faas-api/internal/apierror"
+	"faas-api/internal/config"
 	"faas-api/internal/container"
+	"faas-api/internal/logging"
+	"faas-api/internal/metrics"
 	"faas-api/internal/service"
+	"faas-api/internal/tracing"
+	apiv1 "faas-api/pkg/api/v1"
 	"fmt"
 	"io"
-	"os"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
-var DockerClient *client.Client
-
 type EnvVar struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 }
 
+// String hides the value, which may be a credential, from logs.
+func (e EnvVar) String() string { return e.Key + "=" + logging.Redacted }
+
+// LogValue hides the value from the JSON log formatter, which does not call String.
+func (e EnvVar) LogValue() interface{} { return EnvVar{Key: e.Key, Value: logging.Redacted} }
+
 type FunctionRequest struct {
-	Runtime string   `json:"runtime"`
-	Name    string   `json:"name"`
-	EnvVars []EnvVar `json:"env_vars"`
-	File    []byte   `json:"file"` // the binary contents of the uploaded zip file (base64 encoded in JSON)
+	Runtime     string            `json:"runtime"`
+	Name        string            `json:"name"`
+	EnvVars     []EnvVar          `json:"env_vars"`
+	Visibility  string            `json:"visibility"` // "public" (default) or "private"
+	Description string            `json:"description"`
+	Labels      map[string]string `json:"labels"`
+	File        []byte            `json:"file"` // the binary contents of the uploaded zip file (base64 encoded in JSON)
+}
+
+// maxDescriptionLength bounds the description stored as an annotation.
+const maxDescriptionLength = 1024
+
+// DockerBuilder builds function images with a Docker daemon, found through the
+// standard DOCKER_* environment variables, and pushes them to the registry.
+type DockerBuilder struct {
+	client   *client.Client
+	registry config.Registry
+	metrics  *metrics.Metrics
+
+	mu       sync.Mutex
+	loginErr error
+}
+
+// ErrBuild is returned by Build when the daemon reports a failed build step.
+var ErrBuild = apierror.New(apiv1.CodeBuildFailed, "failed to build Docker image")
+
+// ErrPush is returned by Build when the image was built but could not be pushed.
+var ErrPush = apierror.New(apiv1.CodePushFailed, "failed to push Docker image")
+
+// ErrInvalidArchive is returned by Build when the uploaded file is not an archive
+// of a supported format.
+var ErrInvalidArchive = apierror.Field("file", "file must be a zip archive")
+
+// NewDockerBuilder connects to the Docker daemon, waiting up to 30 seconds for it to
+// become available, and logs in to reg. Builds are recorded in m.
+func NewDockerBuilder(reg config.Registry, m *metrics.Metrics) (*DockerBuilder, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	b := &DockerBuilder{client: cli, registry: reg, metrics: m}
+	if err := b.waitForDocker(context.Background(), 30*time.Second); err != nil {
+		return nil, err
+	}
+	return b, nil
 }
 
 // waitForDocker pings the Docker daemon until it becomes available or times out.
-func waitForDocker(ctx context.Context, cli *client.Client, timeout time.Duration) error {
+func (b *DockerBuilder) waitForDocker(ctx context.Context, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 	for {
-		if _, err := cli.Ping(ctx); err == nil {
+		if _, err := b.client.Ping(ctx); err == nil {
 			break
 		}
 		if time.Now().After(deadline) {
@@ -46,73 +104,89 @@ func waitForDocker(ctx context.Context, cli *client.Client, timeout time.Duratio
 		time.Sleep(2 * time.Second)
 	}
 
-	if err := container.Auth(ctx, cli); err != nil {
-		log.WithError(err).WithField("client", cli).Error("failed to login to registry")
+	if err := b.login(ctx); err != nil {
+		log.WithError(err).Error("failed to login to registry")
 	}
 	return nil
 }
 
-func ConfigDockerClient() error {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		log.WithError(err).Error("failed to create docker client")
-	}
-	defer cli.Close()
+func (b *DockerBuilder) login(ctx context.Context) error {
+	err := container.Auth(ctx, b.client, b.registry)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.loginErr = err
+	return err
+}
 
-	ctx := context.Background()
-	// Wait up to 30 seconds for the Docker daemon to become available.
-	if err := waitForDocker(ctx, cli, 30*time.Second); err != nil {
-		log.WithError(err).Error("docker daemon not available")
-		os.Exit(1)
+// Ping checks that the Docker daemon answers.
+func (b *DockerBuilder) Ping(ctx context.Context) error {
+	if _, err := b.client.Ping(ctx); err != nil {
+		return fmt.Errorf("docker daemon is not reachable: %w", err)
 	}
-
-	DockerClient = cli
-
 	return nil
 }
 
-func getEnvironmentVariables() (string, string, string) {
-	username, ok := os.LookupEnv("DOCKER_USERNAME")
-	if !ok {
-		username = ""
-		log.Println("DOCKER_USERNAME not found")
-	}
-	password, ok := os.LookupEnv("DOCKER_PASSWORD")
-	if !ok {
-		password = ""
-		log.Println("DOCKER_PASSWORD not found")
+// CheckRegistry reports whether the daemon is logged in to the registry. A failed
+// login is retried, so that the builder recovers once the registry is back.
+func (b *DockerBuilder) CheckRegistry(ctx context.Context) error {
+	b.mu.Lock()
+	err := b.loginErr
+	b.mu.Unlock()
+	if err == nil {
+		return nil
 	}
-	serverAddress, ok := os.LookupEnv("DOCKER_REGISTRY")
-	if !ok {
-		serverAddress = ""
-		log.Println("DOCKER_REGISTRY not found")
-	}
-
-	// sanitize the values to avoid errors remove \n
-	username = strings.Replace(username, "\n", "", -1)
-	password = strings.Replace(password, "\n", "", -1)
-	serverAddress = strings.Replace(serverAddress, "\n", "", -1)
-
-	return username, password, serverAddress
+	return b.login(ctx)
 }
 
+// Validate checks the fields of f, reporting every invalid one.
 func (f *FunctionRequest) Validate() error {
+	var fields []apiv1.FieldError
+	invalid := func(field, format string, args ...interface{}) {
+		fields = append(fields, apiv1.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
 	if f.Runtime == "" {
-		return fmt.Errorf("runtime is required")
+		invalid("runtime", "runtime is required")
 	}
 	if f.Name == "" {
-		return fmt.Errorf("name is required")
+		invalid("name", "name is required")
+	}
+	if !service.IsValidVisibility(f.Visibility) {
+		invalid("visibility", "visibility must be %q or %q", service.VisibilityPublic, service.VisibilityPrivate)
+	}
+	if len(f.Description) > maxDescriptionLength {
+		invalid("description", "description must be at most %d characters", maxDescriptionLength)
+	}
+	for _, k := range slices.Sorted(maps.Keys(f.Labels)) {
+		v := f.Labels[k]
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			invalid("labels", "invalid label key %q: %s", k, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			invalid("labels", "invalid label value %q for %q: %s", v, k, strings.Join(errs, "; "))
+		}
+		if service.IsReservedLabel(k) {
+			invalid("labels", "label key %q uses a reserved domain", k)
+		}
+	}
+
+	if len(fields) > 0 {
+		return apierror.Invalid(fields...)
 	}
 	return nil
 }
 
-func (f *FunctionRequest) GetTar() ([]byte, error) {
+func (f *FunctionRequest) GetTar(ctx context.Context) ([]byte, error) {
+	_, span := tracing.Start(ctx, "UnknownToTar", attribute.Int("faas.upload.size", len(f.File)))
 	tar, err := UnknownToTar(f.File)
+	tracing.End(span, err)
 	if err != nil {
-		return nil, fmt.Errorf("error converting file to tar: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
 	}
 
+	_, span = tracing.Start(ctx, "InjectDockerfile")
 	tarWithDocker, err := InjectDockerfile(tar)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("error injecting Dockerfile: %w", err)
 	}
@@ -120,17 +194,20 @@ func (f *FunctionRequest) GetTar() ([]byte, error) {
 	return tarWithDocker, nil
 }
 
-func (f *FunctionRequest) BuildDockerImage() (string, error) {
-
-	// login to the registry
-	username, password, serverAddress := getEnvironmentVariables()
+// Build builds the image of f and pushes it to the registry, returning its name.
+func (b *DockerBuilder) Build(ctx context.Context, f *FunctionRequest) (string, error) {
+	defer b.metrics.BuildQueued()()
 
-	log.Printf("Logging in to Docker registry %v, %v, %v", serverAddress, username, password)
+	logger := logging.FromContext(ctx).WithFields(log.Fields{
+		logging.FieldFunction: f.Name,
+		"runtime":             f.Runtime,
+		"image":               b.ImageName(f),
+	})
 
 	authConfig := registry.AuthConfig{
-		Username:      username,
-		Password:      password,
-		ServerAddress: serverAddress,
+		Username:      b.registry.Username,
+		Password:      b.registry.Password.Value(),
+		ServerAddress: b.registry.Address,
 	}
 
 	token, err := registry.EncodeAuthConfig(authConfig)
@@ -138,95 +215,136 @@ func (f *FunctionRequest) BuildDockerImage() (string, error) {
 		return "", fmt.Errorf("failed to encode auth config: %w", err)
 	}
 
-	tar, err := f.GetTar()
+	tar, err := f.GetTar(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	log.Printf("Building Docker image %s", f.GetImageName())
+	logger.Info("building function image")
 
-	buildCtx := bytes.NewReader(tar)
 	buildOptions := types.ImageBuildOptions{
-		Tags:        []string{f.GetImageName()},
+		Tags:        []string{b.ImageName(f)},
 		Remove:      true,
 		ForceRemove: true,
 	}
-	buildResponse, err := DockerClient.ImageBuild(context.Background(), buildCtx, buildOptions)
+	if err := b.build(ctx, f, tar, buildOptions); err != nil {
+		return "", err
+	}
+
+	if inspect, err := b.client.ImageInspect(ctx, b.ImageName(f)); err == nil {
+		b.metrics.ObserveImageSize(f.Runtime, f.Name, inspect.Size)
+	}
+
+	logger.WithField("registry", b.registry.Address).Info("pushing function image")
+	if err := b.push(ctx, f, token); err != nil {
+		return "", err
+	}
+
+	return strings.Join(buildOptions.Tags, ":"), nil
+}
+
+// build runs the Docker build of the context tar.
+func (b *DockerBuilder) build(ctx context.Context, f *FunctionRequest, tar []byte, opts types.ImageBuildOptions) (err error) {
+	ctx, span := tracing.Start(ctx, "ImageBuild",
+		tracing.FunctionKey.String(f.Name), tracing.RuntimeKey.String(f.Runtime), tracing.ImageKey.String(b.ImageName(f)))
+	defer func() { tracing.End(span, err) }()
+
+	buildStart := time.Now()
+	buildResponse, err := b.client.ImageBuild(ctx, bytes.NewReader(tar), opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to build Docker image: %w", err)
+		return fmt.Errorf("failed to build Docker image: %w", err)
 	}
 	defer buildResponse.Body.Close()
 
-	// Read the build response to completion.
-	_, err = io.Copy(os.Stdout, buildResponse.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read build response: %w", err)
+	if err := readMessages(buildResponse.Body, daemonLogger(ctx, f), ErrBuild); err != nil {
+		return err
 	}
+	b.metrics.ObserveBuild(f.Runtime, f.Name, time.Since(buildStart))
+	return nil
+}
+
+// push pushes the image of f with the registry credentials token.
+func (b *DockerBuilder) push(ctx context.Context, f *FunctionRequest, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "ImagePush",
+		tracing.FunctionKey.String(f.Name), tracing.RuntimeKey.String(f.Runtime), tracing.ImageKey.String(b.ImageName(f)))
+	defer func() { tracing.End(span, err) }()
 
 	// push the image to the registry
 	pushOptions := image.PushOptions{
 		RegistryAuth: token,
 	}
-	pushResponse, err := DockerClient.ImagePush(context.Background(),
-		f.GetImageName(),
+	pushStart := time.Now()
+	pushResponse, err := b.client.ImagePush(ctx,
+		b.ImageName(f),
 		pushOptions)
 	if err != nil {
-		return "", fmt.Errorf("failed to push Docker image: %w", err)
+		return fmt.Errorf("%w: %w", ErrPush, err)
 	}
 	defer pushResponse.Close()
 
-	// Read the push response to completion.
-	_, err = io.Copy(os.Stdout, pushResponse)
-	if err != nil {
-		return "", fmt.Errorf("failed to read push response: %w", err)
+	if err := readMessages(pushResponse, daemonLogger(ctx, f), ErrPush); err != nil {
+		return err
 	}
+	b.metrics.ObservePush(f.Runtime, f.Name, time.Since(pushStart))
+	return nil
+}
 
-	// Read the push response to a string.
-	var response bytes.Buffer
-	_, err = io.Copy(&response, pushResponse)
+// daemonLogger returns the logger of the output of the daemon for the build of f,
+// which carries the id of the request.
+func daemonLogger(ctx context.Context, f *FunctionRequest) *log.Entry {
+	return logging.FromContext(ctx).WithFields(log.Fields{
+		logging.FieldFunction: f.Name,
+		"source":              "docker",
+	})
+}
 
-	if err != nil {
-		return "", fmt.Errorf("failed to read push response: %w", err)
-	}
+// readMessages reads the JSON message stream of a build or push to its end, logging
+// the output of the daemon at debug level, without its progress bars. The daemon
+// reports failures in the stream, after answering with a success status, so a
+// message with an error fails with failed.
+func readMessages(r io.Reader, logger *log.Entry, failed error) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read daemon response: %w", err)
+		}
 
-	// Check if the push was successful.
-	if strings.Contains(response.String(), "error") {
-		return "", fmt.Errorf("failed to push Docker image: %w", err)
+		switch {
+		case msg.Error != nil:
+			return fmt.Errorf("%w: %w", failed, msg.Error)
+		case msg.ErrorMessage != "":
+			return fmt.Errorf("%w: %s", failed, msg.ErrorMessage)
+		case strings.TrimSpace(msg.Stream) != "":
+			logger.Debug(strings.TrimRight(msg.Stream, "\n"))
+		case msg.Status != "" && msg.Progress == nil:
+			logger.Debug(msg.Status)
+		}
 	}
-
-	return strings.Join(buildOptions.Tags, ":"), nil
 }
 
-func (f *FunctionRequest) Serve(namespace string) (string, error) {
-
-	image, err := f.BuildDockerImage()
-	if err != nil {
-		return "", fmt.Errorf("failed to build Docker image: %w", err)
+// Service returns the Knative service running image as the function f in namespace.
+func (f *FunctionRequest) Service(namespace, image string) *service.Service {
+	env := make([]service.EnvVar, 0, len(f.EnvVars))
+	for _, e := range f.EnvVars {
+		env = append(env, service.EnvVar{Name: e.Key, Value: e.Value})
 	}
 
-	log.Printf("Deploying service %s", f.Name)
-
-	// deploy the service
-	svc := service.Service{
+	return &service.Service{
 		FunctionName: f.Name,
 		Namespace:    namespace,
 		Image:        image,
+		Visibility:   f.Visibility,
+		Runtime:      f.Runtime,
+		Description:  f.Description,
+		Labels:       f.Labels,
+		Env:          env,
 	}
-
-	deployed, err := svc.Deploy(service.Clientset)
-	if err != nil {
-		return "", fmt.Errorf("failed to deploy service: %w", err)
-	}
-
-	if deployed == nil {
-		return "", fmt.Errorf("failed to deploy service")
-	}
-
-	return fmt.Sprintf("Service %v successfully deployed", f.Name), nil
-
 }
 
-func (f *FunctionRequest) GetImageName() string {
-	username, _, registry := getEnvironmentVariables()
-	return fmt.Sprintf("%s/%s/%s", registry, username, f.Name)
+// ImageName returns the name of the image of f in the registry.
+func (b *DockerBuilder) ImageName(f *FunctionRequest) string {
+	return fmt.Sprintf("%s/%s/%s", b.registry.Address, b.registry.Username, f.Name)
 }
@@ -0,0 +1,126 @@
+package function
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"faas-api/internal/apierror"
+	"faas-api/internal/config"
+	"faas-api/internal/logging"
+	"faas-api/internal/metrics"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBuilder returns a builder whose daemon answers builds with build and pushes
+// with push, as JSON message streams.
+func newTestBuilder(t *testing.T, build, push string) *DockerBuilder {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/build"):
+			_, _ = w.Write([]byte(build))
+		case strings.HasSuffix(r.URL.Path, "/push"):
+			_, _ = w.Write([]byte(push))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+srv.Listener.Addr().String()), client.WithHTTPClient(srv.Client()))
+	require.NoError(t, err)
+	return &DockerBuilder{
+		client:   cli,
+		registry: config.Registry{Address: "registry.example.com", Username: "faas"},
+		metrics:  metrics.New(metrics.Options{}),
+	}
+}
+
+const (
+	buildOutput = `{"stream":"Step 1/2 : FROM golang\n"}` + "\n" + `{"stream":"Successfully built 0123456789ab\n"}` + "\n"
+	pushOutput  = `{"status":"The push refers to repository [registry.example.com/faas/hello]"}` + "\n" +
+		`{"status":"Pushing","progressDetail":{"current":1,"total":2},"id":"0123456789ab"}` + "\n" +
+		`{"status":"latest: digest: sha256:0123 size: 1234"}` + "\n"
+)
+
+func TestBuildAndPush(t *testing.T) {
+	b := newTestBuilder(t, buildOutput, pushOutput)
+	f := &FunctionRequest{Name: "hello", Runtime: "go"}
+
+	require.NoError(t, b.build(t.Context(), f, nil, types.ImageBuildOptions{}))
+	require.NoError(t, b.push(t.Context(), f, ""))
+}
+
+func TestBuildFailsOnErrorMessage(t *testing.T) {
+	b := newTestBuilder(t, `{"stream":"Step 1/2 : RUN go build\n"}`+"\n"+
+		`{"errorDetail":{"code":1,"message":"The command '/bin/sh -c go build' returned a non-zero code: 1"},"error":"The command '/bin/sh -c go build' returned a non-zero code: 1"}`+"\n", pushOutput)
+	f := &FunctionRequest{Name: "hello", Runtime: "go"}
+
+	err := b.build(t.Context(), f, nil, types.ImageBuildOptions{})
+	require.ErrorIs(t, err, ErrBuild)
+	require.ErrorContains(t, err, "returned a non-zero code")
+	require.Equal(t, apiv1.CodeBuildFailed, apierror.From(err).Code)
+}
+
+func TestPushFailsOnErrorMessage(t *testing.T) {
+	b := newTestBuilder(t, buildOutput, `{"status":"The push refers to repository [registry.example.com/faas/hello]"}`+"\n"+
+		`{"errorDetail":{"message":"denied: requested access to the resource is denied"},"error":"denied: requested access to the resource is denied"}`+"\n")
+	f := &FunctionRequest{Name: "hello", Runtime: "go"}
+
+	err := b.push(t.Context(), f, "")
+	require.ErrorIs(t, err, ErrPush)
+	require.Equal(t, apiv1.CodePushFailed, apierror.From(err).Code)
+}
+
+func TestDaemonOutputIsLoggedWithRequestID(t *testing.T) {
+	var logged bytes.Buffer
+	logger := log.StandardLogger()
+	out, formatter, level := logger.Out, logger.Formatter, logger.Level
+	t.Cleanup(func() {
+		logger.SetOutput(out)
+		logger.SetFormatter(formatter)
+		logger.SetLevel(level)
+	})
+	logger.SetOutput(&logged)
+	logger.SetFormatter(&log.JSONFormatter{})
+	logger.SetLevel(log.DebugLevel)
+
+	b := newTestBuilder(t, buildOutput, pushOutput)
+	f := &FunctionRequest{Name: "hello", Runtime: "go"}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.Middleware)
+	router.POST("/functions", func(c *gin.Context) {
+		require.NoError(t, b.build(c, f, nil, types.ImageBuildOptions{}))
+		require.NoError(t, b.push(c, f, ""))
+	})
+	r := httptest.NewRequest(http.MethodPost, "/functions", nil)
+	r.Header.Set(logging.RequestIDHeader, "req-1")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(logged.String()), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		if entry["source"] == "docker" {
+			require.Equal(t, "req-1", entry[logging.FieldRequestID])
+			require.Equal(t, "hello", entry[logging.FieldFunction])
+			msgs = append(msgs, entry["msg"].(string))
+		}
+	}
+	require.Equal(t, []string{
+		"Step 1/2 : FROM golang",
+		"Successfully built 0123456789ab",
+		"The push refers to repository [registry.example.com/faas/hello]",
+		"latest: digest: sha256:0123 size: 1234",
+	}, msgs)
+}
@@ -6,12 +6,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"mime/multipart"
+	"net/http"
 	"time"
 
+	"faas-api/internal/apierror"
+	"faas-api/internal/tracing"
+
 	"github.com/gin-gonic/gin"
 	"github.com/mholt/archives"
 )
@@ -33,36 +37,54 @@ func FormFileToBytes(formFile *multipart.FileHeader) ([]byte, error) {
 
 }
 
-func ProcessRequestData(ctx *gin.Context) (fileBytes []byte, runtime string, name string, envVars []EnvVar, error error) {
+func ProcessRequestData(ctx *gin.Context) (req *FunctionRequest, err error) {
+	_, span := tracing.Start(ctx, "ProcessRequestData")
+	defer func() { tracing.End(span, err) }()
+
 	// Retrieve the uploaded file from the "file" field.
 	fileHeader, err := ctx.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, apierror.Field("file", "file is required")
+	}
 	if err != nil {
-		return nil, "", "", nil, fmt.Errorf("error retrieving file from form: %w", err)
+		return nil, fmt.Errorf("error retrieving file from form: %w", err)
 	}
-	fileBytes, err = FormFileToBytes(fileHeader)
+	fileBytes, err := FormFileToBytes(fileHeader)
 	if err != nil {
-		return nil, "", "", nil, err
+		return nil, err
+	}
+
+	req = &FunctionRequest{
+		File: fileBytes,
+		// Retrieve other form fields.
+		Runtime:     ctx.Request.FormValue("runtime"),
+		Name:        ctx.Request.FormValue("name"),
+		Visibility:  ctx.Request.FormValue("visibility"),
+		Description: ctx.Request.FormValue("description"),
+	}
+
+	// Parse the JSON object of labels.
+	if labelsStr := ctx.Request.FormValue("labels"); labelsStr != "" {
+		if err := json.Unmarshal([]byte(labelsStr), &req.Labels); err != nil {
+			return nil, apierror.Field("labels", "labels must be a JSON object of strings: %v", err)
+		}
 	}
-	// Retrieve other form fields.
-	runtimeField := ctx.Request.FormValue("runtime")
-	nameField := ctx.Request.FormValue("name")
-	envVarsStr := ctx.Request.FormValue("env_vars")
 
 	// Parse the JSON array of environment variables.
-	if envVarsStr != "" {
-		if err := json.Unmarshal([]byte(envVarsStr), &envVars); err != nil {
-			return nil, "", "", nil, fmt.Errorf("error parsing env_vars JSON: %w", err)
+	if envVarsStr := ctx.Request.FormValue("env_vars"); envVarsStr != "" {
+		if err := json.Unmarshal([]byte(envVarsStr), &req.EnvVars); err != nil {
+			return nil, apierror.Field("env_vars", "env_vars must be a JSON array of key and value objects: %v", err)
 		}
 	}
 
-	return fileBytes, runtimeField, nameField, envVars, nil
+	return req, nil
 }
 
 func UnknownToTar(fileBytes []byte) ([]byte, error) {
 	// identify format
 	format, stream, err := archives.Identify(context.TODO(), "user-code", bytes.NewReader(fileBytes))
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to identify the archive format: %w", err)
 	}
 
 	switch format.MediaType() {
@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"faas-api/internal/logging"
+	apiv1 "faas-api/pkg/api/v1"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Headers added to every forwarded request so the function can tell who called it.
+// Incoming values are always discarded to prevent callers from spoofing them.
+const (
+	HeaderCallerUser      = "X-Faas-Caller-User"
+	HeaderCallerProvider  = "X-Faas-Caller-Provider"
+	HeaderCallerNamespace = "X-Faas-Caller-Namespace"
+)
+
+// credentialHeaders carry the caller's platform credentials, which functions never
+// receive: tokens, API keys and the CSRF token of the session.
+var credentialHeaders = []string{"Authorization", "X-API-Key", "X-CSRF-Token"}
+
+const (
+	defaultMaxBodyBytes = 6 << 20 // 6 MiB
+	defaultTimeout      = 30 * time.Second
+)
+
+// Caller identifies the authenticated principal a request is forwarded for.
+type Caller struct {
+	Username  string
+	Provider  string
+	Namespace string
+}
+
+// Gateway forwards authenticated requests to the cluster-local address of a function.
+type Gateway struct {
+	// MaxBodyBytes is the largest request body accepted; larger bodies get a 413.
+	MaxBodyBytes int64
+	// Timeout bounds the whole upstream round trip; slower calls get a 504.
+	Timeout time.Duration
+	// SessionCookie is the platform session cookie, which is never forwarded.
+	SessionCookie string
+	// Transport is used to reach the function. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// New returns a Gateway with the default body limit and timeout.
+func New() *Gateway {
+	return &Gateway{
+		MaxBodyBytes: defaultMaxBodyBytes,
+		Timeout:      defaultTimeout,
+	}
+}
+
+// Forward proxies r to target, replacing the request path with path and adding
+// the caller identity headers. Errors are written to w as problems.
+func (g *Gateway) Forward(w http.ResponseWriter, r *http.Request, target *url.URL, path string, caller Caller) {
+	if r.ContentLength > g.MaxBodyBytes {
+		writeError(w, r, apiv1.CodePayloadTooLarge, "request body too large")
+		return
+	}
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, g.MaxBodyBytes)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), g.Timeout)
+	defer cancel()
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.Out.URL.Path = strings.TrimSuffix(target.Path, "/") + path
+			pr.Out.URL.RawPath = ""
+			pr.SetXForwarded()
+			pr.Out.Header = g.ForwardedHeader(pr.Out.Header, caller)
+		},
+		Transport: g.Transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxBytesErr):
+				writeError(w, r, apiv1.CodePayloadTooLarge, "request body too large")
+			case errors.Is(err, context.DeadlineExceeded):
+				writeError(w, r, apiv1.CodeTimeout, "function did not respond in time")
+			default:
+				log.WithError(err).WithFields(log.Fields{
+					"target":               target.String(),
+					logging.FieldRequestID: r.Header.Get(logging.RequestIDHeader),
+				}).Error("failed to invoke function")
+				writeError(w, r, apiv1.CodeFunctionUnreachable, "failed to reach function")
+			}
+		},
+	}
+
+	proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ForwardedHeader returns the headers of a request to forward to a function for
+// caller: a copy of h without the platform credentials and session cookie, with the
+// caller identity headers. Synchronous and asynchronous invocations both use it.
+func (g *Gateway) ForwardedHeader(h http.Header, caller Caller) http.Header {
+	out := h.Clone()
+	if out == nil {
+		out = http.Header{}
+	}
+	for _, name := range credentialHeaders {
+		out.Del(name)
+	}
+	stripCookie(out, g.SessionCookie)
+
+	out.Set(HeaderCallerUser, caller.Username)
+	out.Set(HeaderCallerProvider, caller.Provider)
+	out.Set(HeaderCallerNamespace, caller.Namespace)
+	return out
+}
+
+// stripCookie removes the named cookie from h, keeping all others.
+func stripCookie(h http.Header, name string) {
+	if name == "" {
+		return
+	}
+	r := &http.Request{Header: h}
+	cookies := r.Cookies()
+	h.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			r.AddCookie(c)
+		}
+	}
+}
+
+// writeError answers r with the problem of code. The gateway writes to the plain
+// ResponseWriter of the proxy, so it cannot use apierror.Abort.
+func writeError(w http.ResponseWriter, r *http.Request, code, detail string) {
+	p := apiv1.NewProblem(code, detail)
+	p.Instance = r.URL.Path
+	p.RequestID = r.Header.Get(logging.RequestIDHeader)
+	w.Header().Set("Content-Type", apiv1.ProblemContentType)
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
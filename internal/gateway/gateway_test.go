@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGateway() *Gateway {
+	return &Gateway{
+		MaxBodyBytes:  16,
+		Timeout:       time.Second,
+		SessionCookie: "auth-session",
+	}
+}
+
+func TestForwardAddsCallerHeaders(t *testing.T) {
+	var got *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/functions/hello/invoke/greet?who=me", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-API-Key", "faas_key_secret")
+	req.Header.Set("X-CSRF-Token", "csrf-secret")
+	req.Header.Set(HeaderCallerUser, "spoofed")
+	req.AddCookie(&http.Cookie{Name: "auth-session", Value: "secret"})
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+	rec := httptest.NewRecorder()
+
+	newTestGateway().Forward(rec, req, target, "/greet", Caller{Username: "jane", Provider: "github", Namespace: "github-jane"})
+
+	require.Equal(t, http.StatusTeapot, rec.Code)
+	require.NotNil(t, got)
+	require.Equal(t, "/greet", got.URL.Path)
+	require.Equal(t, "who=me", got.URL.RawQuery)
+	require.Equal(t, "jane", got.Header.Get(HeaderCallerUser))
+	require.Equal(t, "github", got.Header.Get(HeaderCallerProvider))
+	require.Equal(t, "github-jane", got.Header.Get(HeaderCallerNamespace))
+	require.Empty(t, got.Header.Get("Authorization"), "platform credentials must not be forwarded")
+	require.Empty(t, got.Header.Get("X-API-Key"), "API keys must not be forwarded")
+	require.Empty(t, got.Header.Get("X-CSRF-Token"), "CSRF tokens must not be forwarded")
+	_, err := got.Cookie("auth-session")
+	require.ErrorIs(t, err, http.ErrNoCookie, "session cookie must not be forwarded")
+	theme, err := got.Cookie("theme")
+	require.NoError(t, err)
+	require.Equal(t, "dark", theme.Value)
+}
+
+func TestForwardedHeader(t *testing.T) {
+	in := http.Header{
+		"Authorization":  {"Bearer secret"},
+		"X-Csrf-Token":   {"csrf-secret"},
+		"Cookie":         {"auth-session=secret; theme=dark"},
+		"Content-Type":   {"application/json"},
+		HeaderCallerUser: {"spoofed"},
+	}
+	out := newTestGateway().ForwardedHeader(in, Caller{Username: "jane"})
+
+	require.Equal(t, http.Header{
+		"Content-Type":        {"application/json"},
+		"Cookie":              {"theme=dark"},
+		HeaderCallerUser:      {"jane"},
+		HeaderCallerProvider:  {""},
+		HeaderCallerNamespace: {""},
+	}, out)
+	require.Equal(t, "Bearer secret", in.Get("Authorization"), "the request headers are left alone")
+}
+
+func TestForwardRejectsLargeBody(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 64)))
+	rec := httptest.NewRecorder()
+
+	newTestGateway().Forward(rec, req, target, "/", Caller{})
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestForwardTimesOut(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+
+	gw := newTestGateway()
+	gw.Timeout = 50 * time.Millisecond
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	gw.Forward(rec, req, target, "/", Caller{})
+
+	require.Equal(t, http.StatusGatewayTimeout, rec.Code)
+}
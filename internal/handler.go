@@ -1,106 +1,252 @@
 package handler
 
 import (
+	"errors"
+	"faas-api/internal/apierror"
+	"faas-api/internal/audit"
+	"faas-api/internal/diagnostics"
 	"faas-api/internal/function"
-	"faas-api/internal/k8/namespace"
-	"faas-api/internal/service"
+	"faas-api/internal/logging"
+	"faas-api/internal/metrics"
+	"faas-api/internal/org"
+	"faas-api/internal/resource"
+	"faas-api/internal/tracing"
+	apiv1 "faas-api/pkg/api/v1"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
-func PostFunctionHandler(c *gin.Context) {
+func (p *Platform) PostFunctionHandler(c *gin.Context) {
+	span := tracing.StartHandler(c, "PostFunctionHandler")
+	defer span.End()
 
-	fileBytes, runtime, name, envVars, err := function.ProcessRequestData(c)
+	function, err := function.ProcessRequestData(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to process request data: %v", err)})
+		p.Metrics.Deployed("", metrics.ReasonInvalidRequest)
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInvalidRequest, "failed to process request data"))
 		return
 	}
 
-	function := function.FunctionRequest{
-		Runtime: runtime,
-		Name:    name,
-		EnvVars: envVars,
-		File:    fileBytes,
-	}
+	span.SetAttributes(tracing.FunctionKey.String(function.Name), tracing.RuntimeKey.String(function.Runtime))
 
 	if err := function.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid function request: %v", err)})
+		p.Metrics.Deployed(function.Name, metrics.ReasonInvalidRequest)
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInvalidRequest, "invalid function request"))
 		return
 	}
 
-	username := c.GetString("username")
-	provider := c.GetString("provider")
-	if username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
+	// Deploy to the personal namespace unless the request is scoped to an
+	// organization or the caller is bound to a namespace.
+	var ns string
+	var ok bool
+	if c.GetString("namespace") != "" || c.Query("org") != "" {
+		if ns, ok = p.callerNamespace(c, org.RoleDeveloper); !ok {
+			p.Metrics.Deployed(function.Name, metrics.ReasonNamespace)
+			return
+		}
+		if err := p.Namespaces.Provision(c, ns); err != nil {
+			p.Metrics.Deployed(function.Name, metrics.ReasonNamespace)
+			apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to provision namespace"))
+			return
+		}
+	} else if ns, ok = p.personalNamespace(c); !ok {
+		p.Metrics.Deployed(function.Name, metrics.ReasonNamespace)
 		return
 	}
 
-	namespace, err := namespace.CreateOrGetNamespace(c, service.Clientset, username, provider)
+	span.SetAttributes(tracing.NamespaceKey.String(ns))
+
+	details := audit.From(c)
+	details.Resource = function.Name
+	details.After = map[string]interface{}{
+		"runtime":    function.Runtime,
+		"visibility": function.Visibility,
+		"labels":     function.Labels,
+		"env":        envNames(function.EnvVars),
+	}
+
+	image, err := p.Images.Build(c, function)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to create or get namespace: %v", err)})
+		p.Metrics.Deployed(function.Name, buildFailure(err))
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeBuildFailed, "failed to serve function: failed to build Docker image"))
 		return
 	}
 
-	result, err := function.Serve(namespace)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to serve function: %v", err)})
+	logging.From(c).WithFields(logging.Function(ns, function.Name)).Info("deploying function")
+	if err := p.Functions.Deploy(c, function.Service(ns, image)); err != nil {
+		reason := metrics.ReasonDeploy
+		if apierrors.IsAlreadyExists(err) {
+			reason = metrics.ReasonAlreadyExists
+		}
+		p.Metrics.Deployed(function.Name, reason)
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeDeployFailed, "failed to serve function: failed to deploy service"))
 		return
 	}
+	p.Metrics.Deployed(function.Name, metrics.ReasonNone)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Function deployed successfully",
-		"result":  result,
+		"result":  fmt.Sprintf("Service %v successfully deployed", function.Name),
 	})
 
 }
 
-func GetFunctionHandler(c *gin.Context) {
+// buildFailure returns the metrics reason of a failed image build.
+func buildFailure(err error) string {
+	switch {
+	case errors.Is(err, function.ErrPush):
+		return metrics.ReasonPush
+	case errors.Is(err, function.ErrInvalidArchive):
+		return metrics.ReasonInvalidRequest
+	}
+	return metrics.ReasonBuild
+}
+
+// GetFunctionHandler returns the caller's function. The literal values of its
+// environment variables are redacted unless showEnvValues=true is given, which
+// requires the developer role and is audited.
+func (p *Platform) GetFunctionHandler(c *gin.Context) {
 	functionName := c.Param("name")
 	if functionName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "function name is required"})
+		apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "function name is required"))
 		return
 	}
 
-	// get username from context
-	username := c.GetString("username")
-	provider := c.GetString("provider")
-	if username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
+	showEnvValues := c.Query("showEnvValues") == "true"
+	role := org.RoleViewer
+	if showEnvValues {
+		role = org.RoleDeveloper
+	}
+	ns, ok := p.callerNamespace(c, role)
+	if !ok {
 		return
 	}
 
-	function, err := service.GetKnativeService(service.Clientset, namespace.BuildNameSpaceName(username, provider), functionName)
+	function, err := p.Functions.Get(c, ns, functionName)
+	if err == nil && showEnvValues {
+		function.Env, err = p.Functions.Env(c, ns, functionName)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get function: %v", err)})
+		if apierrors.IsNotFound(err) {
+			apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "function not found"))
+			return
+		}
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to get function"))
 		return
 	}
 
-	if function == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "function not found"})
-		return
+	if showEnvValues {
+		p.Audit.Record(c, audit.Event{
+			Action:   "function.env.reveal",
+			Result:   audit.ResultSuccess,
+			Status:   http.StatusOK,
+			Tenant:   ns,
+			Resource: audit.Resource{Kind: "function", Name: functionName},
+		})
 	}
 	c.JSON(http.StatusOK, function)
 }
 
-func ListFunctionsHandler(c *gin.Context) {
-	// get username from context
-	username := c.GetString("username")
-	provider := c.GetString("provider")
-	if username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
+// ListFunctionsHandler lists the caller's functions. Supported query parameters are
+// labelSelector, status (comma separated states), sort ("name", "updated", prefixed
+// with "-" for descending order), limit and continue.
+func (p *Platform) ListFunctionsHandler(c *gin.Context) {
+	ns, ok := p.callerNamespace(c, org.RoleViewer)
+	if !ok {
 		return
 	}
 
-	functions, err := service.ListKnativeServices(service.Clientset, namespace.BuildNameSpaceName(username, provider))
+	opts := resource.ListOptions{
+		LabelSelector: c.Query("labelSelector"),
+		Sort:          c.Query("sort"),
+		Continue:      c.Query("continue"),
+	}
+	if status := c.Query("status"); status != "" {
+		opts.Status = strings.Split(status, ",")
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "limit must be a number"))
+			return
+		}
+		opts.Limit = n
+	}
+
+	functions, err := p.Functions.List(c, ns, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to list functions: %v", err)})
+		if errors.Is(err, resource.ErrInvalidListOptions) {
+			apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInvalidRequest, ""))
+			return
+		}
+		if apierrors.IsResourceExpired(err) {
+			apierror.Abort(c, apierror.New(apiv1.CodeExpired, "continue token has expired, restart the listing"))
+			return
+		}
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to list functions"))
 		return
 	}
-	if functions == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "no functions found"})
+
+	c.JSON(http.StatusOK, functions)
+}
+
+// DeleteFunctionHandler deletes one of the caller's functions. In an organization
+// this requires the admin role.
+func (p *Platform) DeleteFunctionHandler(c *gin.Context) {
+	functionName := c.Param("name")
+	if functionName == "" {
+		apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "function name is required"))
 		return
 	}
 
-	c.JSON(http.StatusOK, functions)
+	ns, ok := p.callerNamespace(c, org.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	if fn, err := p.Functions.Get(c, ns, functionName); err == nil {
+		audit.From(c).Before = functionSummary(fn)
+	}
+
+	if err := p.Functions.Delete(c, ns, functionName); err != nil {
+		if apierrors.IsNotFound(err) {
+			apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "function not found"))
+			return
+		}
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to delete function"))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetFunctionStatusHandler explains whether the caller's function is healthy and,
+// if not, why.
+func (p *Platform) GetFunctionStatusHandler(c *gin.Context) {
+	functionName := c.Param("name")
+	if functionName == "" {
+		apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "function name is required"))
+		return
+	}
+
+	ns, ok := p.callerNamespace(c, org.RoleViewer)
+	if !ok {
+		return
+	}
+
+	status, err := diagnostics.Inspect(c.Request.Context(), p.Client, p.KubeClient, ns, functionName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "function not found"))
+			return
+		}
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to get function status"))
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
 }
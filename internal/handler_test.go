@@ -0,0 +1,281 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"faas-api/internal/fake"
+	"faas-api/internal/function"
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/metrics"
+	"faas-api/internal/resource"
+	"faas-api/internal/service"
+	"faas-api/internal/tracing"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+const testSubject = "github|42"
+
+// newTestRouter serves the function routes of p for a logged in user.
+func newTestRouter(p *Platform) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(tracing.Middleware, func(c *gin.Context) {
+		c.Set("sub", testSubject)
+		c.Set("username", "jane")
+		c.Set("provider", "github")
+		c.Next()
+	})
+	router.POST("/functions", p.PostFunctionHandler)
+	router.GET("/functions", p.ListFunctionsHandler)
+	router.GET("/functions/:name", p.GetFunctionHandler)
+	router.DELETE("/functions/:name", p.DeleteFunctionHandler)
+	return router
+}
+
+// newKnativePlatform runs the handlers against a fake cluster, with in-memory image
+// builds and namespaces.
+func newKnativePlatform() (*Platform, *fake.ImageBuilder, *fake.Namespaces) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Group: "serving.knative.dev", Version: "v1", Resource: "services"}: "ServiceList",
+		service.RevisionGVR: "RevisionList",
+	})
+	kube := kubefake.NewSimpleClientset()
+	images := &fake.ImageBuilder{Registry: "registry.test/faas"}
+	namespaces := &fake.Namespaces{}
+	return &Platform{
+		Images:     images,
+		Functions:  resource.NewKnative(client, kube),
+		Namespaces: namespaces,
+		Client:     client,
+		KubeClient: kube,
+	}, images, namespaces
+}
+
+func deployRequest(t *testing.T, fields map[string]string) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		require.NoError(t, w.WriteField(k, v))
+	}
+	file, err := w.CreateFormFile("file", "function.zip")
+	require.NoError(t, err)
+	_, err = file.Write([]byte("source"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r := httptest.NewRequest(http.MethodPost, "/functions", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	return r
+}
+
+func serve(router *gin.Engine, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+// problem decodes the problem answered in w.
+func problem(t *testing.T, w *httptest.ResponseRecorder) apiv1.ProblemDetails {
+	t.Helper()
+	require.Equal(t, apiv1.ProblemContentType, w.Header().Get("Content-Type"))
+	var p apiv1.ProblemDetails
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p), w.Body.String())
+	return p
+}
+
+func fieldNames(p apiv1.ProblemDetails) []string {
+	var names []string
+	for _, f := range p.Errors {
+		names = append(names, f.Field)
+	}
+	return names
+}
+
+func TestDeployGetAndListFunctions(t *testing.T) {
+	p, images, namespaces := newKnativePlatform()
+	router := newTestRouter(p)
+	ns := namespace.NameForSubject(testSubject)
+
+	for _, name := range []string{"hello", "bye"} {
+		w := serve(router, deployRequest(t, map[string]string{
+			"name":        name,
+			"runtime":     "nodejs",
+			"visibility":  "private",
+			"description": "says " + name,
+			"labels":      `{"team":"web"}`,
+		}))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	require.Equal(t, []string{"hello", "bye"}, images.Built)
+	require.True(t, namespaces.Created[ns])
+	require.True(t, namespaces.Provisioned[ns], "personal namespaces get the tenant guard rails")
+
+	w := serve(router, httptest.NewRequest(http.MethodGet, "/functions/hello", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var fn apiv1.Function
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fn))
+	require.Equal(t, "hello", fn.Name)
+	require.Equal(t, ns, fn.Namespace)
+	require.Equal(t, "registry.test/faas/hello", fn.Image)
+	require.Equal(t, "nodejs", fn.Runtime)
+	require.Equal(t, service.VisibilityPrivate, fn.Visibility)
+	require.Equal(t, "says hello", fn.Description)
+	require.Equal(t, "web", fn.Labels["team"])
+
+	w = serve(router, httptest.NewRequest(http.MethodGet, "/functions?sort=name", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var list apiv1.FunctionList
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Equal(t, apiv1.KindList, list.Kind)
+	require.Len(t, list.Items, 2)
+	require.Equal(t, "bye", list.Items[0].Name)
+	require.Equal(t, "hello", list.Items[1].Name)
+
+	w = serve(router, httptest.NewRequest(http.MethodGet, "/functions/missing", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, apiv1.CodeNotFound, problem(t, w).Code)
+}
+
+func TestDeployFunctionErrors(t *testing.T) {
+	p, images, _ := newKnativePlatform()
+	p.Metrics = metrics.New(metrics.Options{})
+	router := newTestRouter(p)
+
+	w := serve(router, deployRequest(t, map[string]string{"name": "hello", "visibility": "secret"}))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	invalid := problem(t, w)
+	require.Equal(t, apiv1.CodeValidationFailed, invalid.Code)
+	require.Contains(t, invalid.Detail, "runtime is required")
+	require.Equal(t, []string{"runtime", "visibility"}, fieldNames(invalid), "every invalid field is reported")
+	require.Empty(t, images.Built, "invalid requests are not built")
+
+	images.Err = errors.New("build failed")
+	w = serve(router, deployRequest(t, map[string]string{"name": "hello", "runtime": "go"}))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, apiv1.CodeBuildFailed, problem(t, w).Code)
+	require.Equal(t, "failed to serve function: failed to build Docker image", problem(t, w).Detail,
+		"the causes of server errors are only logged")
+
+	images.Err = fmt.Errorf("%w: denied", function.ErrPush)
+	w = serve(router, deployRequest(t, map[string]string{"name": "hello", "runtime": "go"}))
+	require.Equal(t, http.StatusBadGateway, w.Code)
+	require.Equal(t, apiv1.CodePushFailed, problem(t, w).Code)
+	require.Equal(t, "failed to serve function: failed to build Docker image: failed to push Docker image", problem(t, w).Detail)
+
+	images.Err = fmt.Errorf("%w: unsupported format: text/plain", function.ErrInvalidArchive)
+	w = serve(router, deployRequest(t, map[string]string{"name": "hello", "runtime": "go"}))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, []string{"file"}, fieldNames(problem(t, w)))
+
+	images.Err = nil
+	require.Equal(t, http.StatusOK, serve(router, deployRequest(t, map[string]string{"name": "hello", "runtime": "go"})).Code)
+	w = serve(router, deployRequest(t, map[string]string{"name": "hello", "runtime": "go"}))
+	require.Equal(t, http.StatusConflict, w.Code, "names taken are told apart from failures")
+	require.Equal(t, apiv1.CodeAlreadyExists, problem(t, w).Code)
+
+	w = httptest.NewRecorder()
+	p.Metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Contains(t, w.Body.String(), `faas_deploys_total{reason="invalid_request",result="failure"} 2`)
+	require.Contains(t, w.Body.String(), `faas_deploys_total{reason="build",result="failure"} 1`)
+	require.Contains(t, w.Body.String(), `faas_deploys_total{reason="push",result="failure"} 1`)
+}
+
+func TestDeployIsTraced(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(tracing.NewProvider(sdktrace.NewSimpleSpanProcessor(exporter), 1))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	p, _, _ := newKnativePlatform()
+	r := deployRequest(t, map[string]string{"name": "hello", "runtime": "go"})
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := serve(newTestRouter(p), r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range exporter.GetSpans().Snapshots() {
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		spans[span.Name()] = span
+	}
+	handler := spans["PostFunctionHandler"]
+	require.NotNil(t, handler)
+	require.Equal(t, spans["POST /functions"].SpanContext().SpanID(), handler.Parent().SpanID())
+	for _, name := range []string{"ProcessRequestData", "CreateKnativeService"} {
+		require.Contains(t, spans, name)
+		require.Equal(t, handler.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+	}
+}
+
+func TestFunctionsWithInMemoryDeployer(t *testing.T) {
+	p := &Platform{
+		Images:     &fake.ImageBuilder{Registry: "registry.test"},
+		Functions:  &fake.Deployer{},
+		Namespaces: &fake.Namespaces{},
+	}
+	router := newTestRouter(p)
+
+	w := serve(router, deployRequest(t, map[string]string{"name": "hello", "runtime": "python"}))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = serve(router, httptest.NewRequest(http.MethodGet, "/functions", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var list apiv1.FunctionList
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Items, 1)
+	require.Equal(t, apiv1.StateReady, list.Items[0].Status.State)
+
+	w = serve(router, httptest.NewRequest(http.MethodDelete, "/functions/hello", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = serve(router, httptest.NewRequest(http.MethodDelete, "/functions/hello", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetFunctionRedactsEnv(t *testing.T) {
+	p := &Platform{
+		Images:     &fake.ImageBuilder{Registry: "registry.test"},
+		Functions:  &fake.Deployer{},
+		Namespaces: &fake.Namespaces{},
+	}
+	router := newTestRouter(p)
+	w := serve(router, deployRequest(t, map[string]string{
+		"name":     "hello",
+		"runtime":  "python",
+		"env_vars": `[{"key":"DATABASE_URL","value":"postgres://app:hunter2@db/app"},{"key":"STRIPE_SK","value":"sk_live_1"}]`,
+	}))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	for _, path := range []string{"/functions/hello", "/functions"} {
+		w = serve(router, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NotContains(t, w.Body.String(), "hunter2", path)
+		require.NotContains(t, w.Body.String(), "sk_live_1", path)
+	}
+
+	w = serve(router, httptest.NewRequest(http.MethodGet, "/functions/hello?showEnvValues=true", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var fn apiv1.Function
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fn))
+	require.Equal(t, []apiv1.EnvVar{
+		{Name: "DATABASE_URL", Value: "postgres://app:hunter2@db/app"},
+		{Name: "STRIPE_SK", Value: "sk_live_1"},
+	}, fn.Env)
+}
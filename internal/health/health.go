@@ -0,0 +1,117 @@
+// Package health serves the liveness and readiness probes of the API server.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Check reports whether a component the server depends on works.
+type Check func(ctx context.Context) error
+
+// Status values of the readiness report and its checks.
+const (
+	StatusOK           = "ok"
+	StatusFailed       = "failed"
+	StatusReady        = "ready"
+	StatusNotReady     = "not ready"
+	StatusShuttingDown = "shutting down"
+)
+
+// defaultTimeout bounds each check, so that a hanging dependency fails the probe
+// instead of timing it out.
+const defaultTimeout = 3 * time.Second
+
+// Result is the outcome of one check.
+type Result struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the body of the readiness probe.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Probes runs the registered checks. The server is not ready once shutdown is done,
+// so that it stops receiving traffic while it drains.
+type Probes struct {
+	shutdown context.Context
+	Timeout  time.Duration
+
+	mu     sync.Mutex
+	checks map[string]Check
+}
+
+// New returns probes for a server that shuts down when shutdown is done.
+func New(shutdown context.Context) *Probes {
+	return &Probes{shutdown: shutdown, Timeout: defaultTimeout, checks: map[string]Check{}}
+}
+
+// Add registers a readiness check under name.
+func (p *Probes) Add(name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checks[name] = check
+}
+
+// Check runs every check concurrently and reports the results.
+func (p *Probes) Check(ctx context.Context) Report {
+	p.mu.Lock()
+	checks := make(map[string]Check, len(p.checks))
+	for name, check := range p.checks {
+		checks[name] = check
+	}
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	report := Report{Status: StatusReady, Checks: make(map[string]Result, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := Result{Status: StatusOK}
+			if err := check(ctx); err != nil {
+				result = Result{Status: StatusFailed, Error: err.Error()}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusNotReady
+			}
+		}()
+	}
+	wg.Wait()
+
+	if p.shutdown.Err() != nil {
+		report.Status = StatusShuttingDown
+	}
+	return report
+}
+
+// Live answers the liveness probe. It only tells that the server is serving
+// requests; failing dependencies are reported by Ready.
+func (p *Probes) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": StatusOK})
+}
+
+// Ready answers the readiness probe with the result of every check, with status
+// 503 unless all of them pass and the server is not shutting down.
+func (p *Probes) Ready(c *gin.Context) {
+	report := p.Check(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != StatusReady {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
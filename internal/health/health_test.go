@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, p *Probes, path string) (int, Report) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/livez", p.Live)
+	router.GET("/readyz", p.Ready)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return w.Code, report
+}
+
+func ok(context.Context) error { return nil }
+
+func TestReady(t *testing.T) {
+	p := New(t.Context())
+	p.Add("docker", ok)
+	p.Add("kubernetes", ok)
+
+	status, report := probe(t, p, "/readyz")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, StatusReady, report.Status)
+	require.Equal(t, map[string]Result{
+		"docker":     {Status: StatusOK},
+		"kubernetes": {Status: StatusOK},
+	}, report.Checks)
+}
+
+func TestNotReady(t *testing.T) {
+	p := New(t.Context())
+	p.Timeout = 50 * time.Millisecond
+	p.Add("docker", ok)
+	p.Add("registry", func(context.Context) error { return errors.New("login failed") })
+	p.Add("kubernetes", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	status, report := probe(t, p, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, StatusNotReady, report.Status)
+	require.Equal(t, Result{Status: StatusOK}, report.Checks["docker"])
+	require.Equal(t, Result{Status: StatusFailed, Error: "login failed"}, report.Checks["registry"])
+	require.Equal(t, StatusFailed, report.Checks["kubernetes"].Status, "hanging checks time out")
+
+	// Liveness does not depend on the checks.
+	status, report = probe(t, p, "/livez")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, StatusOK, report.Status)
+}
+
+func TestShuttingDown(t *testing.T) {
+	shutdown, cancel := context.WithCancel(t.Context())
+	p := New(shutdown)
+	p.Add("docker", ok)
+	cancel()
+
+	status, report := probe(t, p, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, StatusShuttingDown, report.Status)
+}
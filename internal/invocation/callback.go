@@ -0,0 +1,103 @@
+package invocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenCallback is returned for callback URLs that point into the cluster or
+// at the host, such as the metadata service, Kubernetes services or the Docker daemon.
+var ErrForbiddenCallback = errors.New("callback url must not point to a private, loopback or link-local address")
+
+// Resolver looks up the addresses of a host. *net.Resolver implements it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, used for pod and service
+// addresses by several Kubernetes distributions.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// ValidateCallbackURL checks that a callback URL is an absolute http(s) URL whose
+// host only resolves to public addresses.
+func (r *Runner) ValidateCallbackURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid callback url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback url must be an absolute http or https url")
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") ||
+		strings.HasSuffix(host, ".svc") || strings.HasSuffix(host, ".internal") {
+		return ErrForbiddenCallback
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !publicAddr(ip) {
+			return ErrForbiddenCallback
+		}
+		return nil
+	}
+
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve callback host: %w", err)
+	}
+	for _, addr := range addrs {
+		ip, ok := netip.AddrFromSlice(addr.IP)
+		if !ok || !publicAddr(ip) {
+			return ErrForbiddenCallback
+		}
+	}
+	return nil
+}
+
+// publicAddr reports whether ip may be called back.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// newCallbackClient returns the client posting callbacks. Its dialer checks the
+// address actually connected to, so that a host resolving to a public address when
+// validated cannot rebind to a private one afterwards. Proxies are not used, as
+// they would hide the address.
+func newCallbackClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("invalid callback address %q: %w", address, err)
+			}
+			if !publicAddr(addrPort.Addr()) {
+				return ErrForbiddenCallback
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// A redirect could point the callback anywhere; its status is reported instead.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
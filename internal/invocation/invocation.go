@@ -0,0 +1,351 @@
+package invocation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"faas-api/internal/apierror"
+	"faas-api/internal/logging"
+	apiv1 "faas-api/pkg/api/v1"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+	defaultTimeout        = 15 * time.Minute
+	defaultMaxResultBytes = 1 << 20 // 1 MiB
+	defaultRetention      = time.Hour
+	defaultWorkers        = 16
+	defaultQueueSize      = 256
+)
+
+// ErrQueueFull is returned by Submit when every worker is busy and the queue of
+// pending invocations is full.
+var ErrQueueFull = apierror.New(apiv1.CodeUnavailable, "too many pending invocations, retry later")
+
+// Request is an invocation accepted by the Runner.
+type Request struct {
+	Namespace string
+	Function  string
+	Target    *url.URL // function address including the path to call
+	Method    string
+	// Header is sent as is, see gateway.Gateway.ForwardedHeader.
+	Header      http.Header
+	Body        []byte
+	CallbackURL string
+}
+
+// Result is the stored response of a finished invocation.
+type Result struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers"`
+	Body       []byte      `json:"body"` // base64 encoded in JSON
+	Truncated  bool        `json:"truncated"`
+}
+
+// Invocation tracks an asynchronous call and its outcome.
+type Invocation struct {
+	ID             string     `json:"id"`
+	Namespace      string     `json:"namespace"`
+	Function       string     `json:"function"`
+	Status         Status     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	Error          string     `json:"error,omitempty"`
+	Result         *Result    `json:"result,omitempty"`
+	CallbackURL    string     `json:"callback_url,omitempty"`
+	CallbackStatus int        `json:"callback_status,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+// Runner performs invocations on a fixed number of workers and keeps their results
+// in memory for the retention period. Results do not survive a restart of the API
+// server.
+type Runner struct {
+	// Client calls the functions at their cluster-local addresses.
+	Client *http.Client
+	// CallbackClient posts to callback URLs, which must be public addresses.
+	CallbackClient *http.Client
+	// Resolver resolves callback hosts, net.DefaultResolver if nil.
+	Resolver       Resolver
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration // per attempt
+	MaxResultBytes int64
+	Retention      time.Duration
+	// Workers is the number of invocations run at once, QueueSize the number of
+	// accepted invocations waiting for a worker.
+	Workers   int
+	QueueSize int
+
+	start sync.Once
+	queue chan job
+
+	mu          sync.RWMutex
+	invocations map[string]*Invocation
+}
+
+type job struct {
+	inv *Invocation
+	req Request
+}
+
+// New returns a Runner with the default retry, timeout and retention settings.
+func New() *Runner {
+	return &Runner{
+		Client:         &http.Client{},
+		CallbackClient: newCallbackClient(),
+		MaxAttempts:    defaultMaxAttempts,
+		InitialBackoff: defaultInitialBackoff,
+		MaxBackoff:     defaultMaxBackoff,
+		Timeout:        defaultTimeout,
+		MaxResultBytes: defaultMaxResultBytes,
+		Retention:      defaultRetention,
+		Workers:        defaultWorkers,
+		QueueSize:      defaultQueueSize,
+		invocations:    map[string]*Invocation{},
+	}
+}
+
+// Submit records the invocation and queues it for a worker. It returns ErrQueueFull
+// rather than waiting when the queue is full.
+func (r *Runner) Submit(req Request) (*Invocation, error) {
+	r.start.Do(r.startWorkers)
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Invocation{
+		ID:          id,
+		Namespace:   req.Namespace,
+		Function:    req.Function,
+		Status:      StatusPending,
+		CallbackURL: req.CallbackURL,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	r.mu.Lock()
+	r.evictExpired()
+	r.invocations[id] = inv
+	snapshot := *inv
+	r.mu.Unlock()
+
+	select {
+	case r.queue <- job{inv: inv, req: req}:
+		return &snapshot, nil
+	default:
+		r.mu.Lock()
+		delete(r.invocations, id)
+		r.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+}
+
+func (r *Runner) startWorkers() {
+	r.queue = make(chan job, r.QueueSize)
+	for i := 0; i < max(r.Workers, 1); i++ {
+		go func() {
+			for j := range r.queue {
+				r.run(j.inv, j.req)
+			}
+		}()
+	}
+}
+
+// Get returns a copy of the invocation with the given id.
+func (r *Runner) Get(id string) (*Invocation, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	inv, ok := r.invocations[id]
+	if !ok {
+		return nil, false
+	}
+	snapshot := *inv
+	return &snapshot, true
+}
+
+func (r *Runner) run(inv *Invocation, req Request) {
+	logger := log.WithFields(logging.Function(req.Namespace, req.Function)).WithField("invocation", inv.ID)
+
+	r.update(inv, func(inv *Invocation) { inv.Status = StatusRunning })
+
+	var (
+		result *Result
+		err    error
+	)
+	for attempt := 1; attempt <= r.MaxAttempts; attempt++ {
+		r.update(inv, func(inv *Invocation) { inv.Attempts = attempt })
+
+		result, err = r.attempt(req)
+		if err == nil && !retryable(result.StatusCode) {
+			break
+		}
+		if attempt < r.MaxAttempts {
+			backoff := r.backoff(attempt)
+			logger.WithError(err).WithField("attempt", attempt).Warnf("invocation failed, retrying in %v", backoff)
+			time.Sleep(backoff)
+		}
+	}
+
+	r.update(inv, func(inv *Invocation) {
+		now := time.Now().UTC()
+		inv.CompletedAt = &now
+		inv.Result = result
+		switch {
+		case err != nil:
+			inv.Status = StatusFailed
+			inv.Error = err.Error()
+		case result.StatusCode >= http.StatusBadRequest:
+			inv.Status = StatusFailed
+			inv.Error = fmt.Sprintf("function responded with status %d", result.StatusCode)
+		default:
+			inv.Status = StatusSucceeded
+		}
+	})
+
+	if req.CallbackURL != "" {
+		r.notify(inv, logger)
+	}
+}
+
+func (r *Runner) attempt(req Request) (*Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	defer cancel()
+
+	out, err := http.NewRequestWithContext(ctx, req.Method, req.Target.String(), bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for k, v := range req.Header {
+		out.Header[k] = v
+	}
+
+	resp, err := r.Client.Do(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call function: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, r.MaxResultBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read function response: %w", err)
+	}
+
+	result := &Result{
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Header,
+		Body:       body,
+	}
+	if int64(len(body)) > r.MaxResultBytes {
+		result.Body = body[:r.MaxResultBytes]
+		result.Truncated = true
+	}
+	return result, nil
+}
+
+// notify posts the finished invocation to its callback URL, retrying like the call itself.
+func (r *Runner) notify(inv *Invocation, logger *log.Entry) {
+	snapshot, _ := r.Get(inv.ID)
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		logger.WithError(err).Error("failed to marshal invocation for callback")
+		return
+	}
+
+	for attempt := 1; attempt <= r.MaxAttempts; attempt++ {
+		status, err := r.postCallback(inv.CallbackURL, payload)
+		if err == nil {
+			r.update(inv, func(inv *Invocation) { inv.CallbackStatus = status })
+			if !retryable(status) {
+				return
+			}
+		}
+		if attempt < r.MaxAttempts {
+			backoff := r.backoff(attempt)
+			logger.WithError(err).WithField("attempt", attempt).Warnf("callback failed, retrying in %v", backoff)
+			time.Sleep(backoff)
+		}
+	}
+	logger.Error("giving up on invocation callback")
+}
+
+func (r *Runner) postCallback(callbackURL string, payload []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.CallbackClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (r *Runner) update(inv *Invocation, fn func(*Invocation)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(inv)
+}
+
+func (r *Runner) backoff(attempt int) time.Duration {
+	d := r.InitialBackoff << (attempt - 1)
+	if d > r.MaxBackoff || d <= 0 {
+		return r.MaxBackoff
+	}
+	return d
+}
+
+// evictExpired drops finished invocations older than the retention period.
+// The caller must hold r.mu.
+func (r *Runner) evictExpired() {
+	cutoff := time.Now().Add(-r.Retention)
+	for id, inv := range r.invocations {
+		if inv.CompletedAt != nil && inv.CompletedAt.Before(cutoff) {
+			delete(r.invocations, id)
+		}
+	}
+}
+
+// retryable reports whether a response status is worth another attempt.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate invocation id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
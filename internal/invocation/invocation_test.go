@@ -0,0 +1,192 @@
+package invocation
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"faas-api/internal/gateway"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRunner() *Runner {
+	return &Runner{
+		Client:         &http.Client{},
+		CallbackClient: &http.Client{}, // the callback servers of the tests listen on loopback
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Timeout:        time.Second,
+		MaxResultBytes: 8,
+		Retention:      time.Hour,
+		Workers:        2,
+		QueueSize:      4,
+		invocations:    map[string]*Invocation{},
+	}
+}
+
+func waitForCompletion(t *testing.T, r *Runner, id string) *Invocation {
+	t.Helper()
+	var inv *Invocation
+	require.Eventually(t, func() bool {
+		inv, _ = r.Get(id)
+		return inv.CompletedAt != nil
+	}, 2*time.Second, 5*time.Millisecond)
+	return inv
+}
+
+func TestRetriesAndStoresTruncatedResult(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Caller", r.Header.Get(gateway.HeaderCallerUser))
+		_, _ = w.Write(append([]byte("echo:"), body...))
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+
+	r := newTestRunner()
+	inv, err := r.Submit(Request{
+		Namespace: "github-jane",
+		Function:  "hello",
+		Target:    target,
+		Method:    http.MethodPost,
+		Header:    gateway.New().ForwardedHeader(http.Header{"Authorization": {"Bearer secret"}}, gateway.Caller{Username: "jane"}),
+		Body:      []byte("payload"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, inv.Status)
+
+	inv = waitForCompletion(t, r, inv.ID)
+	require.Equal(t, StatusSucceeded, inv.Status)
+	require.Equal(t, 3, inv.Attempts)
+	require.Equal(t, http.StatusOK, inv.Result.StatusCode)
+	require.Equal(t, "jane", inv.Result.Headers.Get("X-Caller"))
+	require.Equal(t, "echo:pay", string(inv.Result.Body))
+	require.True(t, inv.Result.Truncated)
+}
+
+func TestFailedInvocationNotifiesCallback(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+
+	received := make(chan Invocation, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var inv Invocation
+		_ = json.NewDecoder(r.Body).Decode(&inv)
+		received <- inv
+	}))
+	defer callback.Close()
+
+	r := newTestRunner()
+	inv, err := r.Submit(Request{Function: "hello", Target: target, Method: http.MethodPost, CallbackURL: callback.URL})
+	require.NoError(t, err)
+
+	select {
+	case got := <-received:
+		require.Equal(t, inv.ID, got.ID)
+		require.Equal(t, StatusFailed, got.Status)
+		require.Equal(t, 3, got.Attempts)
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback was not called")
+	}
+}
+
+// fakeResolver maps hosts to addresses.
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := f[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	r := newTestRunner()
+	r.Resolver = fakeResolver{
+		"example.com":        {"93.184.215.14", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"},
+		"rebind.example.com": {"93.184.215.14", "10.0.0.7"},
+		"metadata.test":      {"169.254.169.254"},
+	}
+	ctx := context.Background()
+
+	require.NoError(t, r.ValidateCallbackURL(ctx, "https://example.com/hook"))
+	require.NoError(t, r.ValidateCallbackURL(ctx, "https://93.184.215.14/hook"))
+	require.Error(t, r.ValidateCallbackURL(ctx, "ftp://example.com/hook"))
+	require.Error(t, r.ValidateCallbackURL(ctx, "/relative"))
+	require.Error(t, r.ValidateCallbackURL(ctx, "https://unknown.test/hook"))
+
+	for _, raw := range []string{
+		"http://127.0.0.1:2375/containers/json",
+		"http://localhost:2375/",
+		"http://[::1]/",
+		"http://0.0.0.0/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://metadata.test/",
+		"http://10.96.0.1/",
+		"http://192.168.1.1/",
+		"http://100.64.0.1/",
+		"http://[fd00::1]/",
+		"http://[::ffff:10.0.0.1]/",
+		"http://kubernetes.default.svc/",
+		"http://faas-api.faas.svc.cluster.local/",
+		"https://rebind.example.com/hook",
+	} {
+		require.ErrorIs(t, r.ValidateCallbackURL(ctx, raw), ErrForbiddenCallback, raw)
+	}
+}
+
+func TestCallbackClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := newCallbackClient().Post(server.URL, "application/json", nil)
+	require.ErrorIs(t, err, ErrForbiddenCallback, "a host rebound to loopback after validation is refused")
+}
+
+func TestSubmitRefusesWhenQueueIsFull(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+	target, _ := url.Parse(upstream.URL)
+
+	r := newTestRunner()
+	r.Workers, r.QueueSize = 1, 1
+	first, err := r.Submit(Request{Function: "hello", Target: target, Method: http.MethodPost})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		inv, _ := r.Get(first.ID)
+		return inv.Status == StatusRunning
+	}, time.Second, time.Millisecond)
+
+	_, err = r.Submit(Request{Function: "hello", Target: target, Method: http.MethodPost})
+	require.NoError(t, err, "one invocation waits in the queue")
+
+	_, err = r.Submit(Request{Function: "hello", Target: target, Method: http.MethodPost})
+	require.ErrorIs(t, err, ErrQueueFull)
+	require.Len(t, r.invocations, 2, "refused invocations are not kept")
+}
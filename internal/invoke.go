@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"errors"
+	"faas-api/internal/apierror"
+	"faas-api/internal/config"
+	"faas-api/internal/gateway"
+	"faas-api/internal/invocation"
+	"faas-api/internal/org"
+	"faas-api/internal/service"
+	apiv1 "faas-api/pkg/api/v1"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// NewGateway returns the gateway forwarding invocations, with the body limit and
+// timeout of cfg.
+func NewGateway(cfg config.Invoke) *gateway.Gateway {
+	g := gateway.New()
+	g.SessionCookie = "auth-session"
+	g.MaxBodyBytes = cfg.MaxBodyBytes
+	g.Timeout = cfg.Timeout.Std()
+	return g
+}
+
+// NewInvocationRunner returns the runner of asynchronous invocations configured by cfg.
+func NewInvocationRunner(cfg config.InvokeAsync) *invocation.Runner {
+	r := invocation.New()
+	r.MaxAttempts = cfg.MaxAttempts
+	r.Timeout = cfg.Timeout.Std()
+	r.MaxResultBytes = cfg.MaxResultBytes
+	r.Retention = cfg.Retention.Std()
+	r.Workers = cfg.Workers
+	r.QueueSize = cfg.QueueSize
+	return r
+}
+
+// functionAddress resolves the cluster-local address of a function and writes an
+// error response if it cannot be reached.
+func (p *Platform) functionAddress(c *gin.Context, ns, functionName string) (*url.URL, bool) {
+	address, err := service.GetFunctionAddress(c.Request.Context(), p.Client, ns, functionName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "function not found"))
+			return nil, false
+		}
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeFunctionUnreachable, "function is not reachable"))
+		return nil, false
+	}
+
+	target, err := url.Parse(address)
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "invalid function address"))
+		return nil, false
+	}
+	return target, true
+}
+
+// InvokeFunctionHandler forwards the request to the cluster-local address of the
+// caller's function, so that private functions can be reached by authenticated users.
+func (p *Platform) InvokeFunctionHandler(c *gin.Context) {
+	functionName := c.Param("name")
+	if functionName == "" {
+		apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "function name is required"))
+		return
+	}
+
+	ns, ok := p.callerNamespace(c, org.RoleViewer)
+	if !ok {
+		return
+	}
+
+	target, ok := p.functionAddress(c, ns, functionName)
+	if !ok {
+		return
+	}
+
+	p.Gateway.Forward(c.Writer, c.Request, target, c.Param("path"), gateway.Caller{
+		Username:  c.GetString("username"),
+		Provider:  c.GetString("provider"),
+		Namespace: ns,
+	})
+}
+
+// InvokeFunctionAsyncHandler accepts an invocation, runs it in the background and
+// returns its id right away. The function path can be set with the "path" query
+// parameter and a callback with the "callback_url" query parameter or X-Callback-Url header.
+func (p *Platform) InvokeFunctionAsyncHandler(c *gin.Context) {
+	functionName := c.Param("name")
+	if functionName == "" {
+		apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "function name is required"))
+		return
+	}
+
+	ns, ok := p.callerNamespace(c, org.RoleViewer)
+	if !ok {
+		return
+	}
+
+	callbackURL := c.Query("callback_url")
+	if callbackURL == "" {
+		callbackURL = c.GetHeader("X-Callback-Url")
+	}
+	if callbackURL != "" {
+		if err := p.Invocations.ValidateCallbackURL(c.Request.Context(), callbackURL); err != nil {
+			apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInvalidRequest, ""))
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, p.Gateway.MaxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			apierror.Abort(c, apierror.New(apiv1.CodePayloadTooLarge, "request body too large"))
+			return
+		}
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInvalidRequest, "failed to read request body"))
+		return
+	}
+
+	target, ok := p.functionAddress(c, ns, functionName)
+	if !ok {
+		return
+	}
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(c.Query("path"), "/")
+
+	header := p.Gateway.ForwardedHeader(c.Request.Header, gateway.Caller{
+		Username:  c.GetString("username"),
+		Provider:  c.GetString("provider"),
+		Namespace: ns,
+	})
+	header.Del("X-Callback-Url")
+
+	inv, err := p.Invocations.Submit(invocation.Request{
+		Namespace:   ns,
+		Function:    functionName,
+		Target:      target,
+		Method:      http.MethodPost,
+		Header:      header,
+		Body:        body,
+		CallbackURL: callbackURL,
+	})
+	if errors.Is(err, invocation.ErrQueueFull) {
+		c.Header("Retry-After", "5")
+		apierror.Abort(c, err)
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to submit invocation"))
+		return
+	}
+
+	location := "/api/invocations/" + inv.ID
+	if slug := c.Query("org"); slug != "" {
+		location += "?org=" + url.QueryEscape(slug)
+	}
+	c.Header("Location", location)
+	c.JSON(http.StatusAccepted, inv)
+}
+
+// GetInvocationHandler returns the status and, once finished, the result of an
+// asynchronous invocation owned by the caller.
+func (p *Platform) GetInvocationHandler(c *gin.Context) {
+	ns, ok := p.callerNamespace(c, org.RoleViewer)
+	if !ok {
+		return
+	}
+
+	inv, found := p.Invocations.Get(c.Param("id"))
+	if !found || inv.Namespace != ns {
+		apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "invocation not found"))
+		return
+	}
+	if scope := c.GetString("apikey_function"); scope != "" && scope != inv.Function {
+		apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "invocation not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, inv)
+}
@@ -0,0 +1,191 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Knative labels and the name of the container that runs the function code.
+const (
+	ServiceLabel  = "serving.knative.dev/service"
+	RevisionLabel = "serving.knative.dev/revision"
+	UserContainer = "user-container"
+)
+
+// Options select which log lines are returned.
+type Options struct {
+	Follow    bool
+	SinceTime *time.Time
+	Tail      *int64 // lines per pod
+	Revision  string
+}
+
+// Line is a single log line of a function pod.
+type Line struct {
+	Time     time.Time `json:"time"`
+	Pod      string    `json:"pod"`
+	Revision string    `json:"revision"`
+	Message  string    `json:"message"`
+}
+
+func (l Line) String() string {
+	return fmt.Sprintf("%s %s/%s %s", l.Time.Format(time.RFC3339Nano), l.Revision, l.Pod, l.Message)
+}
+
+// ErrNoPods is returned when the function has no pods, e.g. because it scaled to zero.
+var ErrNoPods = fmt.Errorf("no pods found for function")
+
+// Stream writes the user container logs of every pod of a function to out. Without
+// Follow the lines of all pods are merged in timestamp order; with Follow they are
+// written as they arrive until ctx is cancelled.
+func Stream(ctx context.Context, client kubernetes.Interface, namespace, function string, opts Options, out func(Line) error) error {
+	selector := labels.Set{ServiceLabel: function}
+	if opts.Revision != "" {
+		selector[RevisionLabel] = opts.Revision
+	}
+
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods of %s/%s: %w", namespace, function, err)
+	}
+	if len(pods.Items) == 0 {
+		return ErrNoPods
+	}
+
+	podOpts := &corev1.PodLogOptions{
+		Container:  UserContainer,
+		Follow:     opts.Follow,
+		Timestamps: true,
+		TailLines:  opts.Tail,
+	}
+	if opts.SinceTime != nil {
+		since := metav1.NewTime(*opts.SinceTime)
+		podOpts.SinceTime = &since
+	}
+
+	if opts.Follow {
+		return follow(ctx, client, pods.Items, podOpts, out)
+	}
+
+	var lines []Line
+	for _, pod := range pods.Items {
+		podLines, err := readPod(ctx, client, pod, podOpts)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, podLines...)
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+	for _, line := range lines {
+		if err := out(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readPod(ctx context.Context, client kubernetes.Interface, pod corev1.Pod, opts *corev1.PodLogOptions) ([]Line, error) {
+	stream, err := client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logs of pod %s: %w", pod.Name, err)
+	}
+	defer stream.Close()
+
+	var lines []Line
+	err = scan(stream, pod, func(l Line) error {
+		lines = append(lines, l)
+		return nil
+	})
+	return lines, err
+}
+
+func follow(ctx context.Context, client kubernetes.Interface, pods []corev1.Pod, opts *corev1.PodLogOptions, out func(Line) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lines := make(chan Line)
+	errs := make(chan error, len(pods))
+	var wg sync.WaitGroup
+
+	for _, pod := range pods {
+		wg.Add(1)
+		go func(pod corev1.Pod) {
+			defer wg.Done()
+			stream, err := client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream(ctx)
+			if err != nil {
+				errs <- fmt.Errorf("failed to follow logs of pod %s: %w", pod.Name, err)
+				return
+			}
+			defer stream.Close()
+			_ = scan(stream, pod, func(l Line) error {
+				select {
+				case lines <- l:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}(pod)
+	}
+
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			if err := out(line); err != nil {
+				return err
+			}
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func scan(r io.Reader, pod corev1.Pod, fn func(Line) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := ParseLine(scanner.Text())
+		line.Pod = pod.Name
+		line.Revision = pod.Labels[RevisionLabel]
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ParseLine splits the RFC3339 timestamp the kubelet prefixes to each line when
+// timestamps are requested. Lines without a timestamp keep a zero Time.
+func ParseLine(raw string) Line {
+	ts, msg, found := strings.Cut(raw, " ")
+	if found {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return Line{Time: t, Message: msg}
+		}
+	}
+	return Line{Message: raw}
+}
@@ -0,0 +1,66 @@
+package logs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func pod(name, service, revision string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "github-jane",
+			Labels: map[string]string{
+				ServiceLabel:  service,
+				RevisionLabel: revision,
+			},
+		},
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	line := ParseLine("2025-05-01T10:00:00.123456789Z hello world")
+	require.Equal(t, "hello world", line.Message)
+	require.Equal(t, time.Date(2025, 5, 1, 10, 0, 0, 123456789, time.UTC), line.Time)
+
+	line = ParseLine("no timestamp here")
+	require.Equal(t, "no timestamp here", line.Message)
+	require.True(t, line.Time.IsZero())
+}
+
+func TestStreamFiltersByRevision(t *testing.T) {
+	client := fake.NewClientset(
+		pod("hello-00001-abc", "hello", "hello-00001"),
+		pod("hello-00002-def", "hello", "hello-00002"),
+		pod("other-00001-ghi", "other", "other-00001"),
+	)
+
+	var lines []Line
+	collect := func(l Line) error {
+		lines = append(lines, l)
+		return nil
+	}
+
+	err := Stream(t.Context(), client, "github-jane", "hello", Options{}, collect)
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+
+	lines = nil
+	err = Stream(t.Context(), client, "github-jane", "hello", Options{Revision: "hello-00002"}, collect)
+	require.NoError(t, err)
+	require.Len(t, lines, 1)
+	require.Equal(t, "hello-00002-def", lines[0].Pod)
+	require.Equal(t, "hello-00002", lines[0].Revision)
+}
+
+func TestStreamWithoutPods(t *testing.T) {
+	client := fake.NewClientset()
+
+	err := Stream(t.Context(), client, "github-jane", "hello", Options{}, func(Line) error { return nil })
+	require.ErrorIs(t, err, ErrNoPods)
+}
@@ -0,0 +1,69 @@
+package namespace
+
+import (
+	"context"
+	"sync"
+
+	"faas-api/internal/tracing"
+
+	"k8s.io/client-go/dynamic"
+)
+
+// Provisioner sets up the guard rails of a tenant namespace, see the tenant package.
+type Provisioner interface {
+	Ensure(ctx context.Context, name string) error
+}
+
+// Manager resolves, creates and provisions the namespaces of owners. It remembers
+// the namespace of each subject, so that the owner lookup only hits the Kubernetes
+// API once per subject.
+type Manager struct {
+	client  dynamic.Interface
+	tenants Provisioner
+	cache   sync.Map
+}
+
+// NewManager returns a Manager for the namespaces of client. tenants may be nil when
+// namespaces need no provisioning.
+func NewManager(client dynamic.Interface, tenants Provisioner) *Manager {
+	return &Manager{client: client, tenants: tenants}
+}
+
+// Resolve returns the name of the owner's namespace without creating it.
+func (m *Manager) Resolve(ctx context.Context, owner Owner) (string, error) {
+	if ns, ok := m.cache.Load(owner.Subject); ok {
+		return ns.(string), nil
+	}
+	ns, err := Resolve(ctx, m.client, owner)
+	if err != nil {
+		return "", err
+	}
+	m.cache.Store(owner.Subject, ns)
+	return ns, nil
+}
+
+// CreateOrGet returns the owner's namespace, creating it if it does not exist yet.
+func (m *Manager) CreateOrGet(ctx context.Context, owner Owner) (ns string, err error) {
+	ctx, span := tracing.Start(ctx, "CreateOrGetNamespace")
+	defer func() {
+		span.SetAttributes(tracing.NamespaceKey.String(ns))
+		tracing.End(span, err)
+	}()
+
+	ns, err = CreateOrGetNamespace(ctx, m.client, owner)
+	if err != nil {
+		return "", err
+	}
+	m.cache.Store(owner.Subject, ns)
+	return ns, nil
+}
+
+// Provision applies the tenant guard rails to the namespace name.
+func (m *Manager) Provision(ctx context.Context, name string) (err error) {
+	if m.tenants == nil {
+		return nil
+	}
+	ctx, span := tracing.Start(ctx, "ProvisionNamespace", tracing.NamespaceKey.String(name))
+	defer func() { tracing.End(span, err) }()
+	return m.tenants.Ensure(ctx, name)
+}
@@ -0,0 +1,113 @@
+package namespace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// Migration assigns a namespace created before namespaces were derived from the
+// subject, named "provider-username", to its owner.
+type Migration struct {
+	Namespace string `json:"namespace"`
+	Subject   string `json:"subject"`
+	Provider  string `json:"provider"`
+}
+
+// LoadMigrations reads a YAML list of migrations from path.
+func LoadMigrations(path string) ([]Migration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read namespace migrations: %w", err)
+	}
+	var migrations []Migration
+	if err := yaml.UnmarshalStrict(data, &migrations); err != nil {
+		return nil, fmt.Errorf("invalid namespace migrations %s: %w", path, err)
+	}
+	for i, m := range migrations {
+		if m.Namespace == "" || m.Subject == "" || m.Provider == "" {
+			return nil, fmt.Errorf("namespace migration %d: namespace, subject and provider are required", i)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrate applies every migration, logging each outcome, and fails if any of them
+// failed.
+func Migrate(ctx context.Context, client dynamic.Interface, migrations []Migration) error {
+	var errs []error
+	for _, m := range migrations {
+		owner := Owner{Subject: m.Subject, Provider: m.Provider}
+		logger := log.WithFields(log.Fields{"namespace": m.Namespace, "subject": m.Subject})
+		if err := MigrateLegacy(ctx, client, m.Namespace, owner); err != nil {
+			logger.WithError(err).Error("failed to migrate legacy namespace")
+			errs = append(errs, err)
+			continue
+		}
+		logger.Info("migrated legacy namespace")
+	}
+	return errors.Join(errs...)
+}
+
+// MigrateLegacy labels the legacy namespace name with owner, so that it keeps being
+// used after the switch to subject based names. Knative Services cannot be moved
+// between namespaces, so they are migrated in place. The owner is never guessed
+// from the name, which was built from a display name users can change: an
+// administrator maps each namespace to its subject. Namespaces owned by anyone,
+// namespaces not named after the owner's provider and owners that already have a
+// namespace are refused. Migrating a namespace again is a no-op.
+func MigrateLegacy(ctx context.Context, client dynamic.Interface, name string, owner Owner) error {
+	ns, err := client.Resource(resource).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting legacy namespace %s: %w", name, err)
+	}
+	nsLabels := ns.GetLabels()
+	if hash, owned := nsLabels[OwnerLabel]; owned {
+		if hash == SubjectHash(owner.Subject) {
+			return nil
+		}
+		return fmt.Errorf("namespace %s is owned by another subject", name)
+	}
+	if _, tenant := nsLabels[TenantLabel]; tenant {
+		return fmt.Errorf("namespace %s is a tenant namespace without owner", name)
+	}
+	if provider := sanitize(owner.Provider); provider == "" || !strings.HasPrefix(name, provider+"-") {
+		return fmt.Errorf("namespace %s is not a legacy namespace of provider %s", name, owner.Provider)
+	}
+	if current, err := lookup(ctx, client, owner); err != nil {
+		return err
+	} else if current != "" {
+		return fmt.Errorf("%s already owns namespace %s", owner.Subject, current)
+	}
+
+	ownerLabels, annotations := ownerMetadata(owner)
+	if nsLabels == nil {
+		nsLabels = map[string]string{}
+	}
+	for k, v := range ownerLabels {
+		nsLabels[k] = v.(string)
+	}
+	ns.SetLabels(nsLabels)
+
+	nsAnnotations := ns.GetAnnotations()
+	if nsAnnotations == nil {
+		nsAnnotations = map[string]string{}
+	}
+	for k, v := range annotations {
+		nsAnnotations[k] = v.(string)
+	}
+	nsAnnotations[MigratedAnnotation] = "true"
+	ns.SetAnnotations(nsAnnotations)
+
+	if _, err := client.Resource(resource).Update(ctx, ns, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("error migrating legacy namespace %s: %w", name, err)
+	}
+	return nil
+}
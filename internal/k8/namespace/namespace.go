@@ -2,40 +2,158 @@ package namespace
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strings"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 )
 
-func GetNamespace(ctx context.Context, client dynamic.Interface, username string, provider string) (string, error) {
-	resource := schema.GroupVersionResource{
-		Version:  "v1",
-		Resource: "namespaces",
+var resource = schema.GroupVersionResource{
+	Version:  "v1",
+	Resource: "namespaces",
+}
+
+// Labels and annotations recording who owns a tenant namespace. The subject itself
+// may contain characters that are not allowed in label values, so it is only stored
+// as an annotation and looked up through its hash. Provider names are valid label
+// values, so the provider is only a label.
+const (
+	TenantLabel        = "faas.dev/tenant"
+	OwnerLabel         = "faas.dev/owner"
+	ProviderLabel      = "faas.dev/owner-provider"
+	SubjectAnnotation  = "faas.dev/owner-subject"
+	NameAnnotation     = "faas.dev/owner-name"
+	MigratedAnnotation = "faas.dev/migrated-from-legacy-name"
+	maxNameLength      = 63
+	hashSuffixLength   = 10
+)
+
+// Owner identifies the user a tenant namespace belongs to.
+type Owner struct {
+	// Subject is the immutable "sub" claim of the identity provider, e.g. "github|12345".
+	Subject string
+	// Provider is the identity provider, e.g. "github".
+	Provider string
+	// DisplayName is the human readable name, which may change and is not unique.
+	DisplayName string
+	// Username is the lowercased display name. It is only shown, never used to find
+	// a namespace, as users can change it.
+	Username string
+}
+
+// NameForSubject derives the namespace name of a subject. The name is a valid
+// DNS-1123 label, and the hash suffix keeps subjects that sanitize to the same text apart.
+func NameForSubject(subject string) string {
+	suffix := SubjectHash(subject)[:hashSuffixLength]
+
+	base := sanitize(subject)
+	if base == "" {
+		base = "tenant"
+	}
+	if max := maxNameLength - len(suffix) - 1; len(base) > max {
+		base = strings.TrimRight(base[:max], "-")
+	}
+	return base + "-" + suffix
+}
+
+// SubjectHash returns the value of OwnerLabel for a subject.
+func SubjectHash(subject string) string {
+	sum := sha256.Sum256([]byte(subject))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// sanitize lowercases s and replaces every run of characters that are not allowed in
+// a DNS-1123 label with a single dash.
+func sanitize(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+func ownerSelector(owner Owner) string {
+	return labels.SelectorFromSet(labels.Set{OwnerLabel: SubjectHash(owner.Subject)}).String()
+}
+
+func ownerMetadata(owner Owner) (map[string]interface{}, map[string]interface{}) {
+	ownerLabels := map[string]interface{}{
+		TenantLabel: "true",
+		OwnerLabel:  SubjectHash(owner.Subject),
+	}
+	if provider := sanitize(owner.Provider); provider != "" && len(provider) <= maxNameLength {
+		ownerLabels[ProviderLabel] = provider
+	}
+	annotations := map[string]interface{}{
+		SubjectAnnotation: owner.Subject,
+		NameAnnotation:    owner.DisplayName,
 	}
+	return ownerLabels, annotations
+}
+
+// Resolve returns the name of the owner's namespace without creating it: the
+// namespace labelled with the owner, or else the name derived from the subject.
+// Namespaces are never matched by name alone, so that a namespace the API did not
+// create for this owner is never used; see MigrateLegacy for older namespaces.
+func Resolve(ctx context.Context, client dynamic.Interface, owner Owner) (string, error) {
+	if owner.Subject == "" {
+		return "", fmt.Errorf("owner subject is required")
+	}
+
+	name, err := lookup(ctx, client, owner)
+	if err != nil || name != "" {
+		return name, err
+	}
+	return NameForSubject(owner.Subject), nil
+}
+
+// lookup returns the namespace labelled with the owner, or "" if there is none.
+func lookup(ctx context.Context, client dynamic.Interface, owner Owner) (string, error) {
+	list, err := client.Resource(resource).List(ctx, metav1.ListOptions{LabelSelector: ownerSelector(owner)})
+	if err != nil {
+		return "", fmt.Errorf("error looking up namespace of %s: %w", owner.Subject, err)
+	}
+	if len(list.Items) == 0 {
+		return "", nil
+	}
+	return list.Items[0].GetName(), nil
+}
 
-	namespace, err := client.Resource(resource).Get(ctx, BuildNameSpaceName(username, provider), metav1.GetOptions{})
+func GetNamespace(ctx context.Context, client dynamic.Interface, name string) (string, error) {
+	namespace, err := client.Resource(resource).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return "", err
 	}
 	return namespace.GetName(), nil
 }
 
-func CreateNamespace(ctx context.Context, client dynamic.Interface, username string, provider string) (string, error) {
-	resource := schema.GroupVersionResource{
-		Version:  "v1",
-		Resource: "namespaces",
-	}
+// CreateNamespace creates a namespace for owner, recording the owner in its labels
+// and annotations.
+func CreateNamespace(ctx context.Context, client dynamic.Interface, name string, owner Owner) (string, error) {
+	ownerLabels, annotations := ownerMetadata(owner)
 
 	namespace := &unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"apiVersion": "v1",
 			"kind":       "Namespace",
 			"metadata": map[string]interface{}{
-				"name": BuildNameSpaceName(username, provider),
+				"name":        name,
+				"labels":      ownerLabels,
+				"annotations": annotations,
 			},
 		},
 	}
@@ -47,27 +165,43 @@ func CreateNamespace(ctx context.Context, client dynamic.Interface, username str
 	return createdNamespace.GetName(), nil
 }
 
-func CreateOrGetNamespace(ctx context.Context, client dynamic.Interface, username string, provider string) (string, error) {
-	namespace, err := GetNamespace(ctx, client, username, provider)
+// CreateOrGetNamespace resolves the owner's namespace and creates it if it does not
+// exist yet. An existing namespace of that name must be labelled with the owner.
+func CreateOrGetNamespace(ctx context.Context, client dynamic.Interface, owner Owner) (string, error) {
+	name, err := Resolve(ctx, client, owner)
 	if err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "not found") {
-			return CreateNamespace(ctx, client, username, provider)
-		}
+		return "", err
+	}
+
+	existing, err := client.Resource(resource).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return checkOwner(existing, owner)
+	}
+	if !apierrors.IsNotFound(err) {
 		return "", fmt.Errorf("error getting namespace: %w", err)
 	}
-	return namespace, nil
-}
 
-func BuildNameSpaceName(username string, provider string) string {
-	return fmt.Sprintf("%s-%s", provider, username)
+	namespace, err := CreateNamespace(ctx, client, name, owner)
+	if apierrors.IsAlreadyExists(err) {
+		// Created by a concurrent request of the owner, or by someone else.
+		existing, err := client.Resource(resource).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("error getting namespace: %w", err)
+		}
+		return checkOwner(existing, owner)
+	}
+	return namespace, err
 }
 
-func DeleteNamespace(ctx context.Context, client dynamic.Interface, username string, provider string) error {
-	resource := schema.GroupVersionResource{
-		Version:  "v1",
-		Resource: "namespaces",
+// checkOwner returns the name of ns if it is labelled with owner. Namespaces of
+// other owners, and namespaces the API did not create, are never used.
+func checkOwner(ns *unstructured.Unstructured, owner Owner) (string, error) {
+	if ns.GetLabels()[OwnerLabel] != SubjectHash(owner.Subject) {
+		return "", fmt.Errorf("namespace %s exists and is not owned by %s", ns.GetName(), owner.Subject)
 	}
+	return ns.GetName(), nil
+}
 
-	name := BuildNameSpaceName(username, provider)
+func DeleteNamespace(ctx context.Context, client dynamic.Interface, name string) error {
 	return client.Resource(resource).Delete(ctx, name, metav1.DeleteOptions{})
 }
@@ -2,11 +2,21 @@ package namespace
 
 import (
 	"flag"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 )
@@ -36,18 +46,185 @@ func clientSetup() {
 	}
 }
 
+func newFakeClient(objects ...runtime.Object) dynamic.Interface {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		resource: "NamespaceList",
+	}, objects...)
+}
+
+func TestNameForSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		prefix  string
+	}{
+		{"github|12345", "github-12345-"},
+		{"auth0|Jane.Doe@Example.com", "auth0-jane-doe-example-com-"},
+		{"oidc|Zoë Ångström", "oidc-zo-ngstr-m-"},
+		{"|||", "tenant-"},
+		{"google-oauth2|" + strings.Repeat("9", 100), "google-oauth2-99"},
+	}
+
+	for _, tt := range tests {
+		name := NameForSubject(tt.subject)
+		require.True(t, strings.HasPrefix(name, tt.prefix), "%q should start with %q", name, tt.prefix)
+		require.Empty(t, validation.IsDNS1123Label(name), "%q must be a valid namespace name", name)
+		require.Equal(t, name, NameForSubject(tt.subject), "names must be deterministic")
+	}
+
+	require.NotEqual(t, NameForSubject("github|a-b"), NameForSubject("github|a.b"), "subjects that sanitize alike must not collide")
+}
+
+func TestCreateOrGetNamespaceRecordsOwner(t *testing.T) {
+	client := newFakeClient()
+	owner := Owner{Subject: "github|12345", Provider: "github", DisplayName: "Jane Doe", Username: "jane doe"}
+
+	name, err := CreateOrGetNamespace(t.Context(), client, owner)
+	require.NoError(t, err)
+	require.Equal(t, NameForSubject(owner.Subject), name)
+
+	ns, err := client.Resource(resource).Get(t.Context(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, SubjectHash(owner.Subject), ns.GetLabels()[OwnerLabel])
+	require.Equal(t, "github", ns.GetLabels()[ProviderLabel])
+	require.Equal(t, "github|12345", ns.GetAnnotations()[SubjectAnnotation])
+	require.Equal(t, "Jane Doe", ns.GetAnnotations()[NameAnnotation])
+
+	// A second user with the same display name gets their own namespace.
+	other := Owner{Subject: "github|67890", Provider: "github", DisplayName: "Jane Doe", Username: "jane doe"}
+	otherName, err := CreateOrGetNamespace(t.Context(), client, other)
+	require.NoError(t, err)
+	require.NotEqual(t, name, otherName)
+}
+
+func TestCreateOrGetNamespaceRace(t *testing.T) {
+	owner := Owner{Subject: "github|12345", Provider: "github"}
+	for _, tt := range []struct {
+		name    string
+		creator Owner
+		wantErr bool
+	}{
+		{"same owner", owner, false},
+		{"other owner", Owner{Subject: "github|67890", Provider: "github"}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeClient()
+			// Another request creates the namespace between the lookup and the create.
+			client.(*dynamicfake.FakeDynamicClient).PrependReactor("create", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				concurrent := newFakeClient()
+				_, err := CreateNamespace(t.Context(), concurrent, NameForSubject(owner.Subject), tt.creator)
+				require.NoError(t, err)
+				ns, err := concurrent.Resource(resource).Get(t.Context(), NameForSubject(owner.Subject), metav1.GetOptions{})
+				require.NoError(t, err)
+				tracker := client.(*dynamicfake.FakeDynamicClient).Tracker()
+				require.NoError(t, tracker.Create(resource, ns, ""))
+				return true, nil, apierrors.NewAlreadyExists(resource.GroupResource(), NameForSubject(owner.Subject))
+			})
+
+			name, err := CreateOrGetNamespace(t.Context(), client, owner)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, NameForSubject(owner.Subject), name)
+		})
+	}
+}
+
+func TestCreateOrGetNamespaceRefusesForeignNamespace(t *testing.T) {
+	owner := Owner{Subject: "github|12345", Provider: "github"}
+	// A namespace the API did not create, with the name derived from the subject.
+	foreign := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]interface{}{"name": NameForSubject(owner.Subject)},
+	}}
+	client := newFakeClient(foreign)
+
+	_, err := CreateOrGetNamespace(t.Context(), client, owner)
+	require.Error(t, err)
+
+	ns, err := client.Resource(resource).Get(t.Context(), NameForSubject(owner.Subject), metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Empty(t, ns.GetLabels(), "namespaces the API did not create are never labelled")
+}
+
+func TestResolveIgnoresLegacyNamespace(t *testing.T) {
+	client := newFakeClient(legacyNamespace("github-jane"))
+	owner := Owner{Subject: "github|12345", Provider: "github", DisplayName: "Jane", Username: "jane"}
+
+	name, err := Resolve(t.Context(), client, owner)
+	require.NoError(t, err)
+	require.Equal(t, NameForSubject(owner.Subject), name, "legacy names are only adopted by MigrateLegacy")
+
+	ns, err := client.Resource(resource).Get(t.Context(), "github-jane", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Empty(t, ns.GetLabels())
+}
+
+func legacyNamespace(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]interface{}{"name": name},
+	}}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	jane := Owner{Subject: "github|12345", Provider: "github"}
+	john := Owner{Subject: "github|67890", Provider: "github"}
+	client := newFakeClient(legacyNamespace("github-jane"), legacyNamespace("github-john"), legacyNamespace("kube-system"))
+
+	require.NoError(t, MigrateLegacy(t.Context(), client, "github-jane", jane))
+	ns, err := client.Resource(resource).Get(t.Context(), "github-jane", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, SubjectHash(jane.Subject), ns.GetLabels()[OwnerLabel])
+	require.Equal(t, "true", ns.GetAnnotations()[MigratedAnnotation])
+
+	name, err := Resolve(t.Context(), client, jane)
+	require.NoError(t, err)
+	require.Equal(t, "github-jane", name, "the migrated namespace is found through its owner label")
+	require.NoError(t, MigrateLegacy(t.Context(), client, "github-jane", jane), "migrating again is a no-op")
+
+	require.Error(t, MigrateLegacy(t.Context(), client, "github-jane", john), "owned by another subject")
+	require.Error(t, MigrateLegacy(t.Context(), client, "github-john", jane), "jane owns a namespace already")
+	require.Error(t, MigrateLegacy(t.Context(), client, "kube-system", john), "not a legacy name of the provider")
+	require.Error(t, MigrateLegacy(t.Context(), client, "github-nobody", john), "does not exist")
+}
+
+func TestLoadMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "migrations.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+- namespace: github-jane
+  subject: github|12345
+  provider: github
+`), 0o600))
+
+	migrations, err := LoadMigrations(path)
+	require.NoError(t, err)
+	require.Equal(t, []Migration{{Namespace: "github-jane", Subject: "github|12345", Provider: "github"}}, migrations)
+
+	require.NoError(t, os.WriteFile(path, []byte("- namespace: github-jane\n"), 0o600))
+	_, err = LoadMigrations(path)
+	require.Error(t, err, "subject and provider are required")
+}
+
 func TestNamespace(t *testing.T) {
 
 	clientSetup()
 
-	username := "testuser"
-	provider := "testprovider"
+	owner := Owner{
+		Subject:     "testprovider|12345",
+		Provider:    "testprovider",
+		DisplayName: "Test User",
+		Username:    "test user",
+	}
 
-	namespace, err := CreateOrGetNamespace(t.Context(), clientset, username, provider)
+	namespace, err := CreateOrGetNamespace(t.Context(), clientset, owner)
 	require.NoError(t, err, "should not return an error when creating namespace")
 	require.NotEmpty(t, namespace, "result should not be empty")
-	require.Equal(t, provider+"-"+username, namespace, "namespace should match the expected format")
+	require.Equal(t, NameForSubject(owner.Subject), namespace, "namespace should match the expected format")
 
-	err = DeleteNamespace(t.Context(), clientset, username, provider)
+	err = DeleteNamespace(t.Context(), clientset, namespace)
 	require.NoError(t, err, "should not return an error when deleting namespace")
 }
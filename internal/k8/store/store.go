@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+)
+
+// SecretGVR is the GroupVersionResource of the Secrets records are stored in.
+var SecretGVR = schema.GroupVersionResource{
+	Version:  "v1",
+	Resource: "secrets",
+}
+
+// Labels set on every record so they can be found again without knowing the Secret name.
+const (
+	KindLabel = "faas.dev/record"
+	IDLabel   = "faas.dev/id"
+)
+
+const dataKey = "record"
+
+// ErrNotFound is returned when a record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// Store persists records of type T as JSON inside Kubernetes Secrets, one Secret per
+// record. The cluster is the only durable storage the platform has, and Secrets are
+// removed together with the tenant namespace that owns them.
+type Store[T any] struct {
+	client dynamic.Interface
+	kind   string
+}
+
+// New returns a Store for records of the given kind, e.g. "api-key".
+func New[T any](client dynamic.Interface, kind string) *Store[T] {
+	return &Store[T]{client: client, kind: kind}
+}
+
+func (s *Store[T]) secretName(id string) string {
+	return fmt.Sprintf("faas-%s-%s", s.kind, id)
+}
+
+// Create stores a new record. Extra labels can be used to filter records with List.
+func (s *Store[T]) Create(ctx context.Context, namespace, id string, extraLabels map[string]string, record *T) error {
+	data, err := encode(record)
+	if err != nil {
+		return err
+	}
+
+	recordLabels := map[string]interface{}{
+		KindLabel: s.kind,
+		IDLabel:   id,
+	}
+	for k, v := range extraLabels {
+		recordLabels[k] = v
+	}
+
+	secret := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"type":       "faas.dev/" + s.kind,
+			"metadata": map[string]interface{}{
+				"name":      s.secretName(id),
+				"namespace": namespace,
+				"labels":    recordLabels,
+			},
+			"data": map[string]interface{}{
+				dataKey: data,
+			},
+		},
+	}
+
+	if _, err := s.client.Resource(SecretGVR).Namespace(namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create %s record %s/%s: %w", s.kind, namespace, id, err)
+	}
+	return nil
+}
+
+// Get loads a record by namespace and id.
+func (s *Store[T]) Get(ctx context.Context, namespace, id string) (*T, error) {
+	secret, err := s.client.Resource(SecretGVR).Namespace(namespace).Get(ctx, s.secretName(id), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get %s record %s/%s: %w", s.kind, namespace, id, err)
+	}
+	return s.decodeSecret(secret)
+}
+
+// Find looks a record up by id across all namespaces and returns it with the
+// namespace it lives in.
+func (s *Store[T]) Find(ctx context.Context, id string) (*T, string, error) {
+	list, err := s.client.Resource(SecretGVR).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{KindLabel: s.kind, IDLabel: id}).String(),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find %s record %s: %w", s.kind, id, err)
+	}
+	if len(list.Items) == 0 {
+		return nil, "", ErrNotFound
+	}
+	if len(list.Items) > 1 {
+		return nil, "", fmt.Errorf("found %d %s records with id %s", len(list.Items), s.kind, id)
+	}
+
+	record, err := s.decodeSecret(&list.Items[0])
+	if err != nil {
+		return nil, "", err
+	}
+	return record, list.Items[0].GetNamespace(), nil
+}
+
+// List returns every record in namespace whose labels match selector.
+func (s *Store[T]) List(ctx context.Context, namespace string, selector map[string]string) ([]T, error) {
+	set := labels.Set{KindLabel: s.kind}
+	for k, v := range selector {
+		set[k] = v
+	}
+
+	list, err := s.client.Resource(SecretGVR).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(set).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s records in %s: %w", s.kind, namespace, err)
+	}
+
+	records := make([]T, 0, len(list.Items))
+	for i := range list.Items {
+		record, err := s.decodeSecret(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	return records, nil
+}
+
+// Update applies mutate to the stored record and stores the result. The Secret is
+// only replaced if it has not changed since it was read; otherwise mutate is applied
+// again to the new contents, so that concurrent updates of other fields are kept.
+// Errors returned by mutate are returned as is, without storing anything.
+func (s *Store[T]) Update(ctx context.Context, namespace, id string, mutate func(*T) error) (*T, error) {
+	secrets := s.client.Resource(SecretGVR).Namespace(namespace)
+
+	var record *T
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := secrets.Get(ctx, s.secretName(id), metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to get %s record %s/%s: %w", s.kind, namespace, id, err)
+		}
+		if record, err = s.decodeSecret(secret); err != nil {
+			return err
+		}
+		if err := mutate(record); err != nil {
+			return err
+		}
+
+		data, err := encode(record)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(secret.Object, data, "data", dataKey); err != nil {
+			return fmt.Errorf("failed to set %s record data: %w", s.kind, err)
+		}
+		// The Secret keeps the resourceVersion it was read with, so the update fails
+		// with a conflict if another one came in between.
+		if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update %s record %s/%s: %w", s.kind, namespace, id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Delete removes a record.
+func (s *Store[T]) Delete(ctx context.Context, namespace, id string) error {
+	err := s.client.Resource(SecretGVR).Namespace(namespace).Delete(ctx, s.secretName(id), metav1.DeleteOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete %s record %s/%s: %w", s.kind, namespace, id, err)
+	}
+	return nil
+}
+
+func (s *Store[T]) decodeSecret(secret *unstructured.Unstructured) (*T, error) {
+	encoded, found, err := unstructured.NestedString(secret.Object, "data", dataKey)
+	if err != nil || !found {
+		return nil, fmt.Errorf("secret %s/%s has no %s record", secret.GetNamespace(), secret.GetName(), s.kind)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s record: %w", s.kind, err)
+	}
+
+	record := new(T)
+	if err := json.Unmarshal(raw, record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s record: %w", s.kind, err)
+	}
+	return record, nil
+}
+
+func encode(record any) (string, error) {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal record: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
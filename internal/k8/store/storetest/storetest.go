@@ -0,0 +1,86 @@
+// Package storetest provides an in-memory cluster for the tests of packages built
+// on store.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"faas-api/internal/k8/store"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// NewClient returns a fake dynamic client able to hold and list records. Like the
+// API server, it refuses updates of Secrets read before their last change.
+func NewClient() *dynamicfake.FakeDynamicClient {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		store.SecretGVR: "SecretList",
+	})
+	client.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured).SetResourceVersion("1")
+		return false, nil, nil
+	})
+	client.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		update := action.(k8stesting.UpdateAction)
+		secret := update.GetObject().(*unstructured.Unstructured)
+		current, err := client.Tracker().Get(store.SecretGVR, update.GetNamespace(), secret.GetName())
+		if err != nil {
+			return false, nil, nil
+		}
+		version := current.(*unstructured.Unstructured).GetResourceVersion()
+		if rv := secret.GetResourceVersion(); rv != "" && rv != version {
+			return true, nil, apierrors.NewConflict(store.SecretGVR.GroupResource(), secret.GetName(), errors.New("the object has been modified"))
+		}
+		n, _ := strconv.Atoi(version)
+		secret.SetResourceVersion(strconv.Itoa(n + 1))
+		return false, nil, nil
+	})
+	return client
+}
+
+// BeforeUpdate returns client running hook once, before its next update of a
+// namespaced resource. The hook may use client, e.g. to change a record between the
+// read and the write of an update.
+func BeforeUpdate(client dynamic.Interface, hook func()) dynamic.Interface {
+	return &hookedClient{Interface: client, hook: hook}
+}
+
+type hookedClient struct {
+	dynamic.Interface
+	hook func()
+}
+
+func (c *hookedClient) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return hookedResource{NamespaceableResourceInterface: c.Interface.Resource(gvr), client: c}
+}
+
+type hookedResource struct {
+	dynamic.NamespaceableResourceInterface
+	client *hookedClient
+}
+
+func (r hookedResource) Namespace(ns string) dynamic.ResourceInterface {
+	return hookedNamespace{ResourceInterface: r.NamespaceableResourceInterface.Namespace(ns), client: r.client}
+}
+
+type hookedNamespace struct {
+	dynamic.ResourceInterface
+	client *hookedClient
+}
+
+func (n hookedNamespace) Update(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if hook := n.client.hook; hook != nil {
+		n.client.hook = nil
+		hook()
+	}
+	return n.ResourceInterface.Update(ctx, obj, opts, subresources...)
+}
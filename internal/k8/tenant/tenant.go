@@ -0,0 +1,366 @@
+// Package tenant provisions the guard rails of tenant namespaces: a ResourceQuota, a
+// LimitRange and NetworkPolicies rendered from an administrator-configured template.
+package tenant
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/service"
+
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// TemplateHashAnnotation records which template a namespace was last provisioned with.
+const TemplateHashAnnotation = "faas.dev/tenant-template-hash"
+
+// Names of the objects created in every tenant namespace.
+const (
+	QuotaName             = "faas-tenant-quota"
+	LimitRangeName        = "faas-tenant-limits"
+	NetworkPolicyName     = "faas-tenant-isolation"
+	managedByLabel        = "app.kubernetes.io/managed-by"
+	managedByValue        = "faas-api"
+	namespaceNameLabelKey = "kubernetes.io/metadata.name"
+)
+
+var (
+	namespaceGVR     = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	quotaGVR         = schema.GroupVersionResource{Version: "v1", Resource: "resourcequotas"}
+	limitRangeGVR    = schema.GroupVersionResource{Version: "v1", Resource: "limitranges"}
+	networkPolicyGVR = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}
+)
+
+// Template describes what every tenant namespace gets. Quantities use the Kubernetes
+// notation, e.g. "500m" or "256Mi".
+type Template struct {
+	ResourceQuota struct {
+		// Hard maps quota resources such as "requests.cpu", "limits.memory" or "pods" to limits.
+		Hard map[string]string `json:"hard"`
+	} `json:"resourceQuota"`
+	LimitRange struct {
+		Default        map[string]string `json:"default"`
+		DefaultRequest map[string]string `json:"defaultRequest"`
+		Max            map[string]string `json:"max"`
+	} `json:"limitRange"`
+	NetworkPolicy struct {
+		Enabled bool `json:"enabled"`
+		// AllowedNamespaces may send traffic to tenant pods besides the tenant itself,
+		// typically the Knative system namespaces and the namespace of the API server.
+		AllowedNamespaces []string `json:"allowedNamespaces"`
+	} `json:"networkPolicy"`
+}
+
+// DefaultTemplate is used when no template file is configured.
+func DefaultTemplate() Template {
+	var t Template
+	t.ResourceQuota.Hard = map[string]string{
+		"requests.cpu":    "2",
+		"requests.memory": "4Gi",
+		"limits.cpu":      "4",
+		"limits.memory":   "8Gi",
+		"pods":            "20",
+	}
+	t.LimitRange.Default = map[string]string{"cpu": "500m", "memory": "256Mi"}
+	t.LimitRange.DefaultRequest = map[string]string{"cpu": "100m", "memory": "128Mi"}
+	t.LimitRange.Max = map[string]string{"cpu": "2", "memory": "2Gi"}
+	t.NetworkPolicy.Enabled = true
+	t.NetworkPolicy.AllowedNamespaces = []string{"knative-serving", "kourier-system", "default"}
+	return t
+}
+
+// LoadTemplate reads a YAML or JSON template. An empty path yields DefaultTemplate.
+func LoadTemplate(path string) (Template, error) {
+	if path == "" {
+		return DefaultTemplate(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Template{}, fmt.Errorf("failed to read tenant template %s: %w", path, err)
+	}
+	var t Template
+	if err := yaml.UnmarshalStrict(data, &t); err != nil {
+		return Template{}, fmt.Errorf("failed to parse tenant template %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Hash identifies the template, so namespaces provisioned with an older one can be found.
+func (t Template) Hash() string {
+	data, _ := json.Marshal(t)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// Provisioner applies the template to tenant namespaces.
+type Provisioner struct {
+	client dynamic.Interface
+	path   string
+
+	mu       sync.RWMutex
+	template Template
+}
+
+func NewProvisioner(client dynamic.Interface, path string) (*Provisioner, error) {
+	t, err := LoadTemplate(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Provisioner{client: client, path: path, template: t}, nil
+}
+
+// Template returns the template currently in use.
+func (p *Provisioner) Template() Template {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.template
+}
+
+// Ensure provisions namespace unless it was already provisioned with the current template.
+func (p *Provisioner) Ensure(ctx context.Context, name string) error {
+	ns, err := p.client.Resource(namespaceGVR).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get namespace %s: %w", name, err)
+	}
+	if ns.GetAnnotations()[TemplateHashAnnotation] == p.Template().Hash() {
+		return nil
+	}
+	return p.apply(ctx, ns)
+}
+
+// ReconcileAll ensures every tenant namespace is provisioned with the current template.
+func (p *Provisioner) ReconcileAll(ctx context.Context) error {
+	list, err := p.list(ctx)
+	if err != nil {
+		return err
+	}
+
+	hash := p.Template().Hash()
+	var failed int
+	for i := range list.Items {
+		ns := &list.Items[i]
+		if ns.GetAnnotations()[TemplateHashAnnotation] == hash {
+			continue
+		}
+		if err := p.apply(ctx, ns); err != nil {
+			log.WithError(err).WithField("namespace", ns.GetName()).Error("failed to reconcile tenant namespace")
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to reconcile %d tenant namespaces", failed)
+	}
+	return nil
+}
+
+// Count returns the number of tenant namespaces and of the functions in them.
+func (p *Provisioner) Count(ctx context.Context) (tenants, functions int, err error) {
+	list, err := p.list(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	names := make(map[string]bool, len(list.Items))
+	for _, ns := range list.Items {
+		names[ns.GetName()] = true
+	}
+	functions, err = service.CountKnativeServices(ctx, p.client, names)
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(names), functions, nil
+}
+
+func (p *Provisioner) list(ctx context.Context) (*unstructured.UnstructuredList, error) {
+	list, err := p.client.Resource(namespaceGVR).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{namespace.TenantLabel: "true"}).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenant namespaces: %w", err)
+	}
+	return list, nil
+}
+
+// Run reconciles all tenant namespaces now and then every interval, reloading the
+// template file first so that changes to it are rolled out without a restart.
+func (p *Provisioner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if t, err := LoadTemplate(p.path); err != nil {
+			log.WithError(err).Error("failed to reload tenant template, keeping the previous one")
+		} else {
+			p.mu.Lock()
+			p.template = t
+			p.mu.Unlock()
+		}
+		if err := p.ReconcileAll(ctx); err != nil {
+			log.WithError(err).Error("tenant reconciliation failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Provisioner) apply(ctx context.Context, ns *unstructured.Unstructured) error {
+	t := p.Template()
+	name := ns.GetName()
+
+	if len(t.ResourceQuota.Hard) > 0 {
+		if err := p.createOrUpdate(ctx, quotaGVR, name, QuotaName, map[string]interface{}{
+			"hard": toInterfaceMap(t.ResourceQuota.Hard),
+		}); err != nil {
+			return err
+		}
+	} else if err := p.deleteIfExists(ctx, quotaGVR, name, QuotaName); err != nil {
+		return err
+	}
+
+	limit := map[string]interface{}{"type": "Container"}
+	for key, values := range map[string]map[string]string{
+		"default":        t.LimitRange.Default,
+		"defaultRequest": t.LimitRange.DefaultRequest,
+		"max":            t.LimitRange.Max,
+	} {
+		if len(values) > 0 {
+			limit[key] = toInterfaceMap(values)
+		}
+	}
+	if len(limit) > 1 {
+		if err := p.createOrUpdate(ctx, limitRangeGVR, name, LimitRangeName, map[string]interface{}{
+			"limits": []interface{}{limit},
+		}); err != nil {
+			return err
+		}
+	} else if err := p.deleteIfExists(ctx, limitRangeGVR, name, LimitRangeName); err != nil {
+		return err
+	}
+
+	if t.NetworkPolicy.Enabled {
+		if err := p.createOrUpdate(ctx, networkPolicyGVR, name, NetworkPolicyName, networkPolicySpec(t.NetworkPolicy.AllowedNamespaces)); err != nil {
+			return err
+		}
+	} else if err := p.deleteIfExists(ctx, networkPolicyGVR, name, NetworkPolicyName); err != nil {
+		return err
+	}
+
+	annotations := ns.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[TemplateHashAnnotation] = t.Hash()
+	ns.SetAnnotations(annotations)
+	if _, err := p.client.Resource(namespaceGVR).Update(ctx, ns, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to annotate namespace %s: %w", name, err)
+	}
+
+	log.WithFields(log.Fields{"namespace": name, "template": t.Hash()}).Info("provisioned tenant namespace")
+	return nil
+}
+
+// networkPolicySpec only admits traffic from the tenant itself and the allowed
+// namespaces, isolating tenants from each other. Egress is left open so functions
+// can call external services.
+func networkPolicySpec(allowed []string) map[string]interface{} {
+	from := []interface{}{
+		map[string]interface{}{"podSelector": map[string]interface{}{}},
+	}
+	if len(allowed) > 0 {
+		values := make([]interface{}, 0, len(allowed))
+		for _, ns := range allowed {
+			values = append(values, ns)
+		}
+		from = append(from, map[string]interface{}{
+			"namespaceSelector": map[string]interface{}{
+				"matchExpressions": []interface{}{
+					map[string]interface{}{
+						"key":      namespaceNameLabelKey,
+						"operator": "In",
+						"values":   values,
+					},
+				},
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"podSelector": map[string]interface{}{},
+		"policyTypes": []interface{}{"Ingress"},
+		"ingress":     []interface{}{map[string]interface{}{"from": from}},
+	}
+}
+
+func (p *Provisioner) createOrUpdate(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string, spec map[string]interface{}) error {
+	resources := p.client.Resource(gvr).Namespace(namespace)
+
+	existing, err := resources.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": gvr.GroupVersion().String(),
+			"kind":       kindOf(gvr),
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+				"labels":    map[string]interface{}{managedByLabel: managedByValue},
+			},
+			"spec": spec,
+		}}
+		if _, err := resources.Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create %s %s/%s: %w", gvr.Resource, namespace, name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get %s %s/%s: %w", gvr.Resource, namespace, name, err)
+	}
+
+	existing.Object["spec"] = spec
+	if _, err := resources.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update %s %s/%s: %w", gvr.Resource, namespace, name, err)
+	}
+	return nil
+}
+
+func (p *Provisioner) deleteIfExists(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) error {
+	err := p.client.Resource(gvr).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s %s/%s: %w", gvr.Resource, namespace, name, err)
+	}
+	return nil
+}
+
+func kindOf(gvr schema.GroupVersionResource) string {
+	switch gvr {
+	case quotaGVR:
+		return "ResourceQuota"
+	case limitRangeGVR:
+		return "LimitRange"
+	default:
+		return "NetworkPolicy"
+	}
+}
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
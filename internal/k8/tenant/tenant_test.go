@@ -0,0 +1,146 @@
+package tenant
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"faas-api/internal/k8/namespace"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newFakeClient(objects ...runtime.Object) dynamic.Interface {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		namespaceGVR:     "NamespaceList",
+		quotaGVR:         "ResourceQuotaList",
+		limitRangeGVR:    "LimitRangeList",
+		networkPolicyGVR: "NetworkPolicyList",
+	}, objects...)
+}
+
+func tenantNamespace(name string, annotations map[string]interface{}) *unstructured.Unstructured {
+	metadata := map[string]interface{}{
+		"name":   name,
+		"labels": map[string]interface{}{namespace.TenantLabel: "true"},
+	}
+	if annotations != nil {
+		metadata["annotations"] = annotations
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   metadata,
+	}}
+}
+
+func writeTemplate(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "tenant-template.yml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestEnsureProvisionsNamespace(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient(tenantNamespace("alice", nil))
+	p, err := NewProvisioner(client, "")
+	require.NoError(t, err)
+
+	require.NoError(t, p.Ensure(ctx, "alice"))
+
+	quota, err := client.Resource(quotaGVR).Namespace("alice").Get(ctx, QuotaName, metav1.GetOptions{})
+	require.NoError(t, err)
+	pods, _, _ := unstructured.NestedString(quota.Object, "spec", "hard", "pods")
+	require.Equal(t, "20", pods)
+
+	limits, err := client.Resource(limitRangeGVR).Namespace("alice").Get(ctx, LimitRangeName, metav1.GetOptions{})
+	require.NoError(t, err)
+	items, _, _ := unstructured.NestedSlice(limits.Object, "spec", "limits")
+	require.Len(t, items, 1)
+	require.Equal(t, "256Mi", items[0].(map[string]interface{})["default"].(map[string]interface{})["memory"])
+
+	policy, err := client.Resource(networkPolicyGVR).Namespace("alice").Get(ctx, NetworkPolicyName, metav1.GetOptions{})
+	require.NoError(t, err)
+	types, _, _ := unstructured.NestedStringSlice(policy.Object, "spec", "policyTypes")
+	require.Equal(t, []string{"Ingress"}, types)
+
+	ns, err := client.Resource(namespaceGVR).Get(ctx, "alice", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, DefaultTemplate().Hash(), ns.GetAnnotations()[TemplateHashAnnotation])
+}
+
+func TestEnsureSkipsUpToDateNamespace(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient(tenantNamespace("alice", map[string]interface{}{
+		TemplateHashAnnotation: DefaultTemplate().Hash(),
+	}))
+	p, err := NewProvisioner(client, "")
+	require.NoError(t, err)
+
+	require.NoError(t, p.Ensure(ctx, "alice"))
+
+	_, err = client.Resource(quotaGVR).Namespace("alice").Get(ctx, QuotaName, metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err))
+}
+
+func TestReconcileAllAppliesChangedTemplate(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient(tenantNamespace("alice", nil), tenantNamespace("bob", nil))
+	p, err := NewProvisioner(client, "")
+	require.NoError(t, err)
+	require.NoError(t, p.ReconcileAll(ctx))
+
+	path := writeTemplate(t, `
+resourceQuota:
+  hard:
+    pods: "5"
+networkPolicy:
+  enabled: false
+`)
+	p.path = path
+	updated, err := LoadTemplate(path)
+	require.NoError(t, err)
+	p.template = updated
+	require.NoError(t, p.ReconcileAll(ctx))
+
+	for _, name := range []string{"alice", "bob"} {
+		quota, err := client.Resource(quotaGVR).Namespace(name).Get(ctx, QuotaName, metav1.GetOptions{})
+		require.NoError(t, err)
+		hard, _, _ := unstructured.NestedStringMap(quota.Object, "spec", "hard")
+		require.Equal(t, map[string]string{"pods": "5"}, hard)
+
+		_, err = client.Resource(limitRangeGVR).Namespace(name).Get(ctx, LimitRangeName, metav1.GetOptions{})
+		require.True(t, apierrors.IsNotFound(err))
+		_, err = client.Resource(networkPolicyGVR).Namespace(name).Get(ctx, NetworkPolicyName, metav1.GetOptions{})
+		require.True(t, apierrors.IsNotFound(err))
+
+		ns, err := client.Resource(namespaceGVR).Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, updated.Hash(), ns.GetAnnotations()[TemplateHashAnnotation])
+	}
+}
+
+func TestLoadTemplateRejectsUnknownFields(t *testing.T) {
+	_, err := LoadTemplate(writeTemplate(t, "resourceQuotas:\n  hard: {}\n"))
+	require.Error(t, err)
+}
+
+func TestNetworkPolicyAllowsSystemNamespaces(t *testing.T) {
+	spec := networkPolicySpec([]string{"knative-serving", "kourier-system"})
+	ingress := spec["ingress"].([]interface{})
+	from := ingress[0].(map[string]interface{})["from"].([]interface{})
+	require.Len(t, from, 2)
+
+	selector := from[1].(map[string]interface{})["namespaceSelector"].(map[string]interface{})
+	expr := selector["matchExpressions"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, namespaceNameLabelKey, expr["key"])
+	require.Equal(t, []interface{}{"knative-serving", "kourier-system"}, expr["values"])
+}
@@ -0,0 +1,137 @@
+// Package logging sets up the structured logs of the API server. Each request gets
+// an id, echoed in the X-Request-ID header, that its log entries and audit events
+// carry, and every entry goes through a Redactor so that credentials do not reach
+// the logs.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"time"
+
+	"faas-api/internal/config"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the id of a request, set by the caller or generated.
+const RequestIDHeader = "X-Request-ID"
+
+// Field names used across the server's log entries.
+const (
+	FieldRequestID = "request_id"
+	FieldTraceID   = "trace_id"
+	FieldSubject   = "subject"
+	FieldNamespace = "namespace"
+	FieldFunction  = "function"
+)
+
+// requestIDKey stores the request id in the gin.Context.
+const requestIDKey = "request_id"
+
+// validRequestID bounds the ids accepted from callers, which end up in logs and
+// audit events.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Setup configures the standard logger with cfg, redacting the given secrets along
+// with anything that looks like a credential.
+func Setup(cfg config.Logging, secrets ...string) error {
+	level, err := log.ParseLevel(cfg.Level)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	var formatter log.Formatter = &log.JSONFormatter{DisableHTMLEscape: true}
+	if cfg.Format == "text" {
+		formatter = &log.TextFormatter{FullTimestamp: true}
+	}
+	log.SetLevel(level)
+	log.SetFormatter(NewRedactor(formatter, secrets...))
+	return nil
+}
+
+// AddSecrets registers secrets known after Setup, such as those of the identity
+// providers, with the Redactor of the standard logger.
+func AddSecrets(secrets ...string) {
+	if r, ok := log.StandardLogger().Formatter.(*Redactor); ok {
+		r.AddSecrets(secrets...)
+	}
+}
+
+// Function returns the fields identifying a function and its tenant namespace.
+func Function(namespace, name string) log.Fields {
+	return log.Fields{FieldNamespace: namespace, FieldFunction: name}
+}
+
+// From returns the logger of the request of c, with its id and, once authenticated,
+// its subject.
+func From(c *gin.Context) *log.Entry {
+	entry := log.WithField(FieldRequestID, c.GetString(requestIDKey))
+	if sub := c.GetString("sub"); sub != "" {
+		entry = entry.WithField(FieldSubject, sub)
+	}
+	return entry
+}
+
+// RequestID returns the id Middleware assigned to the request of c: the caller's
+// if well formed, a generated one otherwise.
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// FromContext returns the logger of the request ctx derives from, or the standard
+// logger outside of requests.
+func FromContext(ctx context.Context) *log.Entry {
+	if c, ok := ctx.Value(gin.ContextKey).(*gin.Context); ok {
+		return From(c)
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// Middleware assigns the request its id and logs it once it is served. The id sent
+// by the caller is kept when it is well formed.
+func Middleware(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = newRequestID()
+	}
+	c.Set(requestIDKey, id)
+	c.Request.Header.Set(RequestIDHeader, id)
+	c.Header(RequestIDHeader, id)
+
+	start := time.Now()
+	c.Next()
+
+	status := c.Writer.Status()
+	entry := From(c).WithFields(log.Fields{
+		"method":     c.Request.Method,
+		"route":      c.FullPath(),
+		"path":       c.Request.URL.Path,
+		"status":     status,
+		"latency_ms": time.Since(start).Milliseconds(),
+		"client_ip":  c.ClientIP(),
+	})
+	if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+		entry = entry.WithField(FieldTraceID, span.TraceID().String())
+	}
+	if len(c.Errors) > 0 {
+		entry = entry.WithField("errors", c.Errors.String())
+	}
+	if status >= 500 {
+		entry.Error("request failed")
+		return
+	}
+	entry.Info("request served")
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Redacted replaces the secrets removed from log entries.
+const Redacted = "<redacted>"
+
+// sensitiveKeys are the parts of field names whose values are never logged. Fields
+// ending in _id, such as token_id, name a credential without revealing it.
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "authorization", "cookie", "credential", "apikey", "api_key"}
+
+// envKeys are the fields holding environment variables of functions.
+var envKeys = map[string]bool{"env": true, "env_vars": true, "envvars": true}
+
+// secretPatterns match credentials wherever they appear in an entry, such as in an
+// error message or a URL, and the replacement keeping their context.
+var secretPatterns = []struct {
+	re      *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 " + Redacted},
+	{regexp.MustCompile(`\bfaas_(ak|pat)_[A-Za-z0-9_-]+`), "faas_${1}_" + Redacted},
+	{regexp.MustCompile(`(?i)\b([a-z_]*(?:password|passwd|secret|token|apikey|api_key)=)[^\s&"',]+`), "${1}" + Redacted},
+	// Credentials in JSON, such as token responses quoted in errors.
+	{regexp.MustCompile(`(?i)((?:password|secret|token)\\?"\s*:\s*\\?")[^"\\]+`), "${1}" + Redacted},
+	// Cookie headers, such as in the request dumps of recovered panics. JSON output
+	// escapes their line breaks.
+	{regexp.MustCompile(`(?i)((?:set-)?cookie:\s*)[^\r\n\\"]+`), "${1}" + Redacted},
+	// JSON Web Tokens, such as machine identity tokens.
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), Redacted},
+}
+
+// minSecretLength keeps short values, which would mask unrelated text, from being
+// registered as secrets.
+const minSecretLength = 4
+
+// Valuer is implemented by values holding credentials, such as the environment of
+// functions. Redactor logs their LogValue in their place, so that they keep their
+// own encoding everywhere else.
+type Valuer interface {
+	LogValue() interface{}
+}
+
+// Redactor is a log.Formatter masking credentials before Formatter formats entries:
+// the values of sensitive fields, known secret values and text that looks like a
+// credential.
+type Redactor struct {
+	Formatter log.Formatter
+
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// NewRedactor returns a Redactor for formatter that also masks secrets.
+func NewRedactor(formatter log.Formatter, secrets ...string) *Redactor {
+	r := &Redactor{Formatter: formatter}
+	r.AddSecrets(secrets...)
+	return r
+}
+
+// AddSecrets registers values to mask wherever they appear.
+func (r *Redactor) AddSecrets(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range secrets {
+		if len(s) >= minSecretLength {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+}
+
+// Format formats a copy of entry with its sensitive fields masked and its Valuers
+// replaced, then masks the secrets left in the output.
+func (r *Redactor) Format(entry *log.Entry) ([]byte, error) {
+	data := make(log.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		if sensitiveKey(k) {
+			v = Redacted
+		}
+		data[k] = logValue(v)
+	}
+	redacted := *entry
+	redacted.Data = data
+
+	out, err := r.Formatter.Format(&redacted)
+	if err != nil {
+		return nil, err
+	}
+	return r.Redact(out), nil
+}
+
+// Redact masks the secrets in b.
+func (r *Redactor) Redact(b []byte) []byte {
+	r.mu.RLock()
+	for _, s := range r.secrets {
+		b = bytes.ReplaceAll(b, []byte(s), []byte(Redacted))
+	}
+	r.mu.RUnlock()
+	for _, p := range secretPatterns {
+		b = p.re.ReplaceAll(b, []byte(p.replace))
+	}
+	return b
+}
+
+// logValue returns the LogValue of v if it is a Valuer, or the LogValues of its
+// elements if it is a slice of Valuers.
+func logValue(v interface{}) interface{} {
+	if lv, ok := v.(Valuer); ok {
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return v
+		}
+		return lv.LogValue()
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || !rv.Type().Elem().Implements(reflect.TypeOf((*Valuer)(nil)).Elem()) {
+		return v
+	}
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = logValue(rv.Index(i).Interface())
+	}
+	return values
+}
+
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if envKeys[key] {
+		return true
+	}
+	if strings.HasSuffix(key, "_id") {
+		return false
+	}
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"faas-api/internal/apierror"
+	"faas-api/internal/k8/logs"
+	"faas-api/internal/logging"
+	"faas-api/internal/org"
+	apiv1 "faas-api/pkg/api/v1"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetFunctionLogsHandler streams the logs of the caller's function. Supported query
+// parameters are follow (bool), since (duration such as "10m" or an RFC3339 time),
+// tail (lines per pod), revision and format ("text" or "json" for JSON lines).
+func (p *Platform) GetFunctionLogsHandler(c *gin.Context) {
+	functionName := c.Param("name")
+	if functionName == "" {
+		apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "function name is required"))
+		return
+	}
+
+	ns, ok := p.callerNamespace(c, org.RoleViewer)
+	if !ok {
+		return
+	}
+
+	opts, err := parseLogOptions(c)
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInvalidRequest, ""))
+		return
+	}
+
+	asJSON := c.Query("format") == "json"
+	if asJSON {
+		c.Header("Content-Type", "application/x-ndjson")
+	} else {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	wroteHeader := false
+	err = logs.Stream(c.Request.Context(), p.KubeClient, ns, functionName, opts, func(line logs.Line) error {
+		if !wroteHeader {
+			c.Status(http.StatusOK)
+			wroteHeader = true
+		}
+		if asJSON {
+			if err := json.NewEncoder(c.Writer).Encode(line); err != nil {
+				return err
+			}
+		} else if _, err := fmt.Fprintln(c.Writer, line.String()); err != nil {
+			return err
+		}
+		if opts.Follow {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+
+	if err != nil && !wroteHeader {
+		if errors.Is(err, logs.ErrNoPods) {
+			apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "no running pods found for function, it may have scaled to zero"))
+			return
+		}
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to get logs"))
+		return
+	}
+	if err != nil {
+		logging.From(c).WithFields(logging.Function(ns, functionName)).WithError(err).Warn("log stream ended with an error")
+	}
+	if !wroteHeader {
+		c.Status(http.StatusOK)
+	}
+}
+
+func parseLogOptions(c *gin.Context) (logs.Options, error) {
+	opts := logs.Options{Revision: c.Query("revision")}
+
+	if v := c.Query("follow"); v != "" {
+		follow, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("follow must be a boolean")
+		}
+		opts.Follow = follow
+	}
+
+	if v := c.Query("since"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			since := time.Now().Add(-d)
+			opts.SinceTime = &since
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			opts.SinceTime = &t
+		} else {
+			return opts, fmt.Errorf("since must be a duration such as 10m or an RFC3339 time")
+		}
+	}
+
+	if v := c.Query("tail"); v != "" {
+		tail, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || tail < 0 {
+			return opts, fmt.Errorf("tail must be a non-negative number")
+		}
+		opts.Tail = &tail
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,281 @@
+// Package metrics exposes Prometheus metrics of the API, image builds and deploys.
+// Label values come from bounded sets: routes are the registered path templates,
+// runtimes outside the configured list are reported as "other", and function names
+// are only used as labels when the administrator opts in.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+const namespace = "faas"
+
+// Reasons a deploy fails, the values of the reason label of faas_deploys_total.
+const (
+	ReasonNone           = "none"
+	ReasonInvalidRequest = "invalid_request"
+	ReasonNamespace      = "namespace"
+	ReasonBuild          = "build"
+	ReasonPush           = "push"
+	ReasonAlreadyExists  = "already_exists"
+	ReasonDeploy         = "deploy"
+)
+
+// otherRuntime replaces runtimes that are not in the configured list.
+const otherRuntime = "other"
+
+// unmatchedRoute is the route label of requests that match no route.
+const unmatchedRoute = "unmatched"
+
+// inventoryTTL bounds how often scrapes count functions and tenants.
+const inventoryTTL = time.Minute
+
+// Options configure the labels of the metrics.
+type Options struct {
+	// FunctionLabels adds the function name as a label of build and deploy metrics.
+	FunctionLabels bool
+	// Runtimes are the runtimes reported by name.
+	Runtimes []string
+}
+
+// Metrics records the metrics of a server. A nil *Metrics records nothing.
+type Metrics struct {
+	registry       *prometheus.Registry
+	functionLabels bool
+	runtimes       map[string]bool
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	buildDuration   *prometheus.HistogramVec
+	pushDuration    *prometheus.HistogramVec
+	imageSize       *prometheus.HistogramVec
+	deploys         *prometheus.CounterVec
+	buildQueue      prometheus.Gauge
+}
+
+// New returns Metrics registered in a registry of their own, along with the Go
+// runtime and process metrics.
+func New(opts Options) *Metrics {
+	m := &Metrics{
+		registry:       prometheus.NewRegistry(),
+		functionLabels: opts.FunctionLabels,
+		runtimes:       map[string]bool{},
+	}
+	for _, r := range opts.Runtimes {
+		m.runtimes[strings.ToLower(r)] = true
+	}
+
+	buildLabels := []string{"runtime"}
+	deployLabels := []string{"result", "reason"}
+	if m.functionLabels {
+		buildLabels = append(buildLabels, "function")
+		deployLabels = append(deployLabels, "function")
+	}
+
+	m.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+	m.requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	m.buildDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "build_duration_seconds",
+		Help:      "Duration of function image builds.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+	}, buildLabels)
+	m.pushDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "push_duration_seconds",
+		Help:      "Duration of function image pushes to the registry.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+	}, buildLabels)
+	m.imageSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_size_bytes",
+		Help:      "Size of built function images.",
+		Buckets:   prometheus.ExponentialBuckets(1<<20, 2, 12),
+	}, buildLabels)
+	m.deploys = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deploys_total",
+		Help:      "Function deploys by result and failure reason.",
+	}, deployLabels)
+	m.buildQueue = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_queue_depth",
+		Help:      "Builds waiting for or running on the Docker daemon.",
+	})
+
+	m.registry.MustRegister(
+		m.requests, m.requestDuration,
+		m.buildDuration, m.pushDuration, m.imageSize,
+		m.deploys, m.buildQueue,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests and their latency by route template.
+func (m *Metrics) Middleware(c *gin.Context) {
+	if m == nil {
+		c.Next()
+		return
+	}
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = unmatchedRoute
+	}
+	method := c.Request.Method
+	m.requests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	m.requestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+}
+
+// runtime bounds the runtime label.
+func (m *Metrics) runtime(runtime string) string {
+	runtime = strings.ToLower(runtime)
+	if m.runtimes[runtime] {
+		return runtime
+	}
+	return otherRuntime
+}
+
+func (m *Metrics) buildLabels(runtime, function string) []string {
+	labels := []string{m.runtime(runtime)}
+	if m.functionLabels {
+		labels = append(labels, function)
+	}
+	return labels
+}
+
+// BuildQueued counts a build until the returned function is called.
+func (m *Metrics) BuildQueued() (done func()) {
+	if m == nil {
+		return func() {}
+	}
+	m.buildQueue.Inc()
+	return m.buildQueue.Dec
+}
+
+// ObserveBuild records how long building the image of a function took.
+func (m *Metrics) ObserveBuild(runtime, function string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.buildDuration.WithLabelValues(m.buildLabels(runtime, function)...).Observe(d.Seconds())
+}
+
+// ObservePush records how long pushing the image of a function took.
+func (m *Metrics) ObservePush(runtime, function string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.pushDuration.WithLabelValues(m.buildLabels(runtime, function)...).Observe(d.Seconds())
+}
+
+// ObserveImageSize records the size of the image of a function.
+func (m *Metrics) ObserveImageSize(runtime, function string, bytes int64) {
+	if m == nil {
+		return
+	}
+	m.imageSize.WithLabelValues(m.buildLabels(runtime, function)...).Observe(float64(bytes))
+}
+
+// Deployed counts a deploy. reason is ReasonNone for successful deploys.
+func (m *Metrics) Deployed(function, reason string) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if reason != ReasonNone {
+		result = "failure"
+	}
+	labels := []string{result, reason}
+	if m.functionLabels {
+		labels = append(labels, function)
+	}
+	m.deploys.WithLabelValues(labels...).Inc()
+}
+
+// Inventory counts what runs on the platform.
+type Inventory struct {
+	Functions int
+	Tenants   int
+}
+
+// CountInventory reports the number of functions and tenants, as counted by count
+// at most once a minute.
+func (m *Metrics) CountInventory(count func(ctx context.Context) (Inventory, error)) {
+	m.registry.MustRegister(newInventoryCollector(count))
+}
+
+type inventoryCollector struct {
+	count              func(ctx context.Context) (Inventory, error)
+	functions, tenants *prometheus.Desc
+
+	mu        sync.Mutex
+	last      Inventory
+	countedAt time.Time
+}
+
+func newInventoryCollector(count func(ctx context.Context) (Inventory, error)) *inventoryCollector {
+	return &inventoryCollector{
+		count: count,
+		functions: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "functions"),
+			"Functions deployed in tenant namespaces.", nil, nil),
+		tenants: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "tenants"),
+			"Tenant namespaces.", nil, nil),
+	}
+}
+
+func (c *inventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.functions
+	ch <- c.tenants
+}
+
+func (c *inventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.countedAt) > inventoryTTL {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		inventory, err := c.count(ctx)
+		cancel()
+		if err != nil {
+			// Keep reporting the last count rather than a misleading zero.
+			log.WithError(err).Warn("failed to count functions and tenants")
+		} else {
+			c.last, c.countedAt = inventory, time.Now()
+		}
+	}
+	if c.countedAt.IsZero() {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.functions, prometheus.GaugeValue, float64(c.last.Functions))
+	ch <- prometheus.MustNewConstMetric(c.tenants, prometheus.GaugeValue, float64(c.last.Tenants))
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareLabelsRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New(Options{})
+	router := gin.New()
+	router.Use(m.Middleware)
+	router.GET("/api/function/:name", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/api/function/a", "/api/function/b", "/random/1", "/random/2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	require.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "/api/function/:name", "200")))
+	require.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", unmatchedRoute, "404")))
+	require.Equal(t, 2, testutil.CollectAndCount(m.requests), "paths do not become labels")
+}
+
+func TestBuildLabels(t *testing.T) {
+	m := New(Options{Runtimes: []string{"Python", "go"}})
+	m.ObserveBuild("python", "hello", time.Second)
+	m.ObserveBuild("cobol", "hello", time.Second)
+	m.ObserveBuild("fortran", "world", time.Second)
+
+	require.Equal(t, map[string]uint64{"python": 1, otherRuntime: 2}, buildCounts(t, m))
+
+	labeled := New(Options{FunctionLabels: true, Runtimes: []string{"python"}})
+	labeled.ObservePush("python", "hello", time.Second)
+	labeled.ObservePush("python", "world", time.Second)
+	require.Equal(t, 2, testutil.CollectAndCount(labeled.pushDuration))
+}
+
+func TestDeployed(t *testing.T) {
+	m := New(Options{})
+	m.Deployed("hello", ReasonNone)
+	m.Deployed("hello", ReasonPush)
+	m.Deployed("world", ReasonPush)
+
+	require.Equal(t, 1.0, testutil.ToFloat64(m.deploys.WithLabelValues("success", ReasonNone)))
+	require.Equal(t, 2.0, testutil.ToFloat64(m.deploys.WithLabelValues("failure", ReasonPush)))
+
+	labeled := New(Options{FunctionLabels: true})
+	labeled.Deployed("hello", ReasonDeploy)
+	require.Equal(t, 1.0, testutil.ToFloat64(labeled.deploys.WithLabelValues("failure", ReasonDeploy, "hello")))
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.BuildQueued()()
+	m.ObserveBuild("go", "hello", time.Second)
+	m.Deployed("hello", ReasonNone)
+}
+
+func TestInventoryIsCached(t *testing.T) {
+	calls := 0
+	var err error
+	c := newInventoryCollector(func(context.Context) (Inventory, error) {
+		calls++
+		return Inventory{Functions: 3, Tenants: 2}, err
+	})
+
+	expected := `
+# HELP faas_functions Functions deployed in tenant namespaces.
+# TYPE faas_functions gauge
+faas_functions 3
+# HELP faas_tenants Tenant namespaces.
+# TYPE faas_tenants gauge
+faas_tenants 2
+`
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	require.Equal(t, 1, calls, "scrapes within a minute reuse the count")
+
+	// A failed count keeps reporting the last one.
+	err = errors.New("cluster unreachable")
+	c.countedAt = c.countedAt.Add(-2 * inventoryTTL)
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	require.Equal(t, 2, calls)
+}
+
+// buildCounts returns the number of builds observed by runtime.
+func buildCounts(t *testing.T, m *Metrics) map[string]uint64 {
+	families, err := m.registry.Gather()
+	require.NoError(t, err)
+	counts := map[string]uint64{}
+	for _, family := range families {
+		if family.GetName() != "faas_build_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			counts[metric.GetLabel()[0].GetValue()] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	return counts
+}
@@ -0,0 +1,286 @@
+// Package org manages organizations: groups of users sharing a namespace, each
+// member holding a role that decides what they may do with the organization's functions.
+package org
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"faas-api/internal/apierror"
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/k8/store"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+)
+
+const recordKind = "org"
+
+// maxSlugLength leaves room for the "org-" prefix and hash suffix of the namespace name.
+const maxSlugLength = 40
+
+// Role is the access level of an organization member. Every role includes the
+// permissions of the roles below it.
+type Role string
+
+const (
+	// RoleViewer may list, inspect, read logs of and invoke functions.
+	RoleViewer Role = "viewer"
+	// RoleDeveloper may also deploy functions and manage API keys.
+	RoleDeveloper Role = "developer"
+	// RoleAdmin may also delete functions and manage members.
+	RoleAdmin Role = "admin"
+)
+
+var roleRank = map[Role]int{RoleViewer: 1, RoleDeveloper: 2, RoleAdmin: 3}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Includes reports whether r grants at least the permissions of required.
+func (r Role) Includes(required Role) bool {
+	return r.Valid() && roleRank[r] >= roleRank[required]
+}
+
+var (
+	ErrExists    = errors.New("organization already exists")
+	ErrNotFound  = errors.New("organization not found")
+	ErrNotMember = errors.New("not a member of the organization")
+	ErrLastAdmin = errors.New("an organization needs at least one admin")
+)
+
+// Member is a user's membership in an organization, identified by their subject claim.
+type Member struct {
+	Subject  string    `json:"subject"`
+	Username string    `json:"username,omitempty"`
+	Role     Role      `json:"role"`
+	AddedBy  string    `json:"added_by"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// Org is the stored representation of an organization.
+type Org struct {
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Namespace string    `json:"namespace"`
+	Members   []Member  `json:"members"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RoleOf returns the role subject holds in the organization.
+func (o *Org) RoleOf(subject string) (Role, bool) {
+	for _, m := range o.Members {
+		if m.Subject == subject {
+			return m.Role, true
+		}
+	}
+	return "", false
+}
+
+func (o *Org) admins() int {
+	n := 0
+	for _, m := range o.Members {
+		if m.Role == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+// Provider prefixes the subjects of organizations. Identity providers may not take
+// this name, so that no user subject clashes with the subject of an organization.
+const Provider = "org"
+
+// Owner is the namespace owner of the organization.
+func Owner(slug, name string) namespace.Owner {
+	return namespace.Owner{
+		Subject:     Provider + "|" + slug,
+		Provider:    Provider,
+		DisplayName: name,
+	}
+}
+
+// CreateRequest describes a new organization.
+type CreateRequest struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// MemberRequest adds a member or changes their role.
+type MemberRequest struct {
+	Subject  string `json:"subject"`
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+}
+
+// Manager creates organizations and manages their members.
+type Manager struct {
+	client dynamic.Interface
+	store  *store.Store[Org]
+	now    func() time.Time
+}
+
+func NewManager(client dynamic.Interface) *Manager {
+	return &Manager{
+		client: client,
+		store:  store.New[Org](client, recordKind),
+		now:    time.Now,
+	}
+}
+
+// Create creates an organization and its namespace, with creator as its first admin.
+func (m *Manager) Create(ctx context.Context, creator namespace.Owner, req CreateRequest) (*Org, error) {
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	if len(req.Slug) > maxSlugLength || len(validation.IsDNS1123Label(req.Slug)) > 0 {
+		return nil, apierror.Field("slug", "slug must be a lowercase DNS label of at most %d characters", maxSlugLength)
+	}
+	if req.Name == "" {
+		req.Name = req.Slug
+	}
+
+	if _, err := m.Get(ctx, req.Slug); err == nil {
+		return nil, ErrExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	ns, err := namespace.CreateOrGetNamespace(ctx, m.client, Owner(req.Slug, req.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization namespace: %w", err)
+	}
+
+	now := m.now().UTC()
+	o := &Org{
+		Slug:      req.Slug,
+		Name:      req.Name,
+		Namespace: ns,
+		Members: []Member{{
+			Subject:  creator.Subject,
+			Username: creator.Username,
+			Role:     RoleAdmin,
+			AddedBy:  creator.Subject,
+			AddedAt:  now,
+		}},
+		CreatedBy: creator.Subject,
+		CreatedAt: now,
+	}
+	if err := m.store.Create(ctx, ns, o.Slug, nil, o); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			// Created by a concurrent request since the check above.
+			return nil, ErrExists
+		}
+		return nil, err
+	}
+	return o, nil
+}
+
+// Get loads an organization by slug.
+func (m *Manager) Get(ctx context.Context, slug string) (*Org, error) {
+	o, _, err := m.store.Find(ctx, slug)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	return o, err
+}
+
+// ListForSubject returns the organizations subject is a member of, sorted by slug.
+func (m *Manager) ListForSubject(ctx context.Context, subject string) ([]Org, error) {
+	all, err := m.store.List(ctx, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	orgs := make([]Org, 0)
+	for _, o := range all {
+		if _, ok := o.RoleOf(subject); ok {
+			orgs = append(orgs, o)
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Slug < orgs[j].Slug })
+	return orgs, nil
+}
+
+// SetMember adds a member or changes the role of an existing one.
+func (m *Manager) SetMember(ctx context.Context, slug, by string, req MemberRequest) (*Org, error) {
+	if req.Subject == "" {
+		return nil, apierror.Field("subject", "member subject is required")
+	}
+	if !req.Role.Valid() {
+		return nil, apierror.Field("role", "role must be one of viewer, developer or admin")
+	}
+
+	o, err := m.Get(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.update(ctx, o, func(o *Org) error {
+		found := false
+		for i := range o.Members {
+			if o.Members[i].Subject != req.Subject {
+				continue
+			}
+			found = true
+			o.Members[i].Role = req.Role
+			if req.Username != "" {
+				o.Members[i].Username = req.Username
+			}
+		}
+		if !found {
+			o.Members = append(o.Members, Member{
+				Subject:  req.Subject,
+				Username: req.Username,
+				Role:     req.Role,
+				AddedBy:  by,
+				AddedAt:  m.now().UTC(),
+			})
+		}
+		if o.admins() == 0 {
+			return ErrLastAdmin
+		}
+		return nil
+	})
+}
+
+// update applies mutate to the stored organization o, keeping the changes made to it
+// since o was read.
+func (m *Manager) update(ctx context.Context, o *Org, mutate func(*Org) error) (*Org, error) {
+	updated, err := m.store.Update(ctx, o.Namespace, o.Slug, mutate)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	return updated, err
+}
+
+// RemoveMember removes subject from the organization.
+func (m *Manager) RemoveMember(ctx context.Context, slug, subject string) (*Org, error) {
+	o, err := m.Get(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.update(ctx, o, func(o *Org) error {
+		members := make([]Member, 0, len(o.Members))
+		for _, member := range o.Members {
+			if member.Subject != subject {
+				members = append(members, member)
+			}
+		}
+		if len(members) == len(o.Members) {
+			return ErrNotMember
+		}
+		o.Members = members
+		if o.admins() == 0 {
+			return ErrLastAdmin
+		}
+		return nil
+	})
+}
@@ -0,0 +1,109 @@
+package org
+
+import (
+	"strings"
+	"testing"
+
+	"faas-api/internal/apierror"
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/k8/store"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var jane = namespace.Owner{Subject: "github|1", Provider: "github", Username: "jane"}
+
+func newTestManager() *Manager {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		store.SecretGVR:                         "SecretList",
+		{Version: "v1", Resource: "namespaces"}: "NamespaceList",
+	})
+	return NewManager(client)
+}
+
+func TestRoleIncludes(t *testing.T) {
+	require.True(t, RoleAdmin.Includes(RoleDeveloper))
+	require.True(t, RoleDeveloper.Includes(RoleDeveloper))
+	require.False(t, RoleViewer.Includes(RoleDeveloper))
+	require.False(t, Role("owner").Includes(RoleViewer))
+}
+
+func TestCreateOrg(t *testing.T) {
+	m := newTestManager()
+
+	o, err := m.Create(t.Context(), jane, CreateRequest{Slug: "Acme", Name: "Acme Inc."})
+	require.NoError(t, err)
+	require.Equal(t, "acme", o.Slug)
+	require.True(t, strings.HasPrefix(o.Namespace, "org-acme-"), o.Namespace)
+	role, ok := o.RoleOf(jane.Subject)
+	require.True(t, ok)
+	require.Equal(t, RoleAdmin, role)
+
+	_, err = m.Create(t.Context(), jane, CreateRequest{Slug: "acme"})
+	require.ErrorIs(t, err, ErrExists)
+
+	_, err = m.Create(t.Context(), jane, CreateRequest{Slug: "not a slug"})
+	require.Equal(t, apiv1.CodeValidationFailed, apierror.From(err).Code)
+
+	got, err := m.Get(t.Context(), "acme")
+	require.NoError(t, err)
+	require.Equal(t, o.Namespace, got.Namespace)
+
+	_, err = m.Get(t.Context(), "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCreateOrgRace(t *testing.T) {
+	m := newTestManager()
+	// A concurrent request stores the same slug between the check and the create.
+	m.client.(*dynamicfake.FakeDynamicClient).PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewAlreadyExists(store.SecretGVR.GroupResource(), "org-acme")
+	})
+
+	_, err := m.Create(t.Context(), jane, CreateRequest{Slug: "acme"})
+	require.ErrorIs(t, err, ErrExists)
+}
+
+func TestMembers(t *testing.T) {
+	m := newTestManager()
+	_, err := m.Create(t.Context(), jane, CreateRequest{Slug: "acme"})
+	require.NoError(t, err)
+	_, err = m.Create(t.Context(), namespace.Owner{Subject: "github|2"}, CreateRequest{Slug: "other"})
+	require.NoError(t, err)
+
+	o, err := m.SetMember(t.Context(), "acme", jane.Subject, MemberRequest{Subject: "github|3", Username: "bob", Role: RoleViewer})
+	require.NoError(t, err)
+	require.Len(t, o.Members, 2)
+
+	o, err = m.SetMember(t.Context(), "acme", jane.Subject, MemberRequest{Subject: "github|3", Role: RoleDeveloper})
+	require.NoError(t, err)
+	role, _ := o.RoleOf("github|3")
+	require.Equal(t, RoleDeveloper, role)
+	require.Len(t, o.Members, 2)
+
+	orgs, err := m.ListForSubject(t.Context(), "github|3")
+	require.NoError(t, err)
+	require.Len(t, orgs, 1)
+	require.Equal(t, "acme", orgs[0].Slug)
+
+	_, err = m.SetMember(t.Context(), "acme", jane.Subject, MemberRequest{Subject: "github|3", Role: "owner"})
+	require.Equal(t, apiv1.CodeValidationFailed, apierror.From(err).Code)
+
+	_, err = m.SetMember(t.Context(), "acme", jane.Subject, MemberRequest{Subject: jane.Subject, Role: RoleViewer})
+	require.ErrorIs(t, err, ErrLastAdmin)
+	_, err = m.RemoveMember(t.Context(), "acme", jane.Subject)
+	require.ErrorIs(t, err, ErrLastAdmin)
+
+	o, err = m.RemoveMember(t.Context(), "acme", "github|3")
+	require.NoError(t, err)
+	require.Len(t, o.Members, 1)
+
+	_, err = m.RemoveMember(t.Context(), "acme", "github|3")
+	require.ErrorIs(t, err, ErrNotMember)
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"errors"
+	"faas-api/internal/apierror"
+	"faas-api/internal/audit"
+	"faas-api/internal/org"
+	apiv1 "faas-api/pkg/api/v1"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// orgError writes the response for an error returned by the org package.
+func orgError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, org.ErrNotFound):
+		apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "organization not found"))
+	case errors.Is(err, org.ErrNotMember):
+		apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "member not found"))
+	case errors.Is(err, org.ErrExists):
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeAlreadyExists, ""))
+	case errors.Is(err, org.ErrLastAdmin):
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInvalidRequest, ""))
+	default:
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to "+action))
+	}
+}
+
+// CreateOrgHandler creates an organization with the caller as its first admin.
+func (p *Platform) CreateOrgHandler(c *gin.Context) {
+	var req org.CreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInvalidRequest, "invalid organization request"))
+		return
+	}
+
+	if c.GetString("namespace") != "" {
+		apierror.Abort(c, apierror.New(apiv1.CodeForbidden, "this endpoint requires a user login"))
+		return
+	}
+
+	owner, ok := callerOwner(c)
+	if !ok {
+		apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "username is required"))
+		return
+	}
+
+	o, err := org.NewManager(p.Client).Create(c, owner, req)
+	if err != nil {
+		orgError(c, "create organization", err)
+		return
+	}
+	details := audit.From(c)
+	details.Tenant = o.Namespace
+	details.Resource = o.Slug
+	details.After = map[string]interface{}{"name": o.Name}
+
+	if err := p.Namespaces.Provision(c, o.Namespace); err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to provision namespace"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, o)
+}
+
+// ListOrgsHandler lists the organizations the caller is a member of.
+func (p *Platform) ListOrgsHandler(c *gin.Context) {
+	orgs, err := org.NewManager(p.Client).ListForSubject(c, c.GetString("sub"))
+	if err != nil {
+		orgError(c, "list organizations", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, orgs)
+}
+
+// loadOrg loads the organization in the ":org" path parameter and checks the
+// caller's role in it.
+func (p *Platform) loadOrg(c *gin.Context, required org.Role) (*org.Org, bool) {
+	o, err := org.NewManager(p.Client).Get(c, c.Param("org"))
+	if err != nil {
+		orgError(c, "get organization", err)
+		return nil, false
+	}
+
+	role, member := o.RoleOf(c.GetString("sub"))
+	if !member {
+		apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "organization not found"))
+		return nil, false
+	}
+	if !role.Includes(required) {
+		apierror.Abort(c, apierror.New(apiv1.CodeForbidden, "requires the %s role in organization %s", required, o.Slug))
+		return nil, false
+	}
+	audit.From(c).Tenant = o.Namespace
+	return o, true
+}
+
+func (p *Platform) GetOrgHandler(c *gin.Context) {
+	o, ok := p.loadOrg(c, org.RoleViewer)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// SetOrgMemberHandler adds a member to an organization or changes their role.
+func (p *Platform) SetOrgMemberHandler(c *gin.Context) {
+	var req org.MemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInvalidRequest, "invalid member request"))
+		return
+	}
+
+	o, ok := p.loadOrg(c, org.RoleAdmin)
+	if !ok {
+		return
+	}
+	details := audit.From(c)
+	details.Before = memberSummary(o, req.Subject)
+	details.After = map[string]interface{}{"subject": req.Subject, "role": req.Role}
+
+	o, err := org.NewManager(p.Client).SetMember(c, o.Slug, c.GetString("sub"), req)
+	if err != nil {
+		orgError(c, "update member", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// RemoveOrgMemberHandler removes a member from an organization. Admins may remove
+// anyone; other members may only remove themselves.
+func (p *Platform) RemoveOrgMemberHandler(c *gin.Context) {
+	subject := c.Param("subject")
+	required := org.RoleAdmin
+	if subject == c.GetString("sub") {
+		required = org.RoleViewer
+	}
+
+	o, ok := p.loadOrg(c, required)
+	if !ok {
+		return
+	}
+	audit.From(c).Before = memberSummary(o, subject)
+
+	o, err := org.NewManager(p.Client).RemoveMember(c, o.Slug, subject)
+	if err != nil {
+		orgError(c, "remove member", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// memberSummary describes the membership of subject in o for the audit log, or
+// returns nil if subject is not a member.
+func memberSummary(o *org.Org, subject string) map[string]interface{} {
+	role, member := o.RoleOf(subject)
+	if !member {
+		return nil
+	}
+	return map[string]interface{}{"subject": subject, "role": role}
+}
@@ -0,0 +1,232 @@
+// Package pat implements personal access tokens, which let CLIs and CI pipelines act
+// on behalf of a user without a browser session.
+package pat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"faas-api/internal/apierror"
+	"faas-api/internal/credential"
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/k8/store"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
+)
+
+// Prefix identifies personal access tokens, e.g. "faas_pat_<id>_<secret>".
+const Prefix = "faas_pat_"
+
+// lastUsedResolution limits how often the last-used timestamp is written back.
+const lastUsedResolution = time.Minute
+
+const recordKind = "access-token"
+
+// Scope limits what a token may be used for. Each scope includes the ones before it.
+type Scope string
+
+const (
+	// ScopeRead allows reading functions, logs and status and invoking functions.
+	ScopeRead Scope = "read"
+	// ScopeDeploy also allows deploying functions.
+	ScopeDeploy Scope = "deploy"
+	// ScopeAdmin allows everything, including deleting functions and managing API keys,
+	// organizations and tokens.
+	ScopeAdmin Scope = "admin"
+)
+
+var scopeRank = map[Scope]int{ScopeRead: 1, ScopeDeploy: 2, ScopeAdmin: 3}
+
+// Valid reports whether s is a known scope.
+func (s Scope) Valid() bool {
+	_, ok := scopeRank[s]
+	return ok
+}
+
+var (
+	ErrInvalidToken = errors.New("invalid access token")
+	ErrRevoked      = errors.New("access token has been revoked")
+	ErrExpired      = errors.New("access token has expired")
+)
+
+// Token is the stored representation of a personal access token. Only the SHA-256
+// hash of its secret is stored. The identity fields are what requests made with the
+// token are authenticated as.
+type Token struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Scopes      []Scope    `json:"scopes"`
+	Subject     string     `json:"subject"`
+	Provider    string     `json:"provider"`
+	DisplayName string     `json:"display_name"`
+	Username    string     `json:"username"`
+	Hash        string     `json:"hash,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Allows reports whether the token grants scope.
+func (t *Token) Allows(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if scopeRank[s] >= scopeRank[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of the token that is safe to return to clients.
+func (t Token) Redacted() Token {
+	t.Hash = ""
+	return t
+}
+
+// CreateRequest describes a new token.
+type CreateRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []Scope    `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Manager creates, lists, revokes and verifies personal access tokens.
+type Manager struct {
+	store *store.Store[Token]
+	now   func() time.Time
+}
+
+func NewManager(client dynamic.Interface) *Manager {
+	return &Manager{
+		store: store.New[Token](client, recordKind),
+		now:   time.Now,
+	}
+}
+
+// Create issues a token for owner, stored in namespace ns, and returns it together with
+// the plaintext token, which is only available at creation time.
+func (m *Manager) Create(ctx context.Context, ns string, owner namespace.Owner, req CreateRequest) (*Token, string, error) {
+	if req.Name == "" {
+		return nil, "", apierror.Field("name", "name is required")
+	}
+	if len(req.Scopes) == 0 {
+		return nil, "", apierror.Field("scopes", "at least one scope is required")
+	}
+	for _, s := range req.Scopes {
+		if !s.Valid() {
+			return nil, "", apierror.Field("scopes", "unknown scope %q, expected read, deploy or admin", s)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(m.now()) {
+		return nil, "", apierror.Field("expires_at", "expires_at must be in the future")
+	}
+
+	cred, err := credential.New(Prefix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := &Token{
+		ID:          cred.ID,
+		Name:        req.Name,
+		Scopes:      req.Scopes,
+		Subject:     owner.Subject,
+		Provider:    owner.Provider,
+		DisplayName: owner.DisplayName,
+		Username:    owner.Username,
+		Hash:        cred.Hash,
+		CreatedAt:   m.now().UTC(),
+		ExpiresAt:   req.ExpiresAt,
+	}
+
+	if err := m.store.Create(ctx, ns, cred.ID, nil, token); err != nil {
+		return nil, "", err
+	}
+
+	return token, cred.Token, nil
+}
+
+// List returns the tokens stored in namespace without their hashes.
+func (m *Manager) List(ctx context.Context, namespace string) ([]Token, error) {
+	tokens, err := m.store.List(ctx, namespace, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		tokens[i] = tokens[i].Redacted()
+	}
+	return tokens, nil
+}
+
+// Revoke marks a token as revoked. Revoked tokens are kept so they still show up in listings.
+func (m *Manager) Revoke(ctx context.Context, namespace, id string) (*Token, error) {
+	token, err := m.store.Update(ctx, namespace, id, func(token *Token) error {
+		if token.RevokedAt == nil {
+			now := m.now().UTC()
+			token.RevokedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	redacted := token.Redacted()
+	return &redacted, nil
+}
+
+// Authenticate verifies a presented token. Callers must still check Allows for the
+// scope the request needs.
+func (m *Manager) Authenticate(ctx context.Context, presented string) (*Token, error) {
+	id, secret, ok := credential.Parse(Prefix, presented)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	token, ns, err := m.store.Find(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if !credential.Verify(token.Hash, secret) {
+		return nil, ErrInvalidToken
+	}
+
+	now := m.now()
+	if token.RevokedAt != nil {
+		return nil, ErrRevoked
+	}
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedResolution {
+		used, err := m.store.Update(ctx, ns, token.ID, func(t *Token) error {
+			if t.RevokedAt != nil {
+				return ErrRevoked
+			}
+			lastUsed := now.UTC()
+			t.LastUsedAt = &lastUsed
+			return nil
+		})
+		switch {
+		case errors.Is(err, ErrRevoked):
+			return nil, ErrRevoked
+		case err != nil:
+			log.WithError(err).WithField("token_id", token.ID).Warn("failed to record access token usage")
+		default:
+			token = used
+		}
+	}
+
+	return token, nil
+}
+
+// IsToken reports whether s looks like a personal access token.
+func IsToken(s string) bool {
+	return strings.HasPrefix(s, Prefix)
+}
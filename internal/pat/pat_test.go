@@ -0,0 +1,101 @@
+package pat
+
+import (
+	"testing"
+	"time"
+
+	"faas-api/internal/apierror"
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/k8/store/storetest"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/stretchr/testify/require"
+)
+
+var jane = namespace.Owner{Subject: "github|1", Provider: "github", DisplayName: "Jane", Username: "jane"}
+
+func newTestManager() *Manager {
+	return NewManager(storetest.NewClient())
+}
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	m := newTestManager()
+
+	created, token, err := m.Create(t.Context(), "github-1-abc", jane, CreateRequest{Name: "ci", Scopes: []Scope{ScopeDeploy}})
+	require.NoError(t, err)
+	require.True(t, IsToken(token))
+	require.NotContains(t, created.Hash, token, "only the hash of the secret is stored")
+
+	got, err := m.Authenticate(t.Context(), token)
+	require.NoError(t, err)
+	require.Equal(t, jane.Subject, got.Subject)
+	require.Equal(t, "jane", got.Username)
+	require.NotNil(t, got.LastUsedAt, "last used timestamp should be recorded")
+	require.True(t, got.Allows(ScopeRead))
+	require.True(t, got.Allows(ScopeDeploy))
+	require.False(t, got.Allows(ScopeAdmin))
+
+	_, err = m.Authenticate(t.Context(), token+"x")
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = m.Authenticate(t.Context(), "faas_ak_123_abc")
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	tokens, err := m.List(t.Context(), "github-1-abc")
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	require.Empty(t, tokens[0].Hash, "listed tokens must not include the hash")
+}
+
+func TestRevokeBetweenLoadAndLastUsedUpdate(t *testing.T) {
+	client := storetest.NewClient()
+	admin := NewManager(client)
+	created, token, err := admin.Create(t.Context(), "ns", jane, CreateRequest{Name: "ci", Scopes: []Scope{ScopeRead}})
+	require.NoError(t, err)
+
+	m := NewManager(storetest.BeforeUpdate(client, func() {
+		_, err := admin.Revoke(t.Context(), "ns", created.ID)
+		require.NoError(t, err)
+	}))
+	_, err = m.Authenticate(t.Context(), token)
+	require.ErrorIs(t, err, ErrRevoked)
+	_, err = admin.Authenticate(t.Context(), token)
+	require.ErrorIs(t, err, ErrRevoked, "recording the use must not undo the revocation")
+}
+
+func TestRevokeAndExpire(t *testing.T) {
+	m := newTestManager()
+
+	created, token, err := m.Create(t.Context(), "ns", jane, CreateRequest{Name: "ci", Scopes: []Scope{ScopeRead}})
+	require.NoError(t, err)
+	_, err = m.Revoke(t.Context(), "ns", created.ID)
+	require.NoError(t, err)
+	_, err = m.Authenticate(t.Context(), token)
+	require.ErrorIs(t, err, ErrRevoked)
+
+	expires := time.Now().Add(time.Hour)
+	_, token, err = m.Create(t.Context(), "ns", jane, CreateRequest{Name: "short", Scopes: []Scope{ScopeRead}, ExpiresAt: &expires})
+	require.NoError(t, err)
+	m.now = func() time.Time { return expires.Add(time.Second) }
+	_, err = m.Authenticate(t.Context(), token)
+	require.ErrorIs(t, err, ErrExpired)
+}
+
+func TestCreateValidation(t *testing.T) {
+	m := newTestManager()
+
+	_, _, err := m.Create(t.Context(), "ns", jane, CreateRequest{Name: "ci"})
+	requireInvalidField(t, err, "scopes")
+	_, _, err = m.Create(t.Context(), "ns", jane, CreateRequest{Name: "ci", Scopes: []Scope{"write"}})
+	requireInvalidField(t, err, "scopes")
+	past := time.Now().Add(-time.Hour)
+	_, _, err = m.Create(t.Context(), "ns", jane, CreateRequest{Name: "ci", Scopes: []Scope{ScopeRead}, ExpiresAt: &past})
+	requireInvalidField(t, err, "expires_at")
+}
+
+func requireInvalidField(t *testing.T, err error, field string) {
+	t.Helper()
+	e := apierror.From(err)
+	require.Equal(t, apiv1.CodeValidationFailed, e.Code)
+	require.Len(t, e.Fields, 1)
+	require.Equal(t, field, e.Fields[0].Field)
+}
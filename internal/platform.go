@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"faas-api/internal/audit"
+	"faas-api/internal/function"
+	"faas-api/internal/gateway"
+	"faas-api/internal/invocation"
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/metrics"
+	"faas-api/internal/resource"
+	"faas-api/internal/service"
+	"faas-api/internal/session"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ImageBuilder builds the image of a function and pushes it to the registry,
+// returning the image name. function.DockerBuilder builds with a Docker daemon.
+type ImageBuilder interface {
+	Build(ctx context.Context, f *function.FunctionRequest) (string, error)
+}
+
+// FunctionDeployer runs functions and reads them back. resource.Knative deploys them
+// as Knative services. Get and List redact the literal values of environment
+// variables, which only Env returns.
+type FunctionDeployer interface {
+	Deploy(ctx context.Context, svc *service.Service) error
+	Get(ctx context.Context, namespace, name string) (*apiv1.Function, error)
+	Env(ctx context.Context, namespace, name string) ([]apiv1.EnvVar, error)
+	List(ctx context.Context, namespace string, opts resource.ListOptions) (*apiv1.FunctionList, error)
+	Delete(ctx context.Context, namespace, name string) error
+}
+
+// NamespaceManager finds and sets up the namespaces of users. namespace.Manager
+// manages Kubernetes namespaces.
+type NamespaceManager interface {
+	// Resolve returns the name of the owner's namespace without creating it.
+	Resolve(ctx context.Context, owner namespace.Owner) (string, error)
+	// CreateOrGet returns the owner's namespace, creating it if needed.
+	CreateOrGet(ctx context.Context, owner namespace.Owner) (string, error)
+	// Provision applies the tenant guard rails to a namespace.
+	Provision(ctx context.Context, name string) error
+}
+
+// Platform holds the backends the handlers act on. The handlers are its methods.
+type Platform struct {
+	Images     ImageBuilder
+	Functions  FunctionDeployer
+	Namespaces NamespaceManager
+	// Client serves the records kept in the cluster, such as organizations and API
+	// keys, and KubeClient the pods behind function status and logs.
+	Client     dynamic.Interface
+	KubeClient kubernetes.Interface
+	// Metrics records deploys; nil records nothing.
+	Metrics *metrics.Metrics
+	// Sessions keeps the browser sessions, listed and revoked by the session handlers.
+	Sessions *session.Manager
+	// Audit records the changes made through the API; nil records nothing.
+	Audit *audit.Log
+	// Gateway forwards invocations to functions, and Invocations runs the
+	// asynchronous ones.
+	Gateway     *gateway.Gateway
+	Invocations *invocation.Runner
+}
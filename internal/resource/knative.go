@@ -0,0 +1,101 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"faas-api/internal/service"
+	"faas-api/internal/tracing"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Readiness of deployed services is polled this often, for at most readyTimeout.
+const (
+	readyPollInterval = 2 * time.Second
+	readyTimeout      = 5 * time.Minute
+)
+
+// Knative deploys functions as Knative services and reads them back as Functions.
+type Knative struct {
+	client dynamic.Interface
+	kube   kubernetes.Interface
+
+	pollInterval, readyTimeout time.Duration
+}
+
+// NewKnative returns a Knative deployer for the cluster of client and kube.
+func NewKnative(client dynamic.Interface, kube kubernetes.Interface) *Knative {
+	return &Knative{client: client, kube: kube, pollInterval: readyPollInterval, readyTimeout: readyTimeout}
+}
+
+// Deploy creates the Knative service svc. It does not wait for the service to be
+// ready; the wait is traced in the background, so that the trace of the deploy
+// shows how long the first revision took to come up.
+func (k *Knative) Deploy(ctx context.Context, svc *service.Service) (err error) {
+	ctx, span := tracing.Start(ctx, "CreateKnativeService",
+		tracing.FunctionKey.String(svc.FunctionName), tracing.NamespaceKey.String(svc.Namespace))
+	defer func() { tracing.End(span, err) }()
+
+	deployed, err := svc.Deploy(ctx, k.client)
+	if err != nil {
+		return err
+	}
+	if deployed == nil {
+		return fmt.Errorf("failed to deploy service")
+	}
+	go k.waitReady(tracing.Detach(ctx), svc.Namespace, svc.FunctionName)
+	return nil
+}
+
+// waitReady traces the wait for a deployed function to become ready or fail.
+func (k *Knative) waitReady(ctx context.Context, namespace, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "WaitKnativeServiceReady",
+		tracing.FunctionKey.String(name), tracing.NamespaceKey.String(namespace))
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, k.readyTimeout)
+	defer cancel()
+	ticker := time.NewTicker(k.pollInterval)
+	defer ticker.Stop()
+	for {
+		f, err := k.Get(ctx, namespace, name)
+		if err == nil {
+			span.SetAttributes(tracing.StateKey.String(f.Status.State))
+			switch f.Status.State {
+			case apiv1.StateReady:
+				return nil
+			case apiv1.StateFailed:
+				return fmt.Errorf("function %s failed to become ready: %s", name, f.Status.Summary)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("function %s is not ready: %w", name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Get returns the Function with the given name.
+func (k *Knative) Get(ctx context.Context, namespace, name string) (*apiv1.Function, error) {
+	return Get(ctx, k.client, k.kube, namespace, name)
+}
+
+// Env returns the environment variables of the function with their literal values.
+func (k *Knative) Env(ctx context.Context, namespace, name string) ([]apiv1.EnvVar, error) {
+	return Env(ctx, k.client, namespace, name)
+}
+
+// List returns a page of the Functions of a namespace.
+func (k *Knative) List(ctx context.Context, namespace string, opts ListOptions) (*apiv1.FunctionList, error) {
+	return List(ctx, k.client, k.kube, namespace, opts)
+}
+
+// Delete deletes the Knative service of the function.
+func (k *Knative) Delete(ctx context.Context, namespace, name string) error {
+	return service.DeleteKnativeService(ctx, k.client, namespace, name)
+}
@@ -0,0 +1,201 @@
+package resource
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"faas-api/internal/service"
+	apiv1 "faas-api/pkg/api/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Sort orders supported by List. A leading "-" reverses the order.
+const (
+	SortName    = "name"
+	SortUpdated = "updated"
+)
+
+// MaxLimit is the largest page size accepted by List.
+const MaxLimit = 500
+
+// ErrInvalidListOptions is returned for malformed list options.
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+// ListOptions filter, order and paginate List.
+type ListOptions struct {
+	LabelSelector string
+	Status        []string // function states to keep, see apiv1.State*
+	Sort          string   // "name", "-name", "updated" or "-updated"
+	Limit         int      // 0 means no limit
+	Continue      string
+}
+
+// pageToken is the opaque continue token handed to clients. Listings in name order
+// are paginated by Kubernetes itself; other orders need the whole list and use an offset.
+type pageToken struct {
+	Continue string `json:"c,omitempty"`
+	Offset   int    `json:"o,omitempty"`
+	Sort     string `json:"s,omitempty"`
+}
+
+func (o ListOptions) validate() error {
+	if _, err := labels.Parse(o.LabelSelector); err != nil {
+		return fmt.Errorf("%w: labelSelector: %v", ErrInvalidListOptions, err)
+	}
+	for _, s := range o.Status {
+		if !slices.Contains([]string{apiv1.StateReady, apiv1.StateDeploying, apiv1.StateDegraded, apiv1.StateFailed, apiv1.StateUnknown}, s) {
+			return fmt.Errorf("%w: unknown status %q", ErrInvalidListOptions, s)
+		}
+	}
+	switch strings.TrimPrefix(o.Sort, "-") {
+	case "", SortName, SortUpdated:
+	default:
+		return fmt.Errorf("%w: sort must be %q or %q, optionally prefixed with a minus sign", ErrInvalidListOptions, SortName, SortUpdated)
+	}
+	if o.Limit < 0 || o.Limit > MaxLimit {
+		return fmt.Errorf("%w: limit must be between 0 and %d", ErrInvalidListOptions, MaxLimit)
+	}
+	return nil
+}
+
+// needsFullList reports whether the whole namespace must be read to honour the order.
+func (o ListOptions) needsFullList() bool {
+	return o.Sort != "" && o.Sort != SortName
+}
+
+func (o ListOptions) token() (pageToken, error) {
+	var t pageToken
+	if o.Continue == "" {
+		return t, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(o.Continue)
+	if err == nil {
+		err = json.Unmarshal(raw, &t)
+	}
+	if err != nil {
+		return t, fmt.Errorf("%w: malformed continue token", ErrInvalidListOptions)
+	}
+	if t.Sort != o.Sort {
+		return t, fmt.Errorf("%w: continue token was issued for a different sort order", ErrInvalidListOptions)
+	}
+	return t, nil
+}
+
+func encodeToken(t pageToken) string {
+	raw, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func (o ListOptions) keep(fn *apiv1.Function) bool {
+	return len(o.Status) == 0 || slices.Contains(o.Status, fn.Status.State)
+}
+
+// listByName pages through Kubernetes in name order, requesting only as many items as
+// are still missing so that the continue token never skips an item.
+func listByName(ctx context.Context, client dynamic.Interface, kube kubernetes.Interface, namespace string, opts ListOptions) ([]apiv1.Function, string, error) {
+	token, err := opts.token()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var items []apiv1.Function
+	cont := token.Continue
+	for {
+		listOpts := metav1.ListOptions{LabelSelector: opts.LabelSelector, Continue: cont}
+		if opts.Limit > 0 {
+			listOpts.Limit = int64(opts.Limit - len(items))
+		}
+
+		page, err := service.ListKnativeServicePage(ctx, client, namespace, listOpts)
+		if err != nil {
+			return nil, "", err
+		}
+		converted, err := convert(ctx, client, kube, namespace, page.Items)
+		if err != nil {
+			return nil, "", err
+		}
+		for i := range converted {
+			if opts.keep(&converted[i]) {
+				items = append(items, converted[i])
+			}
+		}
+
+		cont = page.GetContinue()
+		if cont == "" {
+			return items, "", nil
+		}
+		if opts.Limit > 0 && len(items) >= opts.Limit {
+			return items, encodeToken(pageToken{Continue: cont, Sort: opts.Sort}), nil
+		}
+	}
+}
+
+// listSorted reads every function of the namespace, sorts them and returns the page
+// starting at the offset of the continue token.
+func listSorted(ctx context.Context, client dynamic.Interface, kube kubernetes.Interface, namespace string, opts ListOptions) ([]apiv1.Function, string, error) {
+	token, err := opts.token()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var all []unstructured.Unstructured
+	cont := ""
+	for {
+		page, err := service.ListKnativeServicePage(ctx, client, namespace, metav1.ListOptions{
+			LabelSelector: opts.LabelSelector,
+			Limit:         MaxLimit,
+			Continue:      cont,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		all = append(all, page.Items...)
+		if cont = page.GetContinue(); cont == "" {
+			break
+		}
+	}
+
+	converted, err := convert(ctx, client, kube, namespace, all)
+	if err != nil {
+		return nil, "", err
+	}
+	var items []apiv1.Function
+	for i := range converted {
+		if opts.keep(&converted[i]) {
+			items = append(items, converted[i])
+		}
+	}
+
+	desc := strings.HasPrefix(opts.Sort, "-")
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if desc {
+			a, b = b, a
+		}
+		if strings.TrimPrefix(opts.Sort, "-") == SortUpdated && !a.UpdatedAt.Equal(b.UpdatedAt) {
+			return a.UpdatedAt.Before(b.UpdatedAt)
+		}
+		return a.Name < b.Name
+	})
+
+	if token.Offset > len(items) {
+		token.Offset = len(items)
+	}
+	items = items[token.Offset:]
+	if opts.Limit > 0 && len(items) > opts.Limit {
+		next := encodeToken(pageToken{Offset: token.Offset + opts.Limit, Sort: opts.Sort})
+		return items[:opts.Limit], next, nil
+	}
+	return items, "", nil
+}
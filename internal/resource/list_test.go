@@ -0,0 +1,102 @@
+package resource
+
+import (
+	"testing"
+
+	"faas-api/internal/service"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func listedService(name, team, ready, updated string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":              name,
+			"namespace":         "github-jane",
+			"creationTimestamp": "2025-01-01T00:00:00Z",
+			"labels":            map[string]interface{}{"team": team},
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": ready, "lastTransitionTime": updated},
+			},
+		},
+	}}
+}
+
+func newListClient() dynamic.Interface {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Group: "serving.knative.dev", Version: "v1", Resource: "services"}: "ServiceList",
+		service.RevisionGVR: "RevisionList",
+	},
+		listedService("alpha", "red", "True", "2025-03-01T00:00:00Z"),
+		listedService("bravo", "blue", "False", "2025-01-01T00:00:00Z"),
+		listedService("charlie", "red", "True", "2025-02-01T00:00:00Z"),
+		listedService("delta", "red", "True", "2025-04-01T00:00:00Z"),
+	)
+}
+
+func functionNames(items []apiv1.Function) []string {
+	var names []string
+	for _, fn := range items {
+		names = append(names, fn.Name)
+	}
+	return names
+}
+
+func TestListFilters(t *testing.T) {
+	client := newListClient()
+
+	list, err := List(t.Context(), client, nil, "github-jane", ListOptions{LabelSelector: "team=red", Status: []string{"ready"}})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 3)
+	for _, fn := range list.Items {
+		require.Equal(t, "red", fn.Labels["team"])
+		require.Equal(t, "ready", fn.Status.State)
+	}
+
+	list, err = List(t.Context(), client, nil, "github-jane", ListOptions{Status: []string{"failed"}})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	require.Equal(t, "bravo", list.Items[0].Name)
+}
+
+func TestListSortedByUpdateWithPagination(t *testing.T) {
+	client := newListClient()
+	opts := ListOptions{Sort: "-updated", Limit: 3}
+
+	first, err := List(t.Context(), client, nil, "github-jane", opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"delta", "alpha", "charlie"}, functionNames(first.Items))
+	require.NotEmpty(t, first.Continue)
+
+	opts.Continue = first.Continue
+	second, err := List(t.Context(), client, nil, "github-jane", opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bravo"}, functionNames(second.Items))
+	require.Empty(t, second.Continue)
+}
+
+func TestListRejectsInvalidOptions(t *testing.T) {
+	client := newListClient()
+
+	for _, opts := range []ListOptions{
+		{LabelSelector: "team in (red"},
+		{Status: []string{"sleeping"}},
+		{Sort: "size"},
+		{Limit: MaxLimit + 1},
+		{Continue: "not-a-token"},
+		{Sort: "updated", Continue: encodeToken(pageToken{Offset: 1, Sort: "name"})},
+	} {
+		_, err := List(t.Context(), client, nil, "github-jane", opts)
+		require.ErrorIs(t, err, ErrInvalidListOptions, "options %+v", opts)
+	}
+}
@@ -0,0 +1,418 @@
+// Package resource converts Knative objects into the public faas.dev/v1 API types.
+package resource
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"faas-api/internal/diagnostics"
+	"faas-api/internal/k8/logs"
+	"faas-api/internal/service"
+	apiv1 "faas-api/pkg/api/v1"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Knative annotations that carry the scaling settings of a revision template.
+const (
+	minScaleAnnotation = "autoscaling.knative.dev/min-scale"
+	maxScaleAnnotation = "autoscaling.knative.dev/max-scale"
+	targetAnnotation   = "autoscaling.knative.dev/target"
+	visibilityLabel    = "networking.knative.dev/visibility"
+)
+
+// FromKnative converts a Knative Service, the revisions of the namespace and an
+// optional diagnosis into a Function. Revisions of other services are ignored. The
+// literal values of environment variables are redacted; see Env.
+func FromKnative(ksvc *unstructured.Unstructured, revisions []unstructured.Unstructured, diag *diagnostics.Diagnosis) (*apiv1.Function, error) {
+	obj := ksvc.Object
+	fn := &apiv1.Function{
+		APIVersion: apiv1.APIVersion,
+		Kind:       apiv1.KindFunction,
+		Name:       ksvc.GetName(),
+		Namespace:  ksvc.GetNamespace(),
+		Visibility: service.VisibilityPublic,
+		Runtime:    ksvc.GetAnnotations()[service.RuntimeAnnotation],
+		CreatedAt:  ksvc.GetCreationTimestamp().UTC(),
+		Status:     apiv1.Status{State: apiv1.StateUnknown},
+	}
+	if ksvc.GetLabels()[visibilityLabel] == "cluster-local" {
+		fn.Visibility = service.VisibilityPrivate
+	}
+	fn.Description = ksvc.GetAnnotations()[service.DescriptionAnnotation]
+	for k, v := range ksvc.GetLabels() {
+		if service.IsReservedLabel(k) {
+			continue
+		}
+		if fn.Labels == nil {
+			fn.Labels = map[string]string{}
+		}
+		fn.Labels[k] = v
+	}
+
+	fn.URL, _, _ = unstructured.NestedString(obj, "status", "url")
+	fn.Address, _, _ = unstructured.NestedString(obj, "status", "address", "url")
+
+	containers, _, err := unstructured.NestedSlice(obj, "spec", "template", "spec", "containers")
+	if err != nil {
+		return nil, fmt.Errorf("invalid containers in knative service %s: %w", fn.Name, err)
+	}
+	if len(containers) > 0 {
+		container, ok := containers[0].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid container in knative service %s", fn.Name)
+		}
+		fn.Image, _, _ = unstructured.NestedString(container, "image")
+		fn.Env = apiv1.RedactEnv(convertEnv(container))
+		fn.Resources.Requests = resourceList(container, "requests")
+		fn.Resources.Limits = resourceList(container, "limits")
+	}
+
+	templateAnnotations, _, _ := unstructured.NestedStringMap(obj, "spec", "template", "metadata", "annotations")
+	fn.Scaling.MinScale = intAnnotation(templateAnnotations, minScaleAnnotation)
+	fn.Scaling.MaxScale = intAnnotation(templateAnnotations, maxScaleAnnotation)
+	fn.Scaling.Target = intAnnotation(templateAnnotations, targetAnnotation)
+	if v, found, _ := unstructured.NestedInt64(obj, "spec", "template", "spec", "containerConcurrency"); found {
+		fn.Scaling.ConcurrencyLimit = int(v)
+	}
+	if v, found, _ := unstructured.NestedInt64(obj, "spec", "template", "spec", "timeoutSeconds"); found {
+		fn.Scaling.TimeoutSeconds = int(v)
+	}
+
+	traffic := map[string]int{}
+	trafficTargets, _, _ := unstructured.NestedSlice(obj, "status", "traffic")
+	for _, t := range trafficTargets {
+		if target, ok := t.(map[string]interface{}); ok {
+			name, _, _ := unstructured.NestedString(target, "revisionName")
+			percent, _, _ := unstructured.NestedInt64(target, "percent")
+			traffic[name] += int(percent)
+		}
+	}
+
+	latestCreated, _, _ := unstructured.NestedString(obj, "status", "latestCreatedRevisionName")
+	for i := range revisions {
+		rev := &revisions[i]
+		if rev.GetLabels()[logs.ServiceLabel] != fn.Name {
+			continue
+		}
+		r := apiv1.Revision{
+			Name:           rev.GetName(),
+			Ready:          conditionTrue(rev.Object, "Ready"),
+			TrafficPercent: traffic[rev.GetName()],
+			ImageDigest:    imageDigest(rev.Object),
+			CreatedAt:      rev.GetCreationTimestamp().UTC(),
+		}
+		if r.Name == latestCreated {
+			fn.ImageDigest = r.ImageDigest
+		}
+		fn.Revisions = append(fn.Revisions, r)
+	}
+	sort.Slice(fn.Revisions, func(i, j int) bool { return fn.Revisions[i].CreatedAt.After(fn.Revisions[j].CreatedAt) })
+
+	fn.UpdatedAt = fn.CreatedAt
+	conditions, _, _ := unstructured.NestedSlice(obj, "status", "conditions")
+	for _, c := range conditions {
+		if cond, ok := c.(map[string]interface{}); ok {
+			raw, _, _ := unstructured.NestedString(cond, "lastTransitionTime")
+			if t, err := time.Parse(time.RFC3339, raw); err == nil && t.After(fn.UpdatedAt) {
+				fn.UpdatedAt = t.UTC()
+			}
+		}
+	}
+
+	if diag != nil {
+		fn.Status = convertStatus(diag)
+	}
+
+	return fn, nil
+}
+
+// ToKnative converts the configurable parts of a Function into a Knative Service.
+// Redacted environment variable values cannot be restored and must be merged by the caller.
+func ToKnative(fn *apiv1.Function) *unstructured.Unstructured {
+	metadata := map[string]interface{}{
+		"name":      fn.Name,
+		"namespace": fn.Namespace,
+	}
+	labels := map[string]interface{}{}
+	for k, v := range fn.Labels {
+		labels[k] = v
+	}
+	if fn.Visibility == service.VisibilityPrivate {
+		labels[visibilityLabel] = "cluster-local"
+	}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	metaAnnotations := map[string]interface{}{}
+	if fn.Runtime != "" {
+		metaAnnotations[service.RuntimeAnnotation] = fn.Runtime
+	}
+	if fn.Description != "" {
+		metaAnnotations[service.DescriptionAnnotation] = fn.Description
+	}
+	if len(metaAnnotations) > 0 {
+		metadata["annotations"] = metaAnnotations
+	}
+
+	container := map[string]interface{}{"image": fn.Image}
+	if len(fn.Env) > 0 {
+		env := make([]interface{}, 0, len(fn.Env))
+		for _, e := range fn.Env {
+			entry := map[string]interface{}{"name": e.Name}
+			if e.SecretRef != nil {
+				entry["valueFrom"] = map[string]interface{}{
+					"secretKeyRef": map[string]interface{}{"name": e.SecretRef.Name, "key": e.SecretRef.Key},
+				}
+			} else {
+				entry["value"] = e.Value
+			}
+			env = append(env, entry)
+		}
+		container["env"] = env
+	}
+	resources := map[string]interface{}{}
+	if len(fn.Resources.Requests) > 0 {
+		resources["requests"] = toInterfaceMap(fn.Resources.Requests)
+	}
+	if len(fn.Resources.Limits) > 0 {
+		resources["limits"] = toInterfaceMap(fn.Resources.Limits)
+	}
+	if len(resources) > 0 {
+		container["resources"] = resources
+	}
+
+	templateSpec := map[string]interface{}{
+		"containers": []interface{}{container},
+	}
+	if fn.Scaling.ConcurrencyLimit > 0 {
+		templateSpec["containerConcurrency"] = int64(fn.Scaling.ConcurrencyLimit)
+	}
+	if fn.Scaling.TimeoutSeconds > 0 {
+		templateSpec["timeoutSeconds"] = int64(fn.Scaling.TimeoutSeconds)
+	}
+	template := map[string]interface{}{"spec": templateSpec}
+
+	annotations := map[string]interface{}{}
+	for key, v := range map[string]*int{
+		minScaleAnnotation: fn.Scaling.MinScale,
+		maxScaleAnnotation: fn.Scaling.MaxScale,
+		targetAnnotation:   fn.Scaling.Target,
+	} {
+		if v != nil {
+			annotations[key] = strconv.Itoa(*v)
+		}
+	}
+	if len(annotations) > 0 {
+		template["metadata"] = map[string]interface{}{"annotations": annotations}
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Service",
+		"metadata":   metadata,
+		"spec":       map[string]interface{}{"template": template},
+	}}
+}
+
+// Env returns the environment variables of the function with their literal values.
+func Env(ctx context.Context, client dynamic.Interface, namespace, name string) ([]apiv1.EnvVar, error) {
+	ksvc, err := service.GetKnativeServiceObject(ctx, client, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	containers, _, err := unstructured.NestedSlice(ksvc.Object, "spec", "template", "spec", "containers")
+	if err != nil {
+		return nil, fmt.Errorf("invalid containers in knative service %s: %w", name, err)
+	}
+	if len(containers) == 0 {
+		return nil, nil
+	}
+	container, ok := containers[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid container in knative service %s", name)
+	}
+	return convertEnv(container), nil
+}
+
+// Get returns the Function with the given name.
+func Get(ctx context.Context, client dynamic.Interface, kube kubernetes.Interface, namespace, name string) (*apiv1.Function, error) {
+	ksvc, err := service.GetKnativeServiceObject(ctx, client, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	list, err := convert(ctx, client, kube, namespace, []unstructured.Unstructured{*ksvc})
+	if err != nil {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+// List returns a page of the Functions of a namespace. An empty namespace yields an
+// empty list.
+func List(ctx context.Context, client dynamic.Interface, kube kubernetes.Interface, namespace string, opts ListOptions) (*apiv1.FunctionList, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var (
+		items []apiv1.Function
+		next  string
+		err   error
+	)
+	if opts.needsFullList() {
+		items, next, err = listSorted(ctx, client, kube, namespace, opts)
+	} else {
+		items, next, err = listByName(ctx, client, kube, namespace, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []apiv1.Function{}
+	}
+
+	return &apiv1.FunctionList{
+		APIVersion: apiv1.APIVersion,
+		Kind:       apiv1.KindList,
+		Items:      items,
+		Continue:   next,
+	}, nil
+}
+
+func convert(ctx context.Context, client dynamic.Interface, kube kubernetes.Interface, namespace string, ksvcs []unstructured.Unstructured) ([]apiv1.Function, error) {
+	items := make([]apiv1.Function, 0, len(ksvcs))
+	if len(ksvcs) == 0 {
+		return items, nil
+	}
+
+	revisions, err := service.ListRevisionObjects(ctx, client, namespace)
+	if err != nil {
+		log.WithError(err).WithField("namespace", namespace).Warn("failed to list revisions")
+	}
+
+	typed := make([]service.KnativeService, 0, len(ksvcs))
+	for i := range ksvcs {
+		svc, err := service.UnstructuredToService(&ksvcs[i])
+		if err != nil {
+			return nil, err
+		}
+		typed = append(typed, *svc)
+	}
+	diagnosed, err := diagnostics.InspectAll(ctx, client, kube, namespace, typed)
+	if err != nil {
+		log.WithError(err).WithField("namespace", namespace).Warn("failed to diagnose functions")
+	}
+
+	for i := range ksvcs {
+		var diag *diagnostics.Diagnosis
+		if d, ok := diagnosed[ksvcs[i].GetName()]; ok {
+			diag = &d
+		}
+		fn, err := FromKnative(&ksvcs[i], revisions, diag)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *fn)
+	}
+	return items, nil
+}
+
+func convertStatus(d *diagnostics.Diagnosis) apiv1.Status {
+	status := apiv1.Status{State: string(d.State), Summary: d.Summary}
+	for _, p := range d.Problems {
+		status.Problems = append(status.Problems, apiv1.Problem{
+			Source:      p.Source,
+			Name:        p.Name,
+			Reason:      p.Reason,
+			Message:     p.Message,
+			Explanation: p.Explanation,
+		})
+	}
+	return status
+}
+
+func convertEnv(container map[string]interface{}) []apiv1.EnvVar {
+	raw, _, _ := unstructured.NestedSlice(container, "env")
+	var env []apiv1.EnvVar
+	for _, item := range raw {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		e := apiv1.EnvVar{}
+		e.Name, _, _ = unstructured.NestedString(entry, "name")
+		if ref, found, _ := unstructured.NestedStringMap(entry, "valueFrom", "secretKeyRef"); found {
+			e.SecretRef = &apiv1.SecretRef{Name: ref["name"], Key: ref["key"]}
+		} else {
+			e.Value, _, _ = unstructured.NestedString(entry, "value")
+		}
+		env = append(env, e)
+	}
+	return env
+}
+
+func resourceList(container map[string]interface{}, kind string) apiv1.ResourceList {
+	raw, found, _ := unstructured.NestedMap(container, "resources", kind)
+	if !found || len(raw) == 0 {
+		return nil
+	}
+	list := apiv1.ResourceList{}
+	for k, v := range raw {
+		list[k] = fmt.Sprint(v)
+	}
+	return list
+}
+
+func toInterfaceMap(list apiv1.ResourceList) map[string]interface{} {
+	m := make(map[string]interface{}, len(list))
+	for k, v := range list {
+		m[k] = v
+	}
+	return m
+}
+
+func intAnnotation(annotations map[string]string, key string) *int {
+	v, ok := annotations[key]
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+func conditionTrue(obj map[string]interface{}, conditionType string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if t, _, _ := unstructured.NestedString(cond, "type"); t == conditionType {
+			status, _, _ := unstructured.NestedString(cond, "status")
+			return status == "True"
+		}
+	}
+	return false
+}
+
+func imageDigest(revision map[string]interface{}) string {
+	statuses, _, _ := unstructured.NestedSlice(revision, "status", "containerStatuses")
+	for _, s := range statuses {
+		if status, ok := s.(map[string]interface{}); ok {
+			if digest, _, _ := unstructured.NestedString(status, "imageDigest"); digest != "" {
+				return digest
+			}
+		}
+	}
+	return ""
+}
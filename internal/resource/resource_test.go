@@ -0,0 +1,188 @@
+package resource
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"faas-api/internal/diagnostics"
+	"faas-api/internal/service"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func intPtr(i int) *int { return &i }
+
+func knativeService() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":              "hello",
+			"namespace":         "github-jane",
+			"creationTimestamp": "2025-05-01T10:00:00Z",
+			"annotations":       map[string]interface{}{service.RuntimeAnnotation: "nodejs"},
+			"managedFields":     []interface{}{map[string]interface{}{"manager": "faas-api"}},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{"autoscaling.knative.dev/max-scale": "5"},
+				},
+				"spec": map[string]interface{}{
+					"containerConcurrency": int64(10),
+					"containers": []interface{}{map[string]interface{}{
+						"image": "index.docker.io/jane/hello",
+						"env": []interface{}{
+							map[string]interface{}{"name": "GREETING", "value": "hi"},
+							map[string]interface{}{"name": "API_TOKEN", "value": "s3cr3t"},
+							map[string]interface{}{"name": "DB_PASSWORD", "valueFrom": map[string]interface{}{
+								"secretKeyRef": map[string]interface{}{"name": "db", "key": "password"},
+							}},
+						},
+						"resources": map[string]interface{}{
+							"limits": map[string]interface{}{"memory": "128Mi"},
+						},
+					}},
+				},
+			},
+		},
+		"status": map[string]interface{}{
+			"url":                       "http://hello.github-jane.example.com",
+			"address":                   map[string]interface{}{"url": "http://hello.github-jane.svc.cluster.local"},
+			"latestCreatedRevisionName": "hello-00002",
+			"latestReadyRevisionName":   "hello-00002",
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True", "lastTransitionTime": "2025-05-02T10:00:00Z"},
+			},
+			"traffic": []interface{}{
+				map[string]interface{}{"revisionName": "hello-00002", "percent": int64(100), "latestRevision": true},
+			},
+		},
+	}}
+}
+
+func revision(name, created, digest string) unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Revision",
+		"metadata": map[string]interface{}{
+			"name":              name,
+			"namespace":         "github-jane",
+			"creationTimestamp": created,
+			"labels":            map[string]interface{}{"serving.knative.dev/service": "hello"},
+		},
+		"status": map[string]interface{}{
+			"conditions":        []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}},
+			"containerStatuses": []interface{}{map[string]interface{}{"name": "user-container", "imageDigest": digest}},
+		},
+	}}
+}
+
+func TestFromKnative(t *testing.T) {
+	revisions := []unstructured.Unstructured{
+		revision("hello-00001", "2025-05-01T10:00:00Z", "sha256:aaa"),
+		revision("hello-00002", "2025-05-02T10:00:00Z", "sha256:bbb"),
+	}
+	diag := &diagnostics.Diagnosis{State: diagnostics.StateReady, Summary: "ok"}
+
+	fn, err := FromKnative(knativeService(), revisions, diag)
+	require.NoError(t, err)
+
+	require.Equal(t, apiv1.APIVersion, fn.APIVersion)
+	require.Equal(t, "hello", fn.Name)
+	require.Equal(t, "nodejs", fn.Runtime)
+	require.Equal(t, "public", fn.Visibility)
+	require.Equal(t, "http://hello.github-jane.example.com", fn.URL)
+	require.Equal(t, "sha256:bbb", fn.ImageDigest)
+	require.Equal(t, []apiv1.EnvVar{
+		{Name: "GREETING", Value: apiv1.RedactedValue},
+		{Name: "API_TOKEN", Value: apiv1.RedactedValue},
+		{Name: "DB_PASSWORD", SecretRef: &apiv1.SecretRef{Name: "db", Key: "password"}},
+	}, fn.Env)
+	require.Equal(t, intPtr(5), fn.Scaling.MaxScale)
+	require.Equal(t, 10, fn.Scaling.ConcurrencyLimit)
+	require.Equal(t, apiv1.ResourceList{"memory": "128Mi"}, fn.Resources.Limits)
+	require.Equal(t, "ready", fn.Status.State)
+	require.Len(t, fn.Revisions, 2)
+	require.Equal(t, "hello-00002", fn.Revisions[0].Name, "newest revision first")
+	require.Equal(t, 100, fn.Revisions[0].TrafficPercent)
+	require.Equal(t, time.Date(2025, 5, 2, 10, 0, 0, 0, time.UTC), fn.UpdatedAt)
+
+	raw, err := json.Marshal(fn)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "managedFields")
+	require.NotContains(t, string(raw), "s3cr3t")
+	require.NotContains(t, string(raw), `"hi"`, "every literal value is redacted")
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	fn, err := FromKnative(knativeService(), []unstructured.Unstructured{revision("hello-00002", "2025-05-02T10:00:00Z", "sha256:bbb")}, nil)
+	require.NoError(t, err)
+
+	raw, err := json.Marshal(fn)
+	require.NoError(t, err)
+
+	var decoded apiv1.Function
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+	require.Equal(t, *fn, decoded)
+}
+
+func TestKnativeRoundTrip(t *testing.T) {
+	fn := &apiv1.Function{
+		APIVersion:  apiv1.APIVersion,
+		Kind:        apiv1.KindFunction,
+		Name:        "hello",
+		Namespace:   "github-jane",
+		Description: "Says hello",
+		Labels:      map[string]string{"team": "red"},
+		Visibility:  "private",
+		Runtime:     "nodejs",
+		Image:       "index.docker.io/jane/hello",
+		Env: []apiv1.EnvVar{
+			{Name: "GREETING", Value: "hi"},
+			{Name: "DB_PASSWORD", SecretRef: &apiv1.SecretRef{Name: "db", Key: "password"}},
+		},
+		Scaling: apiv1.Scaling{
+			MinScale:         intPtr(1),
+			MaxScale:         intPtr(3),
+			Target:           intPtr(50),
+			ConcurrencyLimit: 20,
+			TimeoutSeconds:   120,
+		},
+		Resources: apiv1.Resources{
+			Requests: apiv1.ResourceList{"cpu": "100m"},
+			Limits:   apiv1.ResourceList{"cpu": "500m", "memory": "256Mi"},
+		},
+		Status: apiv1.Status{State: apiv1.StateUnknown},
+	}
+
+	back, err := FromKnative(ToKnative(fn), nil, nil)
+	require.NoError(t, err)
+	env := fn.Env
+	fn.Env = apiv1.RedactEnv(env)
+	require.Equal(t, fn, back)
+
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), ToKnative(&apiv1.Function{Name: "hello", Namespace: "github-jane", Env: env}))
+	values, err := Env(t.Context(), client, "github-jane", "hello")
+	require.NoError(t, err)
+	require.Equal(t, env, values, "Env returns the literal values")
+}
+
+func TestListEmptyNamespace(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Group: "serving.knative.dev", Version: "v1", Resource: "services"}: "ServiceList",
+		service.RevisionGVR: "RevisionList",
+	})
+
+	list, err := List(t.Context(), client, nil, "github-jane", ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, apiv1.KindList, list.Kind)
+	require.NotNil(t, list.Items)
+	require.Empty(t, list.Items)
+}
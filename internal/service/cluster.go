@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"faas-api/internal/config"
+
+	log "github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ErrKnativeMissing is returned when the cluster does not serve the Knative Serving API.
+var ErrKnativeMissing = errors.New("the Knative Serving CRDs are not installed")
+
+// Cluster describes the cluster the clients are connected to.
+type Cluster struct {
+	// Source is "in-cluster" or the kubeconfig context used.
+	Source string
+	Host   string
+	// User is the identity the API server authenticated the clients as.
+	User string
+}
+
+// Connect returns clients for the cluster selected by cfg: a dynamic client and a
+// typed client for APIs the dynamic client cannot serve, such as pod logs. It logs
+// which cluster and identity it connected as and checks that Knative Serving is
+// installed.
+func Connect(cfg config.Kubernetes) (dynamic.Interface, kubernetes.Interface, error) {
+	restConfig, cluster, err := restConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	kube, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cluster.User = whoAmI(ctx, kube)
+	log.WithFields(log.Fields{
+		"source": cluster.Source,
+		"host":   cluster.Host,
+		"user":   cluster.User,
+	}).Info("connected to kubernetes cluster")
+
+	if err := checkKnative(kube.Discovery()); err != nil {
+		return nil, nil, fmt.Errorf("cluster %s: %w", cluster.Host, err)
+	}
+	return client, kube, nil
+}
+
+// restConfig uses the pod's service account when running in a cluster and neither
+// a kubeconfig nor a context is configured, and the kubeconfig otherwise.
+func restConfig(cfg config.Kubernetes) (*rest.Config, Cluster, error) {
+	if cfg.Kubeconfig == "" && cfg.Context == "" {
+		c, err := rest.InClusterConfig()
+		if err == nil {
+			return c, Cluster{Source: "in-cluster", Host: c.Host}, nil
+		}
+		if !errors.Is(err, rest.ErrNotInCluster) {
+			return nil, Cluster{}, fmt.Errorf("failed to get in-cluster config: %w", err)
+		}
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if cfg.Kubeconfig != "" {
+		rules.Precedence = filepath.SplitList(cfg.Kubeconfig)
+	}
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: cfg.Context})
+
+	raw, err := loader.RawConfig()
+	if err != nil {
+		return nil, Cluster{}, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	c, err := loader.ClientConfig()
+	if err != nil {
+		return nil, Cluster{}, fmt.Errorf("not running in a cluster and no usable kubeconfig (set KUBECONFIG or KUBE_CONTEXT): %w", err)
+	}
+	contextName := raw.CurrentContext
+	if cfg.Context != "" {
+		contextName = cfg.Context
+	}
+	return c, Cluster{Source: "kubeconfig context " + contextName, Host: c.Host}, nil
+}
+
+// CheckAPI reports whether the Kubernetes API server is ready and accepts the
+// credentials of kube.
+func CheckAPI(ctx context.Context, kube kubernetes.Interface) error {
+	if err := kube.Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx).Error(); err != nil {
+		return fmt.Errorf("kubernetes API is not available: %w", err)
+	}
+	return nil
+}
+
+// whoAmI asks the API server who the clients are authenticated as. Clusters
+// older than Kubernetes 1.28 do not support this, so failures are only logged.
+func whoAmI(ctx context.Context, client kubernetes.Interface) string {
+	review, err := client.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil {
+		log.WithError(err).Warn("failed to look up the kubernetes identity")
+		return "unknown"
+	}
+	return review.Status.UserInfo.Username
+}
+
+// checkKnative verifies that the cluster serves Knative services and revisions.
+func checkKnative(client discovery.DiscoveryInterface) error {
+	groupVersion := knativeServiceGVR.GroupVersion().String()
+	resources, err := client.ServerResourcesForGroupVersion(groupVersion)
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%w: %s is not served, install Knative Serving (https://knative.dev/docs/install/) and restart", ErrKnativeMissing, groupVersion)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to discover %s: %w", groupVersion, err)
+	}
+
+	for _, want := range []string{knativeServiceGVR.Resource, RevisionGVR.Resource} {
+		found := false
+		for _, r := range resources.APIResources {
+			if r.Name == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %s %s is not served, install Knative Serving (https://knative.dev/docs/install/) and restart", ErrKnativeMissing, groupVersion, want)
+		}
+	}
+	return nil
+}
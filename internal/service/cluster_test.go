@@ -0,0 +1,69 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"faas-api/internal/config"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+current-context: kind-dev
+clusters:
+- name: kind-dev
+  cluster: {server: "https://127.0.0.1:6443"}
+- name: staging
+  cluster: {server: "https://staging.example.com"}
+users:
+- name: dev
+  user: {token: dev-token}
+contexts:
+- name: kind-dev
+  context: {cluster: kind-dev, user: dev}
+- name: staging
+  context: {cluster: staging, user: dev}
+`
+
+func TestRestConfigFromKubeconfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte(testKubeconfig), 0600))
+
+	c, cluster, err := restConfig(config.Kubernetes{Kubeconfig: path})
+	require.NoError(t, err)
+	require.Equal(t, "https://127.0.0.1:6443", c.Host)
+	require.Equal(t, "dev-token", c.BearerToken)
+	require.Equal(t, "kubeconfig context kind-dev", cluster.Source)
+
+	c, cluster, err = restConfig(config.Kubernetes{Kubeconfig: path, Context: "staging"})
+	require.NoError(t, err)
+	require.Equal(t, "https://staging.example.com", c.Host)
+	require.Equal(t, "kubeconfig context staging", cluster.Source)
+
+	_, _, err = restConfig(config.Kubernetes{Kubeconfig: path, Context: "prod"})
+	require.ErrorContains(t, err, "prod")
+}
+
+func TestCheckKnative(t *testing.T) {
+	discovery := kubefake.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+
+	err := checkKnative(discovery)
+	require.ErrorIs(t, err, ErrKnativeMissing)
+	require.ErrorContains(t, err, "install Knative Serving")
+
+	discovery.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "serving.knative.dev/v1",
+		APIResources: []metav1.APIResource{{Name: "services"}},
+	}}
+	require.ErrorIs(t, checkKnative(discovery), ErrKnativeMissing, "revisions are missing")
+
+	discovery.Resources[0].APIResources = append(discovery.Resources[0].APIResources, metav1.APIResource{Name: "revisions"})
+	require.NoError(t, checkKnative(discovery))
+}
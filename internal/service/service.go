@@ -4,17 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"faas-api/internal/logging"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/rest"
 )
 
-var Clientset dynamic.Interface
-
 // knativeServiceGVR defines the GroupVersionResource for Knative Services.
 var knativeServiceGVR = schema.GroupVersionResource{
 	Group:    "serving.knative.dev",
@@ -22,6 +22,13 @@ var knativeServiceGVR = schema.GroupVersionResource{
 	Resource: "services",
 }
 
+// RevisionGVR defines the GroupVersionResource for Knative Revisions.
+var RevisionGVR = schema.GroupVersionResource{
+	Group:    "serving.knative.dev",
+	Version:  "v1",
+	Resource: "revisions",
+}
+
 type ServiceOwner struct {
 	Name     string
 	Email    string
@@ -32,11 +39,79 @@ type Service struct {
 	Image        string
 	Namespace    string
 	FunctionName string
+	Visibility   string
+	Runtime      string
+	Description  string
+	Labels       map[string]string
+	Env          []EnvVar
 	Owner        ServiceOwner
 }
 
+// EnvVar is an environment variable set on the function container.
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// String hides the value, which may be a credential, from logs.
+func (e EnvVar) String() string { return e.Name + "=" + logging.Redacted }
+
+// LogValue hides the value from the JSON log formatter, which does not call String.
+func (e EnvVar) LogValue() interface{} { return EnvVar{Name: e.Name, Value: logging.Redacted} }
+
+// LogValue hides the values of the environment of s from the JSON log formatter.
+func (s Service) LogValue() interface{} {
+	env := make([]EnvVar, len(s.Env))
+	for i, e := range s.Env {
+		env[i] = e.LogValue().(EnvVar)
+	}
+	s.Env = env
+	return s
+}
+
+// RuntimeAnnotation records the runtime a function was built with.
+const RuntimeAnnotation = "faas.dev/runtime"
+
+// DescriptionAnnotation holds the free-form description given at deploy time.
+const DescriptionAnnotation = "faas.dev/description"
+
 const apiVersion = "serving.knative.dev/v1"
 
+// Function visibility values. Private functions are deployed cluster-local and
+// can only be reached through the platform's invocation gateway.
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+// visibilityLabel is the Knative label that controls whether a service is
+// exposed through the public ingress.
+const visibilityLabel = "networking.knative.dev/visibility"
+
+// reservedLabelDomains are managed by the platform, Knative or Kubernetes and may not
+// be set by users.
+var reservedLabelDomains = []string{"knative.dev", "faas.dev", "kubernetes.io", "k8s.io"}
+
+// IsReservedLabel reports whether a label key belongs to a reserved domain.
+func IsReservedLabel(key string) bool {
+	prefix, _, found := strings.Cut(key, "/")
+	if !found {
+		return false
+	}
+	for _, domain := range reservedLabelDomains {
+		if prefix == domain || strings.HasSuffix(prefix, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidVisibility reports whether v is a supported visibility value.
+// The empty string is accepted and means public.
+func IsValidVisibility(v string) bool {
+	return v == "" || v == VisibilityPublic || v == VisibilityPrivate
+}
+
 // Root structure for Knative Service
 type KnativeService struct {
 	APIVersion string   `json:"apiVersion"`
@@ -49,6 +124,7 @@ type KnativeService struct {
 // Metadata about the Knative Service
 type Metadata struct {
 	Annotations       map[string]string `json:"annotations"`
+	Labels            map[string]string `json:"labels"`
 	CreationTimestamp time.Time         `json:"creationTimestamp"`
 	Generation        int               `json:"generation"`
 	ManagedFields     []ManagedField    `json:"managedFields"`
@@ -140,6 +216,8 @@ type Condition struct {
 	LastTransitionTime time.Time `json:"lastTransitionTime"`
 	Status             string    `json:"status"`
 	Type               string    `json:"type"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
 }
 
 // TrafficStatus for traffic details in status
@@ -149,25 +227,10 @@ type TrafficStatus struct {
 	RevisionName   string `json:"revisionName"`
 }
 
-func ConfigK8Client() error {
-
-	cfg, err := rest.InClusterConfig()
-	if err != nil {
-		return fmt.Errorf("failed to get in-cluster config: %w", err)
-	}
-
-	Clientset, err = dynamic.NewForConfig(cfg)
-	if err != nil {
-		return fmt.Errorf("failed to create dynamic client: %w", err)
-	}
-
-	return nil
-}
-
-func (s *Service) Deploy(client dynamic.Interface) (*unstructured.Unstructured, error) {
+func (s *Service) Deploy(ctx context.Context, client dynamic.Interface) (*unstructured.Unstructured, error) {
 	unstructuredKsvc := s.toUnstructured()
 	namespace := s.Namespace
-	created, err := client.Resource(knativeServiceGVR).Namespace(namespace).Create(context.Background(), unstructuredKsvc, metav1.CreateOptions{})
+	created, err := client.Resource(knativeServiceGVR).Namespace(namespace).Create(ctx, unstructuredKsvc, metav1.CreateOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create knative service in namespace %s: %w", namespace, err)
 	}
@@ -175,22 +238,52 @@ func (s *Service) Deploy(client dynamic.Interface) (*unstructured.Unstructured,
 }
 
 func (s *Service) toUnstructured() *unstructured.Unstructured {
+	metadata := map[string]interface{}{
+		"name":      s.FunctionName,
+		"namespace": s.Namespace,
+	}
+	labels := map[string]interface{}{}
+	for k, v := range s.Labels {
+		labels[k] = v
+	}
+	if s.Visibility == VisibilityPrivate {
+		labels[visibilityLabel] = "cluster-local"
+	}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+
+	annotations := map[string]interface{}{}
+	if s.Runtime != "" {
+		annotations[RuntimeAnnotation] = s.Runtime
+	}
+	if s.Description != "" {
+		annotations[DescriptionAnnotation] = s.Description
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+
+	container := map[string]interface{}{
+		"image": s.Image,
+	}
+	if len(s.Env) > 0 {
+		env := make([]interface{}, 0, len(s.Env))
+		for _, e := range s.Env {
+			env = append(env, map[string]interface{}{"name": e.Name, "value": e.Value})
+		}
+		container["env"] = env
+	}
+
 	return &unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"apiVersion": apiVersion,
 			"kind":       "Service",
-			"metadata": map[string]interface{}{
-				"name":      s.FunctionName,
-				"namespace": s.Namespace,
-			},
+			"metadata":   metadata,
 			"spec": map[string]interface{}{
 				"template": map[string]interface{}{
 					"spec": map[string]interface{}{
-						"containers": []interface{}{
-							map[string]interface{}{
-								"image": s.Image,
-							},
-						},
+						"containers": []interface{}{container},
 					},
 				},
 			},
@@ -245,13 +338,32 @@ func GetFunctionURL(client dynamic.Interface, namespace, name string) (string, e
 	return url, nil
 }
 
+// GetFunctionAddress retrieves the cluster-local address of a Knative Service from
+// "status.address.url". Unlike GetFunctionURL it never returns the public URL, so it
+// can be used to reach private functions from inside the cluster.
+func GetFunctionAddress(ctx context.Context, client dynamic.Interface, namespace, name string) (string, error) {
+	ksvc, err := client.Resource(knativeServiceGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get knative service %s/%s: %w", namespace, name, err)
+	}
+
+	url, found, err := unstructured.NestedString(ksvc.Object, "status", "address", "url")
+	if err != nil {
+		return "", fmt.Errorf("error extracting URL from knative service status.address: %w", err)
+	}
+	if !found || url == "" {
+		return "", fmt.Errorf("address not found in knative service status for %s/%s", namespace, name)
+	}
+	return url, nil
+}
+
 func (s *Service) GetUrl(client dynamic.Interface) (string, error) {
 	return GetFunctionURL(client, s.Namespace, s.FunctionName)
 }
 
 // GetKnativeService retrieves a Knative Service (ksvc) by namespace and name using the provided dynamic client.
-func GetKnativeService(client dynamic.Interface, namespace, name string) (*KnativeService, error) {
-	ksvc, err := client.Resource(knativeServiceGVR).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+func GetKnativeService(ctx context.Context, client dynamic.Interface, namespace, name string) (*KnativeService, error) {
+	ksvc, err := client.Resource(knativeServiceGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get knative service %s/%s: %w", namespace, name, err)
 	}
@@ -266,6 +378,68 @@ func GetKnativeService(client dynamic.Interface, namespace, name string) (*Knati
 	return ksvcObj, nil
 }
 
+// GetKnativeServiceObject retrieves a Knative Service without converting it.
+func GetKnativeServiceObject(ctx context.Context, client dynamic.Interface, namespace, name string) (*unstructured.Unstructured, error) {
+	ksvc, err := client.Resource(knativeServiceGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get knative service %s/%s: %w", namespace, name, err)
+	}
+	return ksvc, nil
+}
+
+// DeleteKnativeService deletes a Knative Service together with its revisions.
+func DeleteKnativeService(ctx context.Context, client dynamic.Interface, namespace, name string) error {
+	err := client.Resource(knativeServiceGVR).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete knative service %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// ListKnativeServiceObjects lists the Knative Services of a namespace without converting them.
+func ListKnativeServiceObjects(ctx context.Context, client dynamic.Interface, namespace string) ([]unstructured.Unstructured, error) {
+	ksvcs, err := client.Resource(knativeServiceGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list knative services in namespace %s: %w", namespace, err)
+	}
+	return ksvcs.Items, nil
+}
+
+// ListKnativeServicePage lists one page of the Knative Services of a namespace, honouring
+// the label selector, limit and continue token of opts.
+func ListKnativeServicePage(ctx context.Context, client dynamic.Interface, namespace string, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	ksvcs, err := client.Resource(knativeServiceGVR).Namespace(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list knative services in namespace %s: %w", namespace, err)
+	}
+	return ksvcs, nil
+}
+
+// ListRevisionObjects lists the Knative Revisions of a namespace without converting them.
+func ListRevisionObjects(ctx context.Context, client dynamic.Interface, namespace string) ([]unstructured.Unstructured, error) {
+	list, err := client.Resource(RevisionGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list knative revisions in namespace %s: %w", namespace, err)
+	}
+	return list.Items, nil
+}
+
+// CountKnativeServices counts the Knative services of the cluster that are in one of
+// the namespaces.
+func CountKnativeServices(ctx context.Context, client dynamic.Interface, namespaces map[string]bool) (int, error) {
+	ksvcs, err := client.Resource(knativeServiceGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list knative services: %w", err)
+	}
+	count := 0
+	for _, ksvc := range ksvcs.Items {
+		if namespaces[ksvc.GetNamespace()] {
+			count++
+		}
+	}
+	return count, nil
+}
+
 func ListKnativeServices(client dynamic.Interface, namespace string) ([]KnativeService, error) {
 	ksvcs, err := client.Resource(knativeServiceGVR).Namespace(namespace).List(context.Background(), metav1.ListOptions{})
 	if err != nil {
@@ -294,3 +468,35 @@ func FromUnstructured(unstructuredKsvc *unstructured.Unstructured) *Service {
 		FunctionName: unstructuredKsvc.GetName(),
 	}
 }
+
+// Revision is the subset of a Knative Revision needed to report on its health.
+type Revision struct {
+	Name       string      `json:"name"`
+	Conditions []Condition `json:"conditions"`
+}
+
+// ListRevisions returns the revisions of every Knative Service in namespace, keyed by name.
+func ListRevisions(ctx context.Context, client dynamic.Interface, namespace string) (map[string]Revision, error) {
+	items, err := ListRevisionObjects(ctx, client, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make(map[string]Revision, len(items))
+	for _, item := range items {
+		var status struct {
+			Conditions []Condition `json:"conditions"`
+		}
+		if raw, found, _ := unstructured.NestedFieldNoCopy(item.Object, "status"); found {
+			data, err := json.Marshal(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal revision status: %w", err)
+			}
+			if err := json.Unmarshal(data, &status); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal revision status: %w", err)
+			}
+		}
+		revisions[item.GetName()] = Revision{Name: item.GetName(), Conditions: status.Conditions}
+	}
+	return revisions, nil
+}
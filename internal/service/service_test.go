@@ -1,10 +1,18 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"faas-api/internal/logging"
+
+	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/dynamic"
@@ -70,7 +78,7 @@ func TestGetKnativeService(t *testing.T) {
 	client := dynamicfake.NewSimpleDynamicClient(scheme, ksvc)
 
 	// Attempt to retrieve the Knative Service using our  client.
-	knativeService, err := GetKnativeService(client, "default", "test-service")
+	knativeService, err := GetKnativeService(t.Context(), client, "default", "test-service")
 	if err != nil {
 		t.Fatalf("expected no error, got: %v", err)
 	}
@@ -123,7 +131,7 @@ func TestCreateKnativeService(t *testing.T) {
 		Namespace:    "default",
 		FunctionName: "test-service",
 	}
-	ret, err := service.Deploy(client)
+	ret, err := service.Deploy(context.Background(), client)
 
 	if err != nil {
 		t.Fatalf("expected no error, got: %v", err)
@@ -165,7 +173,7 @@ func TestCreateKnativeServiceWithRealClient(t *testing.T) {
 		Namespace:    "default",
 		FunctionName: "test",
 	}
-	ret, err := fn.Deploy(clientset)
+	ret, err := fn.Deploy(context.Background(), clientset)
 	if err != nil {
 		t.Fatalf("expected no error, got: %v", err)
 	}
@@ -280,7 +288,7 @@ func TestGetKnativeServiceFromCluster(t *testing.T) {
 	if clientset == nil {
 		t.Skip("Skipping test as the cluster is not running")
 
-		kservice, err := GetKnativeService(clientset, "default", "hello")
+		kservice, err := GetKnativeService(t.Context(), clientset, "default", "hello")
 		if err != nil {
 			t.Fatalf("expected no error, got: %v", err)
 		}
@@ -288,3 +296,31 @@ func TestGetKnativeServiceFromCluster(t *testing.T) {
 		t.Log("Knative Service Name: ", kservice.Status.URL)
 	}
 }
+
+func TestEnvVarValuesAreNotPrinted(t *testing.T) {
+	svc := &Service{FunctionName: "hello", Env: []EnvVar{{Name: "API_KEY", Value: "s3cret"}}}
+	for _, format := range []string{"%v", "%+v", "%s"} {
+		out := fmt.Sprintf(format, *svc)
+		if strings.Contains(out, "s3cret") || !strings.Contains(out, "API_KEY") {
+			t.Errorf("%s printed %q", format, out)
+		}
+	}
+}
+
+func TestEnvVarValuesAreNotLoggedAsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(logging.NewRedactor(&log.JSONFormatter{}))
+
+	env := []EnvVar{{Name: "API_KEY", Value: "s3cret"}}
+	logger.WithField("variables", env).WithField("service", Service{FunctionName: "hello", Env: env}).Info("deploying")
+	if out := buf.String(); strings.Contains(out, "s3cret") || !strings.Contains(out, "API_KEY") {
+		t.Errorf("logged %q", out)
+	}
+
+	// Outside of logs, the values are encoded as they are.
+	if out, err := json.Marshal(env); err != nil || !strings.Contains(string(out), "s3cret") {
+		t.Errorf("encoded %q, %v", out, err)
+	}
+}
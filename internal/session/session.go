@@ -0,0 +1,271 @@
+// Package session keeps browser sessions on the server, so the session cookie only
+// carries an opaque token and sessions can be listed, expired and revoked.
+package session
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"faas-api/internal/credential"
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/k8/store"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	recordKind = "session"
+
+	defaultNamespace       = "default"
+	defaultIdleTimeout     = 12 * time.Hour
+	defaultAbsoluteTimeout = 7 * 24 * time.Hour
+
+	// lastSeenResolution limits how often the last-seen timestamp is written back.
+	lastSeenResolution = time.Minute
+)
+
+var (
+	ErrInvalidSession = errors.New("invalid session")
+	ErrExpired        = errors.New("session has expired")
+)
+
+// Session is the stored representation of a browser session. Only the SHA-256 hash
+// of the secret part of the session token is stored.
+type Session struct {
+	ID         string                 `json:"id"`
+	Hash       string                 `json:"hash,omitempty"`
+	Subject    string                 `json:"subject"`
+	Provider   string                 `json:"provider"`
+	Profile    map[string]interface{} `json:"profile,omitempty"`
+	UserAgent  string                 `json:"user_agent,omitempty"`
+	IPAddress  string                 `json:"ip_address,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+	LastSeenAt time.Time              `json:"last_seen_at"`
+	// ExpiresAt is the absolute end of the session, however active it is.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// CSRFToken must accompany state-changing requests made with the session.
+	CSRFToken string `json:"csrf_token,omitempty"`
+
+	// RefreshToken renews the login at the identity provider once TokenExpiry has passed.
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	TokenExpiry  *time.Time `json:"token_expiry,omitempty"`
+}
+
+// Redacted returns a copy of the session without its secrets, safe to return to clients.
+func (s Session) Redacted() Session {
+	s.Hash = ""
+	s.CSRFToken = ""
+	s.RefreshToken = ""
+	return s
+}
+
+// Manager creates, verifies and revokes sessions.
+type Manager struct {
+	store     *store.Store[Session]
+	namespace string
+	now       func() time.Time
+
+	// IdleTimeout ends sessions that have not been used for this long.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout ends sessions this long after the login.
+	AbsoluteTimeout time.Duration
+	// Admins are the subjects allowed to see and end the sessions of every user.
+	Admins []string
+}
+
+// NewManager returns a manager storing sessions in namespace, "default" if empty.
+func NewManager(client dynamic.Interface, ns string) *Manager {
+	if ns == "" {
+		ns = defaultNamespace
+	}
+	return &Manager{
+		store:           store.New[Session](client, recordKind),
+		namespace:       ns,
+		now:             time.Now,
+		IdleTimeout:     defaultIdleTimeout,
+		AbsoluteTimeout: defaultAbsoluteTimeout,
+	}
+}
+
+// Create stores a new session and returns the token to put in the session cookie.
+func (m *Manager) Create(ctx context.Context, s *Session) (string, error) {
+	if s.Subject == "" {
+		return "", fmt.Errorf("session subject is required")
+	}
+
+	cred, err := credential.New("")
+	if err != nil {
+		return "", err
+	}
+	csrfToken, err := credential.RandomSecret()
+	if err != nil {
+		return "", err
+	}
+
+	now := m.now().UTC()
+	s.ID = cred.ID
+	s.Hash = cred.Hash
+	s.CSRFToken = csrfToken
+	s.CreatedAt = now
+	s.LastSeenAt = now
+	s.ExpiresAt = now.Add(m.AbsoluteTimeout)
+
+	labels := map[string]string{namespace.OwnerLabel: namespace.SubjectHash(s.Subject)}
+	if err := m.store.Create(ctx, m.namespace, cred.ID, labels, s); err != nil {
+		return "", err
+	}
+	return cred.Token, nil
+}
+
+// Authenticate verifies a session token, ending sessions that are idle or past their
+// absolute timeout, and records that the session was used.
+func (m *Manager) Authenticate(ctx context.Context, token string) (*Session, error) {
+	id, secret, ok := credential.Parse("", token)
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+
+	s, err := m.store.Get(ctx, m.namespace, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidSession
+		}
+		return nil, err
+	}
+	if !credential.Verify(s.Hash, secret) {
+		return nil, ErrInvalidSession
+	}
+
+	now := m.now()
+	if m.expired(s, now) {
+		if err := m.Revoke(ctx, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.WithError(err).WithField("session", id).Warn("failed to delete expired session")
+		}
+		return nil, ErrExpired
+	}
+
+	if now.Sub(s.LastSeenAt) >= lastSeenResolution {
+		// Only the activity is written, so that a refresh token rotated since s was
+		// read is kept.
+		seen, err := m.store.Update(ctx, m.namespace, id, func(s *Session) error {
+			s.LastSeenAt = now.UTC()
+			return nil
+		})
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return nil, ErrInvalidSession
+			}
+			log.WithError(err).WithField("session", id).Warn("failed to record session activity")
+		} else {
+			s = seen
+		}
+	}
+	return s, nil
+}
+
+// CheckCSRFToken reports whether token is the CSRF token of s.
+func (s *Session) CheckCSRFToken(token string) bool {
+	return s.CSRFToken != "" && subtle.ConstantTimeCompare([]byte(s.CSRFToken), []byte(token)) == 1
+}
+
+func (m *Manager) expired(s *Session, now time.Time) bool {
+	return now.After(s.ExpiresAt) || now.Sub(s.LastSeenAt) > m.IdleTimeout
+}
+
+// IsAdmin reports whether subject may manage the sessions of every user.
+func (m *Manager) IsAdmin(subject string) bool {
+	return subject != "" && slices.Contains(m.Admins, subject)
+}
+
+// UpdateToken stores a renewed refresh token and its expiry.
+func (m *Manager) UpdateToken(ctx context.Context, s *Session, refreshToken string, expiry *time.Time) error {
+	_, err := m.store.Update(ctx, m.namespace, s.ID, func(stored *Session) error {
+		stored.RefreshToken = refreshToken
+		stored.TokenExpiry = expiry
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.RefreshToken = refreshToken
+	s.TokenExpiry = expiry
+	return nil
+}
+
+// Get loads a session by id.
+func (m *Manager) Get(ctx context.Context, id string) (*Session, error) {
+	return m.store.Get(ctx, m.namespace, id)
+}
+
+// List returns the active sessions of subject, or of every user if subject is
+// empty, most recently used first and without their secrets.
+func (m *Manager) List(ctx context.Context, subject string) ([]Session, error) {
+	var selector map[string]string
+	if subject != "" {
+		selector = map[string]string{namespace.OwnerLabel: namespace.SubjectHash(subject)}
+	}
+	all, err := m.store.List(ctx, m.namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	sessions := make([]Session, 0, len(all))
+	for _, s := range all {
+		if !m.expired(&s, now) {
+			sessions = append(sessions, s.Redacted())
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+// Revoke ends a session.
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	return m.store.Delete(ctx, m.namespace, id)
+}
+
+// Sweep deletes expired sessions and returns how many were deleted.
+func (m *Manager) Sweep(ctx context.Context) (int, error) {
+	all, err := m.store.List(ctx, m.namespace, nil)
+	if err != nil {
+		return 0, err
+	}
+	now := m.now()
+	deleted := 0
+	for _, s := range all {
+		if !m.expired(&s, now) {
+			continue
+		}
+		if err := m.Revoke(ctx, s.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Run sweeps expired sessions every interval until ctx is done.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if n, err := m.Sweep(ctx); err != nil {
+			log.WithError(err).Error("failed to sweep expired sessions")
+		} else if n > 0 {
+			log.WithField("count", n).Info("deleted expired sessions")
+		}
+	}
+}
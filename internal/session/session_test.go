@@ -0,0 +1,184 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"faas-api/internal/k8/store"
+	"faas-api/internal/k8/store/storetest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManager() (*Manager, *time.Time) {
+	m := NewManager(storetest.NewClient(), "")
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	m, now := newTestManager()
+
+	expiry := now.Add(time.Hour)
+	token, err := m.Create(t.Context(), &Session{
+		Subject:      "github|1",
+		Provider:     "github",
+		Profile:      map[string]interface{}{"name": "Jane"},
+		RefreshToken: "refresh-me",
+		TokenExpiry:  &expiry,
+	})
+	require.NoError(t, err)
+
+	s, err := m.Authenticate(t.Context(), token)
+	require.NoError(t, err)
+	require.Equal(t, "github|1", s.Subject)
+	require.Equal(t, "Jane", s.Profile["name"])
+	require.Equal(t, "refresh-me", s.RefreshToken)
+	require.NotContains(t, s.Hash, token, "only the hash of the secret is stored")
+	require.True(t, s.CheckCSRFToken(s.CSRFToken))
+	require.False(t, s.CheckCSRFToken(""))
+	require.False(t, s.CheckCSRFToken(s.CSRFToken+"x"))
+
+	_, err = m.Authenticate(t.Context(), token+"x")
+	require.ErrorIs(t, err, ErrInvalidSession)
+	_, err = m.Authenticate(t.Context(), "missing_secret")
+	require.ErrorIs(t, err, ErrInvalidSession)
+	_, err = m.Authenticate(t.Context(), "garbage")
+	require.ErrorIs(t, err, ErrInvalidSession)
+
+	renewed := now.Add(2 * time.Hour)
+	require.NoError(t, m.UpdateToken(t.Context(), s, "rotated", &renewed))
+	s, err = m.Authenticate(t.Context(), token)
+	require.NoError(t, err)
+	require.Equal(t, "rotated", s.RefreshToken)
+	require.True(t, renewed.Equal(*s.TokenExpiry))
+}
+
+func TestActivityKeepsRotatedToken(t *testing.T) {
+	client := storetest.NewClient()
+	m := NewManager(client, "")
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	token, err := m.Create(t.Context(), &Session{Subject: "github|1", RefreshToken: "first"})
+	require.NoError(t, err)
+	s, err := m.Authenticate(t.Context(), token)
+	require.NoError(t, err)
+
+	// A refresh rotates the token after Authenticate has loaded the session, before
+	// it records the activity.
+	other := NewManager(storetest.BeforeUpdate(client, func() {
+		require.NoError(t, m.UpdateToken(t.Context(), s, "rotated", nil))
+	}), "")
+	other.now = func() time.Time { return now.Add(time.Hour) }
+	seen, err := other.Authenticate(t.Context(), token)
+	require.NoError(t, err)
+	require.Equal(t, "rotated", seen.RefreshToken)
+
+	stored, err := m.Get(t.Context(), s.ID)
+	require.NoError(t, err)
+	require.Equal(t, "rotated", stored.RefreshToken)
+	require.True(t, now.Add(time.Hour).Equal(stored.LastSeenAt))
+}
+
+func TestIdleTimeout(t *testing.T) {
+	m, now := newTestManager()
+	m.IdleTimeout = time.Hour
+
+	token, err := m.Create(t.Context(), &Session{Subject: "github|1"})
+	require.NoError(t, err)
+
+	// Activity keeps the session alive past the idle timeout.
+	*now = now.Add(50 * time.Minute)
+	_, err = m.Authenticate(t.Context(), token)
+	require.NoError(t, err)
+	*now = now.Add(50 * time.Minute)
+	_, err = m.Authenticate(t.Context(), token)
+	require.NoError(t, err)
+
+	*now = now.Add(61 * time.Minute)
+	_, err = m.Authenticate(t.Context(), token)
+	require.ErrorIs(t, err, ErrExpired)
+
+	// Expired sessions are deleted.
+	_, err = m.Authenticate(t.Context(), token)
+	require.ErrorIs(t, err, ErrInvalidSession)
+}
+
+func TestAbsoluteTimeout(t *testing.T) {
+	m, now := newTestManager()
+	m.IdleTimeout = time.Hour
+	m.AbsoluteTimeout = 3 * time.Hour
+
+	token, err := m.Create(t.Context(), &Session{Subject: "github|1"})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		*now = now.Add(45 * time.Minute)
+		if _, err = m.Authenticate(t.Context(), token); err != nil {
+			break
+		}
+	}
+	require.ErrorIs(t, err, ErrExpired, "activity does not extend a session past its absolute timeout")
+}
+
+func TestListAndRevoke(t *testing.T) {
+	m, now := newTestManager()
+
+	laptop, err := m.Create(t.Context(), &Session{Subject: "github|1", UserAgent: "laptop", RefreshToken: "secret"})
+	require.NoError(t, err)
+	*now = now.Add(time.Minute)
+	_, err = m.Create(t.Context(), &Session{Subject: "github|1", UserAgent: "phone"})
+	require.NoError(t, err)
+	_, err = m.Create(t.Context(), &Session{Subject: "github|2", UserAgent: "other"})
+	require.NoError(t, err)
+
+	sessions, err := m.List(t.Context(), "github|1")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, "phone", sessions[0].UserAgent, "most recently used first")
+	for _, s := range sessions {
+		require.Empty(t, s.Hash, "listed sessions must not include the hash")
+		require.Empty(t, s.RefreshToken, "listed sessions must not include the refresh token")
+		require.Empty(t, s.CSRFToken, "listed sessions must not include the CSRF token")
+	}
+
+	all, err := m.List(t.Context(), "")
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+
+	require.NoError(t, m.Revoke(t.Context(), sessions[1].ID))
+	_, err = m.Authenticate(t.Context(), laptop)
+	require.ErrorIs(t, err, ErrInvalidSession, "revoked sessions can no longer be used")
+	err = m.Revoke(t.Context(), sessions[1].ID)
+	require.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestSweep(t *testing.T) {
+	m, now := newTestManager()
+	m.IdleTimeout = time.Hour
+
+	_, err := m.Create(t.Context(), &Session{Subject: "github|1"})
+	require.NoError(t, err)
+	*now = now.Add(2 * time.Hour)
+	active, err := m.Create(t.Context(), &Session{Subject: "github|2"})
+	require.NoError(t, err)
+
+	deleted, err := m.Sweep(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	_, err = m.Authenticate(t.Context(), active)
+	require.NoError(t, err)
+	all, err := m.List(t.Context(), "")
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+}
+
+func TestIsAdmin(t *testing.T) {
+	m, _ := newTestManager()
+	m.Admins = []string{"github|1"}
+	require.True(t, m.IsAdmin("github|1"))
+	require.False(t, m.IsAdmin("github|2"))
+	require.False(t, m.IsAdmin(""))
+}
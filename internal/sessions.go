@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"errors"
+	"faas-api/internal/apierror"
+	"faas-api/internal/audit"
+	"faas-api/internal/k8/store"
+	"faas-api/internal/session"
+	apiv1 "faas-api/pkg/api/v1"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionView is a session as returned to clients, marking the one of the request.
+type sessionView struct {
+	session.Session
+	Current bool `json:"current"`
+}
+
+// ListSessionsHandler lists the caller's active sessions. Platform admins may list
+// the sessions of another user with ?subject= or of every user with ?all=true.
+func (p *Platform) ListSessionsHandler(c *gin.Context) {
+	subject := c.GetString("sub")
+	if other, all := c.Query("subject"), c.Query("all") == "true"; other != "" || all {
+		if !p.Sessions.IsAdmin(subject) {
+			apierror.Abort(c, apierror.New(apiv1.CodeForbidden, "listing the sessions of other users requires a platform admin"))
+			return
+		}
+		subject = other
+	}
+
+	sessions, err := p.Sessions.List(c, subject)
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to list sessions"))
+		return
+	}
+
+	current := c.GetString("session_id")
+	views := make([]sessionView, 0, len(sessions))
+	for _, s := range sessions {
+		views = append(views, sessionView{Session: s, Current: s.ID == current})
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+// RevokeSessionHandler ends a session of the caller, or of any user for platform admins.
+func (p *Platform) RevokeSessionHandler(c *gin.Context) {
+	id := c.Param("id")
+	caller := c.GetString("sub")
+
+	s, err := p.Sessions.Get(c, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "session not found"))
+			return
+		}
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to get session"))
+		return
+	}
+	// Other users' sessions get the same answer as missing ones.
+	if s.Subject != caller && !p.Sessions.IsAdmin(caller) {
+		apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "session not found"))
+		return
+	}
+	audit.From(c).Before = map[string]interface{}{"subject": s.Subject, "user_agent": s.UserAgent, "ip_address": s.IPAddress}
+
+	if err := p.Sessions.Revoke(c, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to revoke session"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"faas-api/internal/apierror"
+	"faas-api/internal/audit"
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/org"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/gin-gonic/gin"
+)
+
+// callerOwner returns the identity of the authenticated user.
+func callerOwner(c *gin.Context) (namespace.Owner, bool) {
+	owner := namespace.Owner{
+		Subject:     c.GetString("sub"),
+		Provider:    c.GetString("provider"),
+		DisplayName: c.GetString("display_name"),
+		Username:    c.GetString("username"),
+	}
+	return owner, owner.Subject != ""
+}
+
+// callerOrg returns the organization named by the "org" query parameter, after checking
+// that the caller holds at least the required role in it. It returns nil and true when
+// the request is not scoped to an organization, and writes an error response and
+// returns false when access is denied.
+func (p *Platform) callerOrg(c *gin.Context, required org.Role) (*org.Org, bool) {
+	slug := c.Query("org")
+	if slug == "" {
+		return nil, true
+	}
+
+	o, err := org.NewManager(p.Client).Get(c, slug)
+	if err != nil {
+		if errors.Is(err, org.ErrNotFound) {
+			apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "organization not found"))
+			return nil, false
+		}
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to get organization"))
+		return nil, false
+	}
+
+	// Non-members get the same answer as for a missing organization.
+	role, member := o.RoleOf(c.GetString("sub"))
+	if !member {
+		apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "organization not found"))
+		return nil, false
+	}
+	if !role.Includes(required) {
+		apierror.Abort(c, apierror.New(apiv1.CodeForbidden, "requires the %s role in organization %s", required, o.Slug))
+		return nil, false
+	}
+	return o, true
+}
+
+// callerNamespace returns the namespace the authenticated caller acts on, writing an
+// error response and returning false if it cannot be determined. API key callers
+// carry the namespace the key was issued for. Requests with an "org" query parameter
+// act on the organization's namespace and need at least the required role there;
+// users hold every role in their personal namespace.
+func (p *Platform) callerNamespace(c *gin.Context, required org.Role) (string, bool) {
+	if ns := c.GetString("namespace"); ns != "" {
+		// Machine identities are granted a role in the namespace; API keys are
+		// checked by their own middleware.
+		if role, ok := c.Value("namespace_role").(org.Role); ok && !role.Includes(required) {
+			apierror.Abort(c, apierror.New(apiv1.CodeForbidden, "requires the %s role", required))
+			return "", false
+		}
+		audit.From(c).Tenant = ns
+		return ns, true
+	}
+
+	o, ok := p.callerOrg(c, required)
+	if !ok {
+		return "", false
+	}
+	if o != nil {
+		audit.From(c).Tenant = o.Namespace
+		return o.Namespace, true
+	}
+
+	owner, ok := callerOwner(c)
+	if !ok {
+		apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "username is required"))
+		return "", false
+	}
+
+	ns, err := p.Namespaces.Resolve(c, owner)
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to resolve namespace"))
+		return "", false
+	}
+	audit.From(c).Tenant = ns
+	return ns, true
+}
+
+// personalNamespace returns the caller's own namespace, creating and provisioning it
+// if needed, writing an error response and returning false on failure. Callers bound
+// to a namespace, such as machine identities, have no personal namespace.
+func (p *Platform) personalNamespace(c *gin.Context) (string, bool) {
+	if c.GetString("namespace") != "" {
+		apierror.Abort(c, apierror.New(apiv1.CodeForbidden, "this endpoint requires a user login"))
+		return "", false
+	}
+
+	owner, ok := callerOwner(c)
+	if !ok {
+		apierror.Abort(c, apierror.New(apiv1.CodeInvalidRequest, "username is required"))
+		return "", false
+	}
+
+	ns, err := p.Namespaces.CreateOrGet(c, owner)
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to create or get namespace"))
+		return "", false
+	}
+
+	if err := p.Namespaces.Provision(c, ns); err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to provision namespace"))
+		return "", false
+	}
+	audit.From(c).Tenant = ns
+	return ns, true
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"errors"
+	"faas-api/internal/apierror"
+	"faas-api/internal/audit"
+	"faas-api/internal/k8/store"
+	"faas-api/internal/pat"
+	apiv1 "faas-api/pkg/api/v1"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Personal access tokens are kept in the owner's personal namespace, regardless of
+// any organization scope of the request.
+
+// CreateTokenHandler issues a personal access token for the caller. The plaintext
+// token is only returned in this response.
+func (p *Platform) CreateTokenHandler(c *gin.Context) {
+	var req pat.CreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInvalidRequest, "invalid token request"))
+		return
+	}
+
+	ns, ok := p.personalNamespace(c)
+	if !ok {
+		return
+	}
+	owner, _ := callerOwner(c)
+
+	token, plaintext, err := pat.NewManager(p.Client).Create(c, ns, owner, req)
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to create token"))
+		return
+	}
+	details := audit.From(c)
+	details.Resource = token.ID
+	details.After = map[string]interface{}{"name": token.Name, "scopes": token.Scopes, "expires_at": token.ExpiresAt}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":        plaintext,
+		"access_token": token.Redacted(),
+	})
+}
+
+func (p *Platform) ListTokensHandler(c *gin.Context) {
+	ns, ok := p.personalNamespace(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := pat.NewManager(p.Client).List(c, ns)
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to list tokens"))
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (p *Platform) RevokeTokenHandler(c *gin.Context) {
+	ns, ok := p.personalNamespace(c)
+	if !ok {
+		return
+	}
+
+	token, err := pat.NewManager(p.Client).Revoke(c, ns, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "token not found"))
+			return
+		}
+		apierror.Abort(c, apierror.Wrap(err, apiv1.CodeInternal, "failed to revoke token"))
+		return
+	}
+	audit.From(c).Before = map[string]interface{}{"name": token.Name, "scopes": token.Scopes}
+
+	c.JSON(http.StatusOK, token)
+}
@@ -0,0 +1,137 @@
+// Package tracing traces requests with OpenTelemetry. Server spans continue the W3C
+// trace context sent by callers, and spans are exported to an OTLP/HTTP collector.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"faas-api/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serviceName names the server in traces and the instrumentation of its spans.
+const serviceName = "faas-api"
+
+// Attribute keys of the spans of the platform.
+const (
+	FunctionKey  = attribute.Key("faas.function")
+	RuntimeKey   = attribute.Key("faas.runtime")
+	NamespaceKey = attribute.Key("faas.namespace")
+	ImageKey     = attribute.Key("faas.image")
+	StateKey     = attribute.Key("faas.state")
+)
+
+// Setup installs the W3C trace context propagator and, when an endpoint is
+// configured, a tracer provider exporting to it. The returned function flushes the
+// spans still buffered.
+func Setup(ctx context.Context, cfg config.Tracing) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tracing endpoint: %w", err)
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	provider := NewProvider(sdktrace.NewBatchSpanProcessor(exporter), cfg.SampleRatio)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewProvider returns a tracer provider sending the spans of the server to
+// processor. Traces started by the server are sampled at ratio; traces continued
+// from callers keep their sampling decision.
+func NewProvider(processor sdktrace.SpanProcessor, ratio float64) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+}
+
+// Middleware starts the server span of each request as a child of the trace context
+// in its headers.
+func Middleware(c *gin.Context) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+	name := c.Request.Method
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(c.Request.Method),
+		semconv.URLPath(c.Request.URL.Path),
+	}
+	if route := c.FullPath(); route != "" {
+		name += " " + route
+		attrs = append(attrs, semconv.HTTPRoute(route))
+	}
+	ctx, span := otel.Tracer(serviceName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	defer span.End()
+
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// Start starts a span as a child of the span of ctx. Handlers pass their
+// *gin.Context, whose request holds the server span.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if c, ok := ctx.(*gin.Context); ok && c.Request != nil {
+		// gin.Context does not look up values in its request by default.
+		ctx = trace.ContextWithSpan(c, trace.SpanFromContext(c.Request.Context()))
+	}
+	return otel.Tracer(serviceName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartHandler starts the span of the handler of c. Spans started with c are its
+// children.
+func StartHandler(c *gin.Context, name string) trace.Span {
+	ctx, span := otel.Tracer(serviceName).Start(c.Request.Context(), name)
+	c.Request = c.Request.WithContext(ctx)
+	return span
+}
+
+// End ends span, marking it failed with err unless err is nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Detach returns a context carrying only the span of ctx, for work that outlives
+// the request ctx belongs to.
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
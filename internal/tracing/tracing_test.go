@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"faas-api/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentID    = "00f067aa0ba902b7"
+	traceparent = "00-" + traceID + "-" + parentID + "-01"
+)
+
+// record installs a tracer provider exporting to memory at the given sample ratio.
+func record(t *testing.T, ratio float64) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider(sdktrace.NewSimpleSpanProcessor(exporter), ratio)
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	_, err := Setup(t.Context(), config.Tracing{})
+	require.NoError(t, err)
+	return exporter
+}
+
+func serve(t *testing.T, header http.Header) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware)
+	router.GET("/api/function/:name", func(c *gin.Context) {
+		span := StartHandler(c, "GetFunctionHandler")
+		defer span.End()
+		_, child := Start(c, "GetKnativeService")
+		End(child, context.DeadlineExceeded)
+		c.Status(http.StatusInternalServerError)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/api/function/hello", nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	router.ServeHTTP(httptest.NewRecorder(), r)
+}
+
+func TestMiddlewareContinuesTraceContext(t *testing.T) {
+	exporter := record(t, 1)
+	serve(t, http.Header{"Traceparent": {traceparent}})
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	child, handler, server := spans[0], spans[1], spans[2]
+
+	require.Equal(t, "GET /api/function/:name", server.Name)
+	require.Equal(t, traceID, server.SpanContext.TraceID().String())
+	require.Equal(t, parentID, server.Parent.SpanID().String())
+	require.True(t, server.Parent.IsRemote())
+	require.Equal(t, codes.Error, server.Status.Code)
+
+	require.Equal(t, "GetFunctionHandler", handler.Name)
+	require.Equal(t, server.SpanContext.SpanID(), handler.Parent.SpanID())
+	require.Equal(t, "GetKnativeService", child.Name)
+	require.Equal(t, handler.SpanContext.SpanID(), child.Parent.SpanID())
+	require.Equal(t, codes.Error, child.Status.Code)
+	require.Len(t, child.Events, 1, "the error is recorded")
+}
+
+func TestSampling(t *testing.T) {
+	exporter := record(t, 0)
+
+	serve(t, nil)
+	require.Empty(t, exporter.GetSpans(), "traces started by the server are sampled at the ratio")
+
+	serve(t, http.Header{"Traceparent": {traceparent}})
+	require.Len(t, exporter.GetSpans(), 3, "sampled callers are traced")
+}
+
+func TestDetach(t *testing.T) {
+	exporter := record(t, 1)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	ctx, span := Start(ctx, "CreateKnativeService")
+	detached := Detach(ctx)
+	span.End()
+	cancel()
+
+	require.NoError(t, detached.Err(), "detached work outlives the request")
+	_, wait := Start(detached, "WaitKnativeServiceReady")
+	wait.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	require.Equal(t, spans[0].SpanContext.SpanID(), spans[1].Parent.SpanID())
+}
@@ -0,0 +1,137 @@
+// Package v1 defines the public, versioned representation of platform resources.
+// Its shape is independent of the Knative version running in the cluster.
+package v1
+
+import (
+	_ "embed"
+	"time"
+)
+
+const (
+	APIVersion   = "faas.dev/v1"
+	KindFunction = "Function"
+	KindList     = "FunctionList"
+)
+
+// Function states.
+const (
+	StateReady     = "ready"
+	StateDeploying = "deploying"
+	StateDegraded  = "degraded"
+	StateFailed    = "failed"
+	StateUnknown   = "unknown"
+)
+
+// RedactedValue replaces the literal values of environment variables, which are
+// only returned when explicitly asked for.
+const RedactedValue = "<redacted>"
+
+// Schema is the JSON schema of Function.
+//
+//go:embed function.schema.json
+var Schema []byte
+
+// Function is a deployed function.
+type Function struct {
+	APIVersion  string            `json:"apiVersion"`
+	Kind        string            `json:"kind"`
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	URL         string            `json:"url,omitempty"`
+	Address     string            `json:"address,omitempty"`
+	Visibility  string            `json:"visibility"`
+	Runtime     string            `json:"runtime,omitempty"`
+	Image       string            `json:"image"`
+	ImageDigest string            `json:"imageDigest,omitempty"`
+	Env         []EnvVar          `json:"env,omitempty"`
+	Scaling     Scaling           `json:"scaling"`
+	Resources   Resources         `json:"resources"`
+	Status      Status            `json:"status"`
+	Revisions   []Revision        `json:"revisions,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+// EnvVar is an environment variable of the function. Literal values are returned as
+// RedactedValue unless asked for; values read from Kubernetes secrets are never
+// returned, only their SecretRef.
+type EnvVar struct {
+	Name      string     `json:"name"`
+	Value     string     `json:"value,omitempty"`
+	SecretRef *SecretRef `json:"secretRef,omitempty"`
+}
+
+// RedactEnv returns a copy of env with every literal value replaced by RedactedValue.
+func RedactEnv(env []EnvVar) []EnvVar {
+	if env == nil {
+		return nil
+	}
+	out := make([]EnvVar, len(env))
+	for i, e := range env {
+		if e.SecretRef == nil && e.Value != "" {
+			e.Value = RedactedValue
+		}
+		out[i] = e
+	}
+	return out
+}
+
+// SecretRef points at a key of a Kubernetes secret.
+type SecretRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// Scaling holds the autoscaling settings of a function.
+type Scaling struct {
+	MinScale         *int `json:"minScale,omitempty"`
+	MaxScale         *int `json:"maxScale,omitempty"`
+	Target           *int `json:"target,omitempty"`
+	ConcurrencyLimit int  `json:"concurrencyLimit,omitempty"`
+	TimeoutSeconds   int  `json:"timeoutSeconds,omitempty"`
+}
+
+// Resources holds the compute resources of a function, as Kubernetes quantities.
+type Resources struct {
+	Requests ResourceList `json:"requests,omitempty"`
+	Limits   ResourceList `json:"limits,omitempty"`
+}
+
+// ResourceList maps "cpu" and "memory" to quantities such as "250m" or "128Mi".
+type ResourceList map[string]string
+
+// Status is the human-readable health of a function.
+type Status struct {
+	State    string    `json:"state"`
+	Summary  string    `json:"summary,omitempty"`
+	Problems []Problem `json:"problems,omitempty"`
+}
+
+// Problem explains one thing that is wrong with a function.
+type Problem struct {
+	Source      string `json:"source"`
+	Name        string `json:"name"`
+	Reason      string `json:"reason"`
+	Message     string `json:"message,omitempty"`
+	Explanation string `json:"explanation"`
+}
+
+// Revision is an immutable snapshot of a function's code and configuration.
+type Revision struct {
+	Name           string    `json:"name"`
+	Ready          bool      `json:"ready"`
+	TrafficPercent int       `json:"trafficPercent"`
+	ImageDigest    string    `json:"imageDigest,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// FunctionList is a page of functions. Continue is set when more pages are available
+// and must be passed back as the "continue" query parameter to fetch the next one.
+type FunctionList struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Items      []Function `json:"items"`
+	Continue   string     `json:"continue,omitempty"`
+}
@@ -0,0 +1,58 @@
+package v1
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// jsonFields returns the JSON property names of a struct type.
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func schemaFields(props map[string]json.RawMessage) []string {
+	var names []string
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type schemaNode struct {
+	Properties map[string]json.RawMessage `json:"properties"`
+	Items      *schemaNode                `json:"items"`
+}
+
+func TestSchemaMatchesTypes(t *testing.T) {
+	var root schemaNode
+	require.NoError(t, json.Unmarshal(Schema, &root), "schema must be valid JSON")
+	require.Equal(t, jsonFields(reflect.TypeOf(Function{})), schemaFields(root.Properties))
+
+	nested := map[string]reflect.Type{
+		"scaling":   reflect.TypeOf(Scaling{}),
+		"resources": reflect.TypeOf(Resources{}),
+		"status":    reflect.TypeOf(Status{}),
+		"env":       reflect.TypeOf(EnvVar{}),
+		"revisions": reflect.TypeOf(Revision{}),
+	}
+	for prop, typ := range nested {
+		var node schemaNode
+		require.NoError(t, json.Unmarshal(root.Properties[prop], &node))
+		if node.Items != nil {
+			node = *node.Items
+		}
+		require.Equal(t, jsonFields(typ), schemaFields(node.Properties), "schema of %q is out of date", prop)
+	}
+}
@@ -0,0 +1,70 @@
+package v1
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// OpenAPI returns the OpenAPI 3.1 document of the REST API. The checked in document
+// refers to function.schema.json for the Function schema, which is inlined here so
+// that the document served by the API stands on its own.
+func OpenAPI() ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(openAPI, &doc); err != nil {
+		return nil, fmt.Errorf("invalid openapi.json: %w", err)
+	}
+	var function map[string]interface{}
+	if err := json.Unmarshal(Schema, &function); err != nil {
+		return nil, fmt.Errorf("invalid function.schema.json: %w", err)
+	}
+
+	components, _ := doc["components"].(map[string]interface{})
+	schemas, _ := components["schemas"].(map[string]interface{})
+	if schemas == nil {
+		return nil, fmt.Errorf("openapi.json has no components.schemas")
+	}
+
+	// The definitions of the Function schema become components, as "#" now refers
+	// to the OpenAPI document. Without $id, references resolve against it as well.
+	defs, _ := function["$defs"].(map[string]interface{})
+	for name, def := range defs {
+		schemas[defName(name)] = rewriteRefs(def)
+	}
+	delete(function, "$defs")
+	delete(function, "$id")
+	delete(function, "$schema")
+	schemas[KindFunction] = rewriteRefs(function)
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// defName returns the component name of a definition of the Function schema.
+func defName(name string) string {
+	return KindFunction + strings.ToUpper(name[:1]) + name[1:]
+}
+
+// rewriteRefs points the "#/$defs/" references of a schema at the components.
+func rewriteRefs(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if ref, ok := child.(string); ok && k == "$ref" {
+				if name, ok := strings.CutPrefix(ref, "#/$defs/"); ok {
+					v[k] = "#/components/schemas/" + defName(name)
+				}
+				continue
+			}
+			v[k] = rewriteRefs(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = rewriteRefs(child)
+		}
+	}
+	return v
+}
@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	doc, err := OpenAPI()
+	require.NoError(t, err)
+
+	var parsed struct {
+		Components struct {
+			Schemas map[string]schemaNode `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(doc, &parsed))
+	schemas := parsed.Components.Schemas
+
+	types := map[string]reflect.Type{
+		"Function":     reflect.TypeOf(Function{}),
+		"FunctionList": reflect.TypeOf(FunctionList{}),
+		"Problem":      reflect.TypeOf(ProblemDetails{}),
+		"FieldError":   reflect.TypeOf(FieldError{}),
+	}
+	for name, typ := range types {
+		require.Contains(t, schemas, name)
+		require.Equal(t, jsonFields(typ), schemaFields(schemas[name].Properties), "schema %q is out of date", name)
+	}
+
+	var full struct {
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(doc, &full))
+	var problem struct {
+		Properties struct {
+			Code struct {
+				Enum []string `json:"enum"`
+			} `json:"code"`
+		} `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(full.Components.Schemas["Problem"], &problem))
+	require.ElementsMatch(t, Codes(), problem.Properties.Code.Enum, "every error code is documented")
+}
+
+func TestOpenAPIReferencesResolve(t *testing.T) {
+	doc, err := OpenAPI()
+	require.NoError(t, err)
+
+	var parsed map[string]interface{}
+	require.NoError(t, json.Unmarshal(doc, &parsed))
+	components := parsed["components"].(map[string]interface{})
+
+	for _, m := range regexp.MustCompile(`"\$ref": "([^"]+)"`).FindAllStringSubmatch(string(doc), -1) {
+		parts := strings.Split(strings.TrimPrefix(m[1], "#/components/"), "/")
+		require.True(t, strings.HasPrefix(m[1], "#/components/") && len(parts) == 2, "%s must refer to a component", m[1])
+		section, _ := components[parts[0]].(map[string]interface{})
+		require.Contains(t, section, parts[1], "%s does not resolve", m[1])
+	}
+}
@@ -0,0 +1,117 @@
+package v1
+
+import "net/http"
+
+// ProblemContentType is the media type of error responses, see RFC 7807.
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix prefixes the code of a problem to form its type URI.
+const problemTypePrefix = "urn:faas.dev:problem:"
+
+// Error codes. They are stable: clients may rely on them, while titles and details
+// are meant for people and may change.
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeValidationFailed    = "validation_failed"
+	CodeUnauthenticated     = "unauthenticated"
+	CodeForbidden           = "forbidden"
+	CodeQuotaExceeded       = "quota_exceeded"
+	CodeNotFound            = "not_found"
+	CodeAlreadyExists       = "already_exists"
+	CodeConflict            = "conflict"
+	CodeExpired             = "expired"
+	CodePayloadTooLarge     = "payload_too_large"
+	CodeBuildFailed         = "build_failed"
+	CodePushFailed          = "push_failed"
+	CodeDeployFailed        = "deploy_failed"
+	CodeFunctionUnreachable = "function_unreachable"
+	CodeBuilderUnavailable  = "builder_unavailable"
+	CodeClusterUnavailable  = "cluster_unavailable"
+	CodeUnavailable         = "unavailable"
+	CodeTimeout             = "timeout"
+	CodeInternal            = "internal"
+)
+
+// codes maps each code to its HTTP status and title.
+var codes = map[string]struct {
+	status int
+	title  string
+}{
+	CodeInvalidRequest:      {http.StatusBadRequest, "The request is malformed"},
+	CodeValidationFailed:    {http.StatusBadRequest, "The request has invalid fields"},
+	CodeUnauthenticated:     {http.StatusUnauthorized, "Authentication is required"},
+	CodeForbidden:           {http.StatusForbidden, "The caller is not allowed to do this"},
+	CodeQuotaExceeded:       {http.StatusForbidden, "The tenant quota is exceeded"},
+	CodeNotFound:            {http.StatusNotFound, "The resource does not exist"},
+	CodeAlreadyExists:       {http.StatusConflict, "The name is taken"},
+	CodeConflict:            {http.StatusConflict, "The request conflicts with the resource's state"},
+	CodeExpired:             {http.StatusGone, "The token has expired"},
+	CodePayloadTooLarge:     {http.StatusRequestEntityTooLarge, "The request body is too large"},
+	CodeBuildFailed:         {http.StatusInternalServerError, "The function image failed to build"},
+	CodePushFailed:          {http.StatusBadGateway, "The registry rejected the function image"},
+	CodeDeployFailed:        {http.StatusInternalServerError, "The function failed to deploy"},
+	CodeFunctionUnreachable: {http.StatusBadGateway, "The function is not reachable"},
+	CodeBuilderUnavailable:  {http.StatusServiceUnavailable, "The image builder is unavailable"},
+	CodeClusterUnavailable:  {http.StatusServiceUnavailable, "The cluster is unavailable"},
+	CodeUnavailable:         {http.StatusServiceUnavailable, "The service is unavailable"},
+	CodeTimeout:             {http.StatusGatewayTimeout, "The operation timed out"},
+	CodeInternal:            {http.StatusInternalServerError, "Internal error"},
+}
+
+// CodeStatus returns the HTTP status of code, 500 for unknown codes.
+func CodeStatus(code string) int {
+	if c, ok := codes[code]; ok {
+		return c.status
+	}
+	return http.StatusInternalServerError
+}
+
+// Codes returns every error code.
+func Codes() []string {
+	out := make([]string, 0, len(codes))
+	for code := range codes {
+		out = append(out, code)
+	}
+	return out
+}
+
+// ProblemDetails is the body of error responses, see RFC 7807.
+type ProblemDetails struct {
+	// Type identifies the kind of problem, urn:faas.dev:problem:<code>.
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the request.
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+	// Errors lists the invalid fields of validation_failed problems.
+	Errors []FieldError `json:"errors,omitempty"`
+	// Error repeats Detail for clients reading the error responses served before
+	// problems.
+	Error string `json:"error"`
+}
+
+// FieldError is an invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// NewProblem returns the problem of code with detail.
+func NewProblem(code, detail string) *ProblemDetails {
+	c, ok := codes[code]
+	if !ok {
+		code, c = CodeInternal, codes[CodeInternal]
+	}
+	return &ProblemDetails{
+		Type:   problemTypePrefix + code,
+		Title:  c.title,
+		Status: c.status,
+		Detail: detail,
+		Code:   code,
+		Error:  detail,
+	}
+}
@@ -0,0 +1,377 @@
+// Package client is a Go client of the FaaS REST API, described by the OpenAPI
+// document served at /api/openapi.json. It authenticates with a bearer token: a
+// personal access token, a machine identity JWT or, for invocations, an API key.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apiv1 "faas-api/pkg/api/v1"
+)
+
+// maxErrorBody bounds how much of an error response is read.
+const maxErrorBody = 64 << 10
+
+// Client calls the API at BaseURL.
+type Client struct {
+	// BaseURL is the address of the server, such as https://www.faas.test, without
+	// the /api prefix.
+	BaseURL string
+	// Token is sent as "Authorization: Bearer <Token>" when not empty.
+	Token string
+	// Org, if set, makes requests act in the namespace of the organization with
+	// this slug instead of the caller's personal namespace.
+	Org string
+	// HTTPClient sends the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// New returns a client of the server at baseURL authenticating with token.
+func New(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token}
+}
+
+// Error is returned for the error responses of the API. Problem holds the RFC 7807
+// body; its Code tells errors apart, see the Code* constants of pkg/api/v1.
+type Error struct {
+	StatusCode int
+	Problem    apiv1.ProblemDetails
+}
+
+func (e *Error) Error() string {
+	if e.Problem.Code == "" {
+		return fmt.Sprintf("faas: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Problem.Detail)
+	}
+	return fmt.Sprintf("faas: %s: %s", e.Problem.Code, e.Problem.Detail)
+}
+
+// HasCode reports whether err is an *Error with the given problem code.
+func HasCode(err error, code string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Problem.Code == code
+}
+
+// DeployRequest describes a function to build and deploy.
+type DeployRequest struct {
+	Name    string
+	Runtime string
+	// Archive is read for the zip archive of the function source.
+	Archive     io.Reader
+	Visibility  string // apiv1 "public" (default) or "private"
+	Description string
+	Labels      map[string]string
+	Env         map[string]string
+}
+
+// Deploy builds the image of the function, pushes it and deploys it. The build runs
+// within the request, so build and push failures are returned as errors with the
+// build_failed and push_failed codes. The function may still be starting when Deploy
+// returns; see WaitReady.
+func (c *Client) Deploy(ctx context.Context, req DeployRequest) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"name":        req.Name,
+		"runtime":     req.Runtime,
+		"visibility":  req.Visibility,
+		"description": req.Description,
+	}
+	if len(req.Labels) > 0 {
+		labels, err := json.Marshal(req.Labels)
+		if err != nil {
+			return fmt.Errorf("failed to encode labels: %w", err)
+		}
+		fields["labels"] = string(labels)
+	}
+	if len(req.Env) > 0 {
+		env, err := json.Marshal(envVars(req.Env))
+		if err != nil {
+			return fmt.Errorf("failed to encode env: %w", err)
+		}
+		fields["env_vars"] = string(env)
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := w.WriteField(name, value); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	if req.Archive != nil {
+		file, err := w.CreateFormFile("file", req.Name+".zip")
+		if err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+		if _, err := io.Copy(file, req.Archive); err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write request: %w", err)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/functions", nil, &body, w.FormDataContentType())
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// envVars returns env in the form the API expects, sorted by name.
+func envVars(env map[string]string) []map[string]string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vars := make([]map[string]string, 0, len(env))
+	for _, name := range names {
+		vars = append(vars, map[string]string{"key": name, "value": env[name]})
+	}
+	return vars
+}
+
+// Get returns the function name.
+func (c *Client) Get(ctx context.Context, name string) (*apiv1.Function, error) {
+	var fn apiv1.Function
+	if err := c.getJSON(ctx, "/functions/"+url.PathEscape(name), nil, &fn); err != nil {
+		return nil, err
+	}
+	return &fn, nil
+}
+
+// Env returns the environment variables of the function name with their literal
+// values, which Get and List redact. It requires the developer role.
+func (c *Client) Env(ctx context.Context, name string) ([]apiv1.EnvVar, error) {
+	var fn apiv1.Function
+	query := url.Values{"showEnvValues": {"true"}}
+	if err := c.getJSON(ctx, "/functions/"+url.PathEscape(name), query, &fn); err != nil {
+		return nil, err
+	}
+	return fn.Env, nil
+}
+
+// ListOptions filter, order and paginate List. The zero value lists every function
+// by name.
+type ListOptions struct {
+	LabelSelector string
+	Status        []string // apiv1 states to keep
+	Sort          string   // "name", "updated", prefixed with "-" for descending order
+	Limit         int
+	// Continue is the Continue token of the previous page.
+	Continue string
+}
+
+// List returns a page of functions. More pages are available while the Continue
+// field of the result is set.
+func (c *Client) List(ctx context.Context, opts ListOptions) (*apiv1.FunctionList, error) {
+	query := url.Values{}
+	if opts.LabelSelector != "" {
+		query.Set("labelSelector", opts.LabelSelector)
+	}
+	if len(opts.Status) > 0 {
+		query.Set("status", strings.Join(opts.Status, ","))
+	}
+	if opts.Sort != "" {
+		query.Set("sort", opts.Sort)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Continue != "" {
+		query.Set("continue", opts.Continue)
+	}
+
+	var list apiv1.FunctionList
+	if err := c.getJSON(ctx, "/functions", query, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Delete deletes the function name.
+func (c *Client) Delete(ctx context.Context, name string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/functions/"+url.PathEscape(name), nil, nil, "")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Status explains the health of the function name.
+func (c *Client) Status(ctx context.Context, name string) (*apiv1.Status, error) {
+	var status apiv1.Status
+	if err := c.getJSON(ctx, "/functions/"+url.PathEscape(name)+"/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// WaitReady polls the status of the function name every interval until it is ready.
+// It fails when the function fails or ctx is done.
+func (c *Client) WaitReady(ctx context.Context, name string, interval time.Duration) (*apiv1.Status, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, err := c.Status(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		switch status.State {
+		case apiv1.StateReady:
+			return status, nil
+		case apiv1.StateFailed:
+			return status, fmt.Errorf("function %s failed: %s", name, status.Summary)
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, fmt.Errorf("function %s is not ready: %w", name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// LogOptions select the log lines returned by Logs.
+type LogOptions struct {
+	// Follow keeps the stream open for new lines.
+	Follow bool
+	// Since, if not zero, skips lines older than this duration.
+	Since time.Duration
+	// Tail, if positive, returns at most this many of the last lines of each pod.
+	Tail     int
+	Revision string
+}
+
+// LogLine is a line logged by a function pod.
+type LogLine struct {
+	Time     time.Time `json:"time"`
+	Pod      string    `json:"pod"`
+	Revision string    `json:"revision"`
+	Message  string    `json:"message"`
+}
+
+// LogStream reads the log lines of a function. It must be closed.
+type LogStream struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+}
+
+// Next returns the next line, or io.EOF at the end of the stream.
+func (s *LogStream) Next() (LogLine, error) {
+	var line LogLine
+	err := s.dec.Decode(&line)
+	return line, err
+}
+
+// Close ends the stream.
+func (s *LogStream) Close() error { return s.body.Close() }
+
+// Logs streams the logs of the pods of the function name. A function scaled to zero
+// has no pods, reported as a not_found error.
+func (c *Client) Logs(ctx context.Context, name string, opts LogOptions) (*LogStream, error) {
+	query := url.Values{"format": {"json"}}
+	if opts.Follow {
+		query.Set("follow", "true")
+	}
+	if opts.Since > 0 {
+		query.Set("since", opts.Since.String())
+	}
+	if opts.Tail > 0 {
+		query.Set("tail", strconv.Itoa(opts.Tail))
+	}
+	if opts.Revision != "" {
+		query.Set("revision", opts.Revision)
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/functions/"+url.PathEscape(name)+"/logs", query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return &LogStream{body: resp.Body, dec: json.NewDecoder(resp.Body)}, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, out interface{}) error {
+	resp, err := c.do(ctx, http.MethodGet, path, query, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response of %s: %w", path, err)
+	}
+	return nil
+}
+
+// do sends a request to the API path and returns the response if it succeeded, or
+// an *Error read from the response otherwise.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	if c.Org != "" {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("org", c.Org)
+	}
+	u := c.BaseURL + "/api" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp, nil
+}
+
+// readError returns the *Error of an error response. Bodies that are not problems,
+// such as those of proxies, become the detail.
+func readError(resp *http.Response) *Error {
+	e := &Error{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if json.Unmarshal(body, &e.Problem) == nil && (e.Problem.Code != "" || e.Problem.Error != "") {
+		if e.Problem.Detail == "" {
+			e.Problem.Detail = e.Problem.Error
+		}
+		return e
+	}
+	e.Problem = apiv1.ProblemDetails{
+		Title:  http.StatusText(resp.StatusCode),
+		Status: resp.StatusCode,
+		Detail: strings.TrimSpace(string(body)),
+	}
+	return e
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	handler "faas-api/internal"
+	"faas-api/internal/fake"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer serves the function routes of the API, backed by in-memory fakes,
+// for a logged in user.
+func newTestServer(t *testing.T, images *fake.ImageBuilder) *Client {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("sub", "github|42")
+		c.Set("username", "jane")
+		c.Set("provider", "github")
+	})
+	p := &handler.Platform{Images: images, Functions: &fake.Deployer{}, Namespaces: &fake.Namespaces{}}
+	api := router.Group("/api")
+	api.POST("/functions", p.PostFunctionHandler)
+	api.GET("/functions", p.ListFunctionsHandler)
+	api.GET("/functions/:name", p.GetFunctionHandler)
+	api.DELETE("/functions/:name", p.DeleteFunctionHandler)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return New(server.URL+"/", "token")
+}
+
+func TestFunctions(t *testing.T) {
+	ctx := context.Background()
+	images := &fake.ImageBuilder{Registry: "registry.test"}
+	c := newTestServer(t, images)
+
+	err := c.Deploy(ctx, DeployRequest{
+		Name:    "hello",
+		Runtime: "python",
+		Archive: bytes.NewReader([]byte("source")),
+		Labels:  map[string]string{"team": "web"},
+		Env:     map[string]string{"B": "2", "A": "1"},
+	})
+	require.NoError(t, err)
+	require.Len(t, images.Built, 1)
+
+	fn, err := c.Get(ctx, "hello")
+	require.NoError(t, err)
+	require.Equal(t, "hello", fn.Name)
+	require.Equal(t, "web", fn.Labels["team"])
+	require.Equal(t, []apiv1.EnvVar{{Name: "A", Value: apiv1.RedactedValue}, {Name: "B", Value: apiv1.RedactedValue}}, fn.Env)
+	env, err := c.Env(ctx, "hello")
+	require.NoError(t, err)
+	require.Equal(t, []apiv1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}}, env)
+
+	list, err := c.List(ctx, ListOptions{LabelSelector: "team=web"})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+
+	err = c.Deploy(ctx, DeployRequest{Name: "hello", Runtime: "python", Archive: bytes.NewReader([]byte("source"))})
+	require.True(t, HasCode(err, apiv1.CodeAlreadyExists), "%v", err)
+
+	require.NoError(t, c.Delete(ctx, "hello"))
+	_, err = c.Get(ctx, "hello")
+	require.True(t, HasCode(err, apiv1.CodeNotFound), "%v", err)
+	var e *Error
+	require.ErrorAs(t, err, &e)
+	require.Equal(t, http.StatusNotFound, e.StatusCode)
+}
+
+func TestDeployErrors(t *testing.T) {
+	ctx := context.Background()
+	c := newTestServer(t, &fake.ImageBuilder{Registry: "registry.test"})
+
+	err := c.Deploy(ctx, DeployRequest{})
+	var e *Error
+	require.ErrorAs(t, err, &e)
+	require.Equal(t, apiv1.CodeValidationFailed, e.Problem.Code)
+	require.Equal(t, http.StatusBadRequest, e.StatusCode)
+	require.Equal(t, "file", e.Problem.Errors[0].Field)
+
+	err = c.Deploy(ctx, DeployRequest{Archive: bytes.NewReader([]byte("source"))})
+	require.ErrorAs(t, err, &e)
+	var fields []string
+	for _, f := range e.Problem.Errors {
+		fields = append(fields, f.Field)
+	}
+	require.ElementsMatch(t, []string{"runtime", "name"}, fields)
+
+	c = newTestServer(t, &fake.ImageBuilder{Registry: "registry.test", Err: io.ErrUnexpectedEOF})
+	err = c.Deploy(ctx, DeployRequest{Name: "hello", Runtime: "python", Archive: bytes.NewReader([]byte("source"))})
+	require.True(t, HasCode(err, apiv1.CodeBuildFailed), "%v", err)
+}
+
+func TestRequests(t *testing.T) {
+	var header http.Header
+	var query url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/functions/hello/status", func(w http.ResponseWriter, r *http.Request) {
+		header, query = r.Header, r.URL.Query()
+		_ = json.NewEncoder(w).Encode(apiv1.Status{State: apiv1.StateReady})
+	})
+	mux.HandleFunc("GET /api/functions/hello/logs", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		enc := json.NewEncoder(w)
+		_ = enc.Encode(LogLine{Pod: "hello-1", Message: "started"})
+		_ = enc.Encode(LogLine{Pod: "hello-1", Message: "ready"})
+	})
+	mux.HandleFunc("GET /api/functions/gone/logs", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+	c := New(server.URL, "faas_pat_secret")
+	c.Org = "acme"
+
+	status, err := c.WaitReady(ctx, "hello", time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, apiv1.StateReady, status.State)
+	require.Equal(t, "Bearer faas_pat_secret", header.Get("Authorization"))
+	require.Equal(t, []string{"acme"}, query["org"])
+
+	stream, err := c.Logs(ctx, "hello", LogOptions{Since: 10 * time.Minute, Tail: 5})
+	require.NoError(t, err)
+	defer stream.Close()
+	require.Equal(t, "json", query.Get("format"))
+	require.Equal(t, "10m0s", query.Get("since"))
+	require.Equal(t, "5", query.Get("tail"))
+	var messages []string
+	for {
+		line, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		messages = append(messages, line.Message)
+	}
+	require.Equal(t, []string{"started", "ready"}, messages)
+
+	_, err = c.Logs(ctx, "gone", LogOptions{})
+	var e *Error
+	require.ErrorAs(t, err, &e)
+	require.Equal(t, http.StatusBadGateway, e.StatusCode)
+	require.Equal(t, "bad gateway", e.Problem.Detail)
+	require.Empty(t, e.Problem.Code)
+}
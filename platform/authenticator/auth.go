@@ -3,59 +3,153 @@ package authenticator
 import (
 	"context"
 	"errors"
-	"os"
-	"strings"
+	"fmt"
+	"net/http"
+
+	"faas-api/internal/config"
 
-	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
 )
 
-// Authenticator is used to authenticate our users.
-type Authenticator struct {
-	*oidc.Provider
-	oauth2.Config
+// ErrLoginFailed is returned by Provider.Callback when the user could not be
+// authenticated, e.g. because of wrong credentials or a denied consent screen.
+var ErrLoginFailed = errors.New("login failed")
+
+// Provider is an identity provider users log in with through the browser.
+type Provider interface {
+	// Name identifies the provider in URLs and sessions, e.g. "github".
+	Name() string
+	// Title is shown on the login page.
+	Title() string
+	// LoginURL returns where to send the browser to start a login.
+	LoginURL(ctx context.Context, state string) (string, error)
+	// Callback completes a login from the request the provider redirected back
+	// with. The state has already been checked.
+	Callback(ctx context.Context, r *http.Request) (*Profile, error)
+	// LogoutURL returns where to send the browser after the local session has been
+	// cleared, so the provider can end its own session and send the user to returnTo.
+	LogoutURL(returnTo string) string
 }
 
-func envSanitized(envVar string) string {
-	return strings.ReplaceAll(os.Getenv(envVar), "\n", "")
+// Refresher is implemented by providers whose logins can be renewed with a refresh
+// token. Refreshing fails once the user's access has been revoked at the provider.
+type Refresher interface {
+	Provider
+	Refresh(ctx context.Context, token *oauth2.Token) (*oauth2.Token, error)
 }
 
-// New instantiates the *Authenticator.
-func New() (*Authenticator, error) {
+// PasswordProvider is implemented by providers that collect credentials on a login
+// form served by the platform itself instead of redirecting to an external site.
+type PasswordProvider interface {
+	Provider
+	PasswordLogin()
+}
 
-	provider, err := oidc.NewProvider(
-		context.Background(),
+// Profile is what the platform knows about a logged in user. Each provider maps its
+// own claims to it.
+type Profile struct {
+	// Subject is unique and immutable across providers, e.g. "github|12345".
+	Subject  string
+	Name     string
+	Nickname string
+	Email    string
+	Picture  string
 
-		"https://"+envSanitized("AUTH0_DOMAIN")+"/")
+	// Token is the OAuth2 token of the login, if the provider issued one.
+	Token *oauth2.Token
+}
+
+// Session returns the profile in the form stored in the server-side session record,
+// see session.Session.Profile.
+func (p *Profile) Session() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":      p.Subject,
+		"name":     p.Name,
+		"nickname": p.Nickname,
+		"email":    p.Email,
+		"picture":  p.Picture,
+	}
+}
 
+// Authenticator is used to authenticate our users.
+type Authenticator struct {
+	providers []Provider
+	secrets   []string
+
+	// Machines lists the issuers whose JWTs workloads may call the API with.
+	Machines *MachineConfig
+}
+
+// New instantiates the *Authenticator from the providers in the providers file, or
+// from the Auth0 settings when no such file is configured. Providers contact their
+// servers lazily, so the server starts even when they are unreachable.
+func New(auth config.Auth) (*Authenticator, error) {
+	cfg, err := LoadProvidersConfig(auth.ProvidersFile)
 	if err != nil {
 		return nil, err
 	}
+	if len(cfg.Providers) == 0 {
+		cfg.Providers = append(cfg.Providers, auth0Provider(auth.Auth0))
+	}
 
-	conf := oauth2.Config{
-		ClientID:     envSanitized("AUTH0_CLIENT_ID"),
-		ClientSecret: envSanitized("AUTH0_CLIENT_SECRET"),
-		RedirectURL:  envSanitized("AUTH0_CALLBACK_URL"),
-		Endpoint:     provider.Endpoint(),
-		Scopes:       []string{oidc.ScopeOpenID, "profile"},
+	providers, err := cfg.Build()
+	if err != nil {
+		return nil, err
 	}
 
-	return &Authenticator{
-		Provider: provider,
-		Config:   conf,
-	}, nil
-}
+	machines, err := LoadMachineConfig(auth.MachineIdentityFile)
+	if err != nil {
+		return nil, err
+	}
 
-// VerifyIDToken verifies that an *oauth2.Token is a valid *oidc.IDToken.
-func (a *Authenticator) VerifyIDToken(ctx context.Context, token *oauth2.Token) (*oidc.IDToken, error) {
-	rawIDToken, ok := token.Extra("id_token").(string)
-	if !ok {
-		return nil, errors.New("no id_token field in oauth2 token")
+	a, err := NewWithProviders(providers, machines)
+	if err != nil {
+		return nil, err
 	}
+	a.secrets = cfg.Secrets()
+	return a, nil
+}
+
+// Secrets returns the credentials read from the providers file, to be kept out of
+// the logs.
+func (a *Authenticator) Secrets() []string {
+	return a.secrets
+}
 
-	oidcConfig := &oidc.Config{
-		ClientID: a.ClientID,
+// NewWithProviders returns an Authenticator for the given providers. The first
+// provider is the default one.
+func NewWithProviders(providers []Provider, machines *MachineConfig) (*Authenticator, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("no identity providers configured")
+	}
+	seen := map[string]bool{}
+	for _, p := range providers {
+		if seen[p.Name()] {
+			return nil, fmt.Errorf("identity provider %q is configured twice", p.Name())
+		}
+		seen[p.Name()] = true
 	}
+	if machines == nil {
+		machines = &MachineConfig{}
+	}
+	return &Authenticator{providers: providers, Machines: machines}, nil
+}
 
-	return a.Verifier(oidcConfig).Verify(ctx, rawIDToken)
+// Providers returns the configured providers in order.
+func (a *Authenticator) Providers() []Provider {
+	return a.providers
+}
+
+// Provider returns the provider with the given name. An empty name selects the
+// default provider.
+func (a *Authenticator) Provider(name string) (Provider, bool) {
+	if name == "" {
+		return a.providers[0], true
+	}
+	for _, p := range a.providers {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+	return nil, false
 }
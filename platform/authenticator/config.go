@@ -0,0 +1,207 @@
+package authenticator
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"faas-api/internal/config"
+	"faas-api/internal/org"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Provider types supported in ProviderConfig.Type.
+const (
+	TypeOIDC   = "oidc"
+	TypeAuth0  = "auth0"
+	TypeGitHub = "github"
+	TypeStatic = "static"
+)
+
+// auth0Connections are the subject prefixes of Auth0 connections. Other providers
+// prefix subjects with their name, so a provider named after a connection could
+// issue the subject of an Auth0 user and take over their namespace.
+var auth0Connections = map[string]bool{
+	"ad": true, "adfs": true, "amazon": true, "apple": true, "auth0": true, "baidu": true,
+	"bitbucket": true, "box": true, "dropbox": true, "email": true, "evernote": true,
+	"exact": true, "facebook": true, "fitbit": true, "github": true, "google-apps": true,
+	"google-oauth2": true, "instagram": true, "ip": true, "line": true, "linkedin": true,
+	"oauth1": true, "oauth2": true, "office365": true, "oidc": true, "okta": true,
+	"paypal": true, "pingfederate": true, "planningcenter": true, "salesforce": true,
+	"samlp": true, "shopify": true, "sms": true, "soundcloud": true, "thirtysevensignals": true,
+	"twitter": true, "vkontakte": true, "waad": true, "weibo": true, "windowslive": true,
+	"wordpress": true, "yahoo": true, "yandex": true,
+}
+
+// providerName restricts provider names, which appear in URLs and subjects.
+var providerName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// ProvidersConfig lists the identity providers users can log in with. The first one
+// is used by /api/login and /api/callback without a provider name.
+type ProvidersConfig struct {
+	Providers []ProviderConfig `json:"providers"`
+}
+
+// ProviderConfig configures one identity provider. Which fields apply depends on Type.
+type ProviderConfig struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+
+	// OAuth2 client settings, used by every type except static.
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret"`
+	// ClientSecretFile is read instead of ClientSecret, e.g. from a mounted secret.
+	ClientSecretFile string   `json:"clientSecretFile"`
+	RedirectURL      string   `json:"redirectURL"`
+	Scopes           []string `json:"scopes"`
+
+	// Issuer is the OIDC issuer URL of an oidc provider, e.g. a Keycloak realm.
+	Issuer string `json:"issuer"`
+	// Claims maps profile fields (subject, name, nickname, email, picture) to the
+	// ID token claims of an oidc provider that hold them.
+	Claims map[string]string `json:"claims"`
+
+	// Domain is the tenant domain of an auth0 provider.
+	Domain string `json:"domain"`
+
+	// BaseURL and APIURL point a github provider at GitHub Enterprise.
+	BaseURL string `json:"baseURL"`
+	APIURL  string `json:"apiURL"`
+
+	// Users of a static provider.
+	Users []StaticUser `json:"users"`
+}
+
+// LoadProvidersConfig reads the identity providers from a YAML or JSON file. An
+// empty path yields an empty configuration.
+func LoadProvidersConfig(file string) (*ProvidersConfig, error) {
+	cfg := &ProvidersConfig{}
+	if file == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity provider config %s: %w", file, err)
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse identity provider config %s: %w", file, err)
+	}
+	for i, pc := range cfg.Providers {
+		if pc.ClientSecretFile == "" {
+			continue
+		}
+		secret, err := os.ReadFile(pc.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("identity provider %s: failed to read client secret: %w", pc.Name, err)
+		}
+		cfg.Providers[i].ClientSecret = strings.TrimRight(string(secret), "\r\n")
+	}
+	return cfg, nil
+}
+
+// Secrets returns the client secrets and plain text passwords of the providers, to
+// be kept out of the logs.
+func (c *ProvidersConfig) Secrets() []string {
+	var secrets []string
+	for _, pc := range c.Providers {
+		if pc.ClientSecret != "" {
+			secrets = append(secrets, pc.ClientSecret)
+		}
+		for _, u := range pc.Users {
+			if u.Password != "" {
+				secrets = append(secrets, u.Password)
+			}
+		}
+	}
+	return secrets
+}
+
+// Build creates the configured providers. It refuses providers whose subjects could
+// collide with those of another provider.
+func (c *ProvidersConfig) Build() ([]Provider, error) {
+	if err := c.checkNames(); err != nil {
+		return nil, err
+	}
+	providers := make([]Provider, 0, len(c.Providers))
+	for _, pc := range c.Providers {
+		if pc.Title == "" {
+			pc.Title = pc.Name
+		}
+
+		var (
+			p   Provider
+			err error
+		)
+		switch pc.Type {
+		case TypeOIDC:
+			p, err = NewOIDCProvider(pc)
+		case TypeAuth0:
+			p, err = NewAuth0Provider(pc)
+		case TypeGitHub:
+			p, err = NewGitHubProvider(pc)
+		case TypeStatic:
+			p, err = NewStaticProvider(pc)
+		default:
+			err = fmt.Errorf("unknown type %q, expected oidc, auth0, github or static", pc.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("identity provider %s: %w", pc.Name, err)
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// checkNames checks that every provider issues its own subjects: names must be
+// unique, not the prefix of organization subjects and not those of Auth0
+// connections, except for the providers whose subjects are Auth0's own, and at most
+// one Auth0 tenant is configured.
+func (c *ProvidersConfig) checkNames() error {
+	seen := make(map[string]bool, len(c.Providers))
+	auth0 := false
+	for _, pc := range c.Providers {
+		if pc.Name == "" {
+			return fmt.Errorf("identity provider of type %q has no name", pc.Type)
+		}
+		if !providerName.MatchString(pc.Name) {
+			return fmt.Errorf("identity provider %s: name must consist of lowercase letters, digits and hyphens", pc.Name)
+		}
+		if seen[pc.Name] {
+			return fmt.Errorf("identity provider %s is configured twice", pc.Name)
+		}
+		seen[pc.Name] = true
+		if pc.Name == org.Provider {
+			return fmt.Errorf("identity provider %s: name is reserved for the subjects of organizations", pc.Name)
+		}
+
+		switch {
+		case pc.Type == TypeAuth0:
+			if auth0 {
+				return fmt.Errorf("identity provider %s: the subjects of two auth0 tenants cannot be told apart", pc.Name)
+			}
+			auth0 = true
+		case pc.Type == TypeGitHub && githubDotCom(pc.BaseURL):
+			// Issues the same github|<id> subjects as the github connection of Auth0.
+		case auth0Connections[pc.Name]:
+			return fmt.Errorf("identity provider %s: name is reserved for the subjects of the auth0 connection of the same name", pc.Name)
+		}
+	}
+	return nil
+}
+
+// auth0Provider is the provider configured by the auth0 section of the server
+// configuration, used when no provider config file is given.
+func auth0Provider(cfg config.Auth0) ProviderConfig {
+	return ProviderConfig{
+		Name:         "auth0",
+		Type:         TypeAuth0,
+		Title:        "Auth0",
+		Domain:       cfg.Domain,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret.Value(),
+		RedirectURL:  cfg.CallbackURL,
+	}
+}
@@ -0,0 +1,135 @@
+package authenticator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// GitHubProvider logs users in with a GitHub OAuth app. Subjects have the form
+// "github|<user id>", the same as GitHub users logging in through Auth0, so users
+// keep their namespace when switching between the two. GitHub Enterprise subjects
+// are prefixed with the provider name instead.
+type GitHubProvider struct {
+	name          string
+	title         string
+	config        oauth2.Config
+	apiURL        string
+	subjectPrefix string
+}
+
+func NewGitHubProvider(cfg ProviderConfig) (*GitHubProvider, error) {
+	if cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, fmt.Errorf("clientID and clientSecret are required")
+	}
+	baseURL := strings.TrimSuffix(cfg.BaseURL, "/")
+	subjectPrefix := cfg.Name
+	if githubDotCom(baseURL) {
+		baseURL = "https://github.com"
+		subjectPrefix = "github"
+	}
+	apiURL := strings.TrimSuffix(cfg.APIURL, "/")
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"read:user", "user:email"}
+	}
+
+	return &GitHubProvider{
+		name:  cfg.Name,
+		title: cfg.Title,
+		config: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  baseURL + "/login/oauth/authorize",
+				TokenURL: baseURL + "/login/oauth/access_token",
+			},
+		},
+		apiURL:        apiURL,
+		subjectPrefix: subjectPrefix,
+	}, nil
+}
+
+// githubDotCom reports whether baseURL, empty by default, is that of github.com
+// rather than GitHub Enterprise.
+func githubDotCom(baseURL string) bool {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return baseURL == "" || baseURL == "https://github.com"
+}
+
+func (p *GitHubProvider) Name() string  { return p.name }
+func (p *GitHubProvider) Title() string { return p.title }
+
+func (p *GitHubProvider) LoginURL(_ context.Context, state string) (string, error) {
+	return p.config.AuthCodeURL(state), nil
+}
+
+func (p *GitHubProvider) Callback(ctx context.Context, r *http.Request) (*Profile, error) {
+	if e := r.URL.Query().Get("error"); e != "" {
+		return nil, fmt.Errorf("%w: %s", ErrLoginFailed, e)
+	}
+
+	token, err := p.config.Exchange(ctx, r.URL.Query().Get("code"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to exchange the authorization code: %v", ErrLoginFailed, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.apiURL+"/user", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := p.config.Client(ctx, token).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get github user: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get github user: %s", resp.Status)
+	}
+
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode github user: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("%w: github user has no id", ErrLoginFailed)
+	}
+
+	return &Profile{
+		Subject:  p.subjectPrefix + "|" + strconv.FormatInt(user.ID, 10),
+		Name:     firstNonEmpty(user.Name, user.Login),
+		Nickname: user.Login,
+		Email:    user.Email,
+		Picture:  user.AvatarURL,
+		Token:    token,
+	}, nil
+}
+
+// Refresh renews an expired login. Only GitHub Apps with expiring user tokens issue
+// refresh tokens; tokens of OAuth apps never expire.
+func (p *GitHubProvider) Refresh(ctx context.Context, token *oauth2.Token) (*oauth2.Token, error) {
+	return p.config.TokenSource(ctx, token).Token()
+}
+
+// LogoutURL returns returnTo: GitHub has no way for OAuth apps to end the user's
+// GitHub session.
+func (p *GitHubProvider) LogoutURL(returnTo string) string {
+	return returnTo
+}
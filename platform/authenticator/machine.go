@@ -0,0 +1,215 @@
+package authenticator
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"faas-api/internal/org"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// ErrUntrustedToken is returned for JWTs that are malformed, not signed by a
+	// trusted issuer or not issued for one of its audiences.
+	ErrUntrustedToken = errors.New("untrusted machine token")
+	// ErrNoMatchingRule is returned for valid JWTs that no rule maps to a tenant.
+	ErrNoMatchingRule = errors.New("no rule grants access to this machine identity")
+)
+
+// MachineConfig lists the issuers whose JWTs are accepted from workloads such as
+// GitHub Actions or service accounts of other clusters.
+type MachineConfig struct {
+	Issuers []*TrustedIssuer `json:"issuers"`
+}
+
+// TrustedIssuer is an OIDC issuer whose tokens are accepted for any of Audiences.
+// Rules are evaluated in order and the first match decides the tenant and role.
+type TrustedIssuer struct {
+	Issuer    string        `json:"issuer"`
+	Audiences []string      `json:"audiences"`
+	Rules     []MachineRule `json:"rules"`
+
+	mu       sync.Mutex
+	verifier *oidc.IDTokenVerifier
+}
+
+// MachineRule maps tokens whose claims match every pattern in Match to the
+// organization Org with Role. Patterns use path.Match syntax, e.g. "acme/*".
+type MachineRule struct {
+	Match map[string]string `json:"match"`
+	Org   string            `json:"org"`
+	Role  org.Role          `json:"role"`
+}
+
+// MachineIdentity is a verified machine token and the access it was granted.
+type MachineIdentity struct {
+	Issuer  string
+	Subject string
+	Claims  map[string]interface{}
+	Org     string
+	Role    org.Role
+}
+
+// LoadMachineConfig reads the trusted issuers from a YAML or JSON file. An empty
+// path disables machine tokens.
+func LoadMachineConfig(file string) (*MachineConfig, error) {
+	cfg := &MachineConfig{}
+	if file == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read machine identity config %s: %w", file, err)
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse machine identity config %s: %w", file, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid machine identity config %s: %w", file, err)
+	}
+	return cfg, nil
+}
+
+func (c *MachineConfig) validate() error {
+	for i, issuer := range c.Issuers {
+		if issuer.Issuer == "" {
+			return fmt.Errorf("issuer %d has no issuer URL", i)
+		}
+		if len(issuer.Audiences) == 0 {
+			return fmt.Errorf("issuer %s has no audiences", issuer.Issuer)
+		}
+		for j, rule := range issuer.Rules {
+			if len(rule.Match) == 0 {
+				return fmt.Errorf("rule %d of issuer %s matches every token, add at least one claim", j, issuer.Issuer)
+			}
+			if rule.Org == "" || !rule.Role.Valid() {
+				return fmt.Errorf("rule %d of issuer %s needs an org and a role of viewer, developer or admin", j, issuer.Issuer)
+			}
+			for claim, pattern := range rule.Match {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("rule %d of issuer %s has an invalid pattern for %s: %w", j, issuer.Issuer, claim, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// IsJWT reports whether a bearer token looks like a JWT rather than one of the
+// platform's own tokens.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && strings.HasPrefix(token, "eyJ")
+}
+
+// VerifyMachineToken verifies a JWT issued to a workload and maps it to a tenant
+// and role using the rules of its issuer.
+func (a *Authenticator) VerifyMachineToken(ctx context.Context, raw string) (*MachineIdentity, error) {
+	if a.Machines == nil {
+		return nil, ErrUntrustedToken
+	}
+
+	iss, err := unverifiedIssuer(raw)
+	if err != nil {
+		return nil, ErrUntrustedToken
+	}
+	idx := slices.IndexFunc(a.Machines.Issuers, func(t *TrustedIssuer) bool { return t.Issuer == iss })
+	if idx < 0 {
+		return nil, ErrUntrustedToken
+	}
+	issuer := a.Machines.Issuers[idx]
+
+	verifier, err := issuer.getVerifier(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUntrustedToken, err)
+	}
+	if !slices.ContainsFunc(token.Audience, func(aud string) bool { return slices.Contains(issuer.Audiences, aud) }) {
+		return nil, fmt.Errorf("%w: audience %v is not trusted", ErrUntrustedToken, token.Audience)
+	}
+
+	var claims map[string]interface{}
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUntrustedToken, err)
+	}
+
+	for _, rule := range issuer.Rules {
+		if rule.matches(claims) {
+			return &MachineIdentity{
+				Issuer:  token.Issuer,
+				Subject: token.Subject,
+				Claims:  claims,
+				Org:     rule.Org,
+				Role:    rule.Role,
+			}, nil
+		}
+	}
+	return nil, ErrNoMatchingRule
+}
+
+// getVerifier discovers the issuer's signing keys the first time one of its tokens is
+// seen, so unreachable issuers do not prevent startup. Failed discoveries are retried.
+func (t *TrustedIssuer) getVerifier(ctx context.Context) (*oidc.IDTokenVerifier, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.verifier != nil {
+		return t.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, t.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover issuer %s: %w", t.Issuer, err)
+	}
+	// Audiences are checked against the configured list instead of a single client ID.
+	t.verifier = provider.Verifier(&oidc.Config{SkipClientIDCheck: true})
+	return t.verifier, nil
+}
+
+func (r MachineRule) matches(claims map[string]interface{}) bool {
+	for claim, pattern := range r.Match {
+		value, ok := claims[claim]
+		if !ok {
+			return false
+		}
+		s, ok := value.(string)
+		if !ok {
+			s = fmt.Sprint(value)
+		}
+		if matched, _ := path.Match(pattern, s); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// unverifiedIssuer reads the "iss" claim so the right verifier can be chosen. The
+// token is verified against that issuer's keys afterwards.
+func unverifiedIssuer(raw string) (string, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed jwt")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed jwt payload: %w", err)
+	}
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("malformed jwt payload: %w", err)
+	}
+	return claims.Issuer, nil
+}
@@ -0,0 +1,138 @@
+package authenticator
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"faas-api/internal/org"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer = "https://token.actions.githubusercontent.com"
+
+func newTestAuthenticator(t *testing.T) (*Authenticator, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	issuer := &TrustedIssuer{
+		Issuer:    testIssuer,
+		Audiences: []string{"faas-api"},
+		Rules: []MachineRule{
+			{Match: map[string]string{"repository": "acme/*", "ref": "refs/heads/main"}, Org: "acme", Role: org.RoleDeveloper},
+			{Match: map[string]string{"repository": "acme/*"}, Org: "acme", Role: org.RoleViewer},
+		},
+		verifier: oidc.NewVerifier(testIssuer, &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{&key.PublicKey}}, &oidc.Config{SkipClientIDCheck: true}),
+	}
+	return &Authenticator{Machines: &MachineConfig{Issuers: []*TrustedIssuer{issuer}}}, key
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, nil)
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed, err := signer.Sign(payload)
+	require.NoError(t, err)
+	raw, err := signed.CompactSerialize()
+	require.NoError(t, err)
+	return raw
+}
+
+func claims(overrides map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{
+		"iss":        testIssuer,
+		"aud":        "faas-api",
+		"sub":        "repo:acme/api:ref:refs/heads/main",
+		"repository": "acme/api",
+		"ref":        "refs/heads/main",
+		"exp":        time.Now().Add(time.Hour).Unix(),
+		"iat":        time.Now().Unix(),
+	}
+	for k, v := range overrides {
+		c[k] = v
+	}
+	return c
+}
+
+func TestVerifyMachineToken(t *testing.T) {
+	a, key := newTestAuthenticator(t)
+
+	raw := signToken(t, key, claims(nil))
+	require.True(t, IsJWT(raw))
+	identity, err := a.VerifyMachineToken(t.Context(), raw)
+	require.NoError(t, err)
+	require.Equal(t, "acme", identity.Org)
+	require.Equal(t, org.RoleDeveloper, identity.Role)
+	require.Equal(t, "repo:acme/api:ref:refs/heads/main", identity.Subject)
+
+	identity, err = a.VerifyMachineToken(t.Context(), signToken(t, key, claims(map[string]interface{}{"ref": "refs/heads/feature"})))
+	require.NoError(t, err)
+	require.Equal(t, org.RoleViewer, identity.Role, "the first matching rule wins")
+}
+
+func TestVerifyMachineTokenRejects(t *testing.T) {
+	a, key := newTestAuthenticator(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		raw string
+		err error
+	}{
+		"wrong audience":   {signToken(t, key, claims(map[string]interface{}{"aud": "someone-else"})), ErrUntrustedToken},
+		"untrusted issuer": {signToken(t, key, claims(map[string]interface{}{"iss": "https://evil.example.com"})), ErrUntrustedToken},
+		"wrong key":        {signToken(t, other, claims(nil)), ErrUntrustedToken},
+		"expired":          {signToken(t, key, claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})), ErrUntrustedToken},
+		"no matching rule": {signToken(t, key, claims(map[string]interface{}{"repository": "evil/api"})), ErrNoMatchingRule},
+		"malformed":        {"eyJhbGciOi.not.ajwt", ErrUntrustedToken},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := a.VerifyMachineToken(t.Context(), tt.raw)
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestLoadMachineConfig(t *testing.T) {
+	cfg, err := LoadMachineConfig("")
+	require.NoError(t, err)
+	require.Empty(t, cfg.Issuers)
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yml")
+	require.NoError(t, os.WriteFile(valid, []byte(`
+issuers:
+  - issuer: https://token.actions.githubusercontent.com
+    audiences: [faas-api]
+    rules:
+      - match: {repository: "acme/*"}
+        org: acme
+        role: developer
+`), 0o600))
+	cfg, err = LoadMachineConfig(valid)
+	require.NoError(t, err)
+	require.Len(t, cfg.Issuers, 1)
+	require.Equal(t, org.RoleDeveloper, cfg.Issuers[0].Rules[0].Role)
+
+	catchAll := filepath.Join(dir, "catch-all.yml")
+	require.NoError(t, os.WriteFile(catchAll, []byte(`
+issuers:
+  - issuer: https://token.actions.githubusercontent.com
+    audiences: [faas-api]
+    rules:
+      - org: acme
+        role: admin
+`), 0o600))
+	_, err = LoadMachineConfig(catchAll)
+	require.Error(t, err, "rules without claims would trust every token of the issuer")
+}
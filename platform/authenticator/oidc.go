@@ -0,0 +1,233 @@
+package authenticator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider logs users in with any OpenID Connect provider, e.g. Keycloak, Dex or
+// Google. The issuer is discovered on the first login, not at startup.
+type OIDCProvider struct {
+	name   string
+	title  string
+	issuer string
+	config oauth2.Config
+	claims map[string]string
+
+	// rawSubject keeps the subject claim as is instead of prefixing it with the
+	// provider name, for issuers whose subjects already name the upstream provider.
+	rawSubject bool
+	// logoutURL overrides RP-initiated logout through the end_session_endpoint.
+	logoutURL func(returnTo string) string
+
+	mu         sync.Mutex
+	provider   *oidc.Provider
+	endSession string
+}
+
+var defaultClaims = map[string]string{
+	"subject":  "sub",
+	"name":     "name",
+	"nickname": "preferred_username",
+	"email":    "email",
+	"picture":  "picture",
+}
+
+func NewOIDCProvider(cfg ProviderConfig) (*OIDCProvider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("issuer and clientID are required")
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	claims := make(map[string]string, len(defaultClaims))
+	for field, claim := range defaultClaims {
+		claims[field] = claim
+	}
+	for field, claim := range cfg.Claims {
+		if _, ok := defaultClaims[field]; !ok {
+			return nil, fmt.Errorf("unknown profile field %q in claims", field)
+		}
+		claims[field] = claim
+	}
+
+	return &OIDCProvider{
+		name:   cfg.Name,
+		title:  cfg.Title,
+		issuer: cfg.Issuer,
+		config: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+		},
+		claims: claims,
+	}, nil
+}
+
+// NewAuth0Provider logs users in with Auth0. Auth0 subjects already carry the
+// upstream connection, e.g. "github|12345", and are used unchanged so existing
+// tenants keep their namespaces.
+func NewAuth0Provider(cfg ProviderConfig) (*OIDCProvider, error) {
+	if cfg.Domain == "" {
+		return nil, fmt.Errorf("domain is required")
+	}
+	cfg.Issuer = "https://" + cfg.Domain + "/"
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "profile", oidc.ScopeOfflineAccess}
+	}
+	if cfg.Claims == nil {
+		cfg.Claims = map[string]string{"nickname": "nickname"}
+	}
+
+	p, err := NewOIDCProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.rawSubject = true
+	p.logoutURL = func(returnTo string) string {
+		parameters := url.Values{}
+		parameters.Add("returnTo", returnTo)
+		parameters.Add("client_id", cfg.ClientID)
+		return "https://" + cfg.Domain + "/v2/logout?" + parameters.Encode()
+	}
+	return p, nil
+}
+
+func (p *OIDCProvider) Name() string  { return p.name }
+func (p *OIDCProvider) Title() string { return p.title }
+
+// discover fetches the issuer's configuration, retrying on the next login if it fails.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover issuer %s: %w", p.issuer, err)
+	}
+	var metadata struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	if err := provider.Claims(&metadata); err == nil {
+		p.endSession = metadata.EndSessionEndpoint
+	}
+	p.provider = provider
+	p.config.Endpoint = provider.Endpoint()
+	return provider, nil
+}
+
+func (p *OIDCProvider) LoginURL(ctx context.Context, state string) (string, error) {
+	if _, err := p.discover(ctx); err != nil {
+		return "", err
+	}
+	return p.config.AuthCodeURL(state), nil
+}
+
+func (p *OIDCProvider) Callback(ctx context.Context, r *http.Request) (*Profile, error) {
+	if e := r.URL.Query().Get("error"); e != "" {
+		return nil, fmt.Errorf("%w: %s", ErrLoginFailed, e)
+	}
+
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.config.Exchange(ctx, r.URL.Query().Get("code"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to exchange the authorization code: %v", ErrLoginFailed, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no id_token field in oauth2 token", ErrLoginFailed)
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to verify ID token: %v", ErrLoginFailed, err)
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to read ID token claims: %w", err)
+	}
+	profile, err := p.profile(claims)
+	if err != nil {
+		return nil, err
+	}
+	profile.Token = token
+	return profile, nil
+}
+
+// Refresh renews an expired login with its refresh token.
+func (p *OIDCProvider) Refresh(ctx context.Context, token *oauth2.Token) (*oauth2.Token, error) {
+	if _, err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+	return p.config.TokenSource(ctx, token).Token()
+}
+
+// profile maps ID token claims to a profile using the configured claim names.
+func (p *OIDCProvider) profile(claims map[string]interface{}) (*Profile, error) {
+	get := func(field string) string {
+		s, _ := claims[p.claims[field]].(string)
+		return s
+	}
+
+	subject := get("subject")
+	if subject == "" {
+		return nil, fmt.Errorf("%w: ID token has no %s claim", ErrLoginFailed, p.claims["subject"])
+	}
+	if !p.rawSubject {
+		subject = p.name + "|" + subject
+	}
+
+	profile := &Profile{
+		Subject:  subject,
+		Name:     get("name"),
+		Nickname: get("nickname"),
+		Email:    get("email"),
+		Picture:  get("picture"),
+	}
+	if profile.Name == "" {
+		profile.Name = firstNonEmpty(profile.Nickname, profile.Email, subject)
+	}
+	return profile, nil
+}
+
+func (p *OIDCProvider) LogoutURL(returnTo string) string {
+	if p.logoutURL != nil {
+		return p.logoutURL(returnTo)
+	}
+
+	p.mu.Lock()
+	endSession := p.endSession
+	p.mu.Unlock()
+	if endSession == "" {
+		return returnTo
+	}
+
+	parameters := url.Values{}
+	parameters.Add("post_logout_redirect_uri", returnTo)
+	parameters.Add("client_id", p.config.ClientID)
+	return endSession + "?" + parameters.Encode()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
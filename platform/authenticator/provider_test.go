@@ -0,0 +1,214 @@
+package authenticator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func postForm(values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/callback/dev", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestStaticProvider(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	p, err := NewStaticProvider(ProviderConfig{Name: "dev", Title: "Dev", Users: []StaticUser{
+		{Username: "jane", Password: "jane", Name: "Jane Doe"},
+		{Username: "bob", PasswordHash: string(hash)},
+	}})
+	require.NoError(t, err)
+
+	loginURL, err := p.LoginURL(t.Context(), "a+b")
+	require.NoError(t, err)
+	require.Equal(t, "/api/login/dev/form?state=a%2Bb", loginURL)
+
+	profile, err := p.Callback(t.Context(), postForm(url.Values{"username": {"jane"}, "password": {"jane"}}))
+	require.NoError(t, err)
+	require.Equal(t, "dev|jane", profile.Subject)
+	require.Equal(t, "Jane Doe", profile.Name)
+
+	profile, err = p.Callback(t.Context(), postForm(url.Values{"username": {"bob"}, "password": {"s3cret"}}))
+	require.NoError(t, err)
+	require.Equal(t, "bob", profile.Name)
+
+	_, err = p.Callback(t.Context(), postForm(url.Values{"username": {"bob"}, "password": {"wrong"}}))
+	require.ErrorIs(t, err, ErrLoginFailed)
+	_, err = p.Callback(t.Context(), postForm(url.Values{"username": {"nobody"}, "password": {""}}))
+	require.ErrorIs(t, err, ErrLoginFailed)
+
+	require.Equal(t, "http://localhost", p.LogoutURL("http://localhost"))
+}
+
+func TestGitHubProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "the-code", r.PostForm.Get("code"))
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"gho_token","token_type":"bearer"}`))
+		case "/api/user":
+			require.Equal(t, "Bearer gho_token", r.Header.Get("Authorization"))
+			w.Write([]byte(`{"id":12345,"login":"octocat","name":"","avatar_url":"https://avatars/1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	p, err := NewGitHubProvider(ProviderConfig{
+		Name: "ghe", ClientID: "id", ClientSecret: "secret",
+		BaseURL: server.URL, APIURL: server.URL + "/api",
+	})
+	require.NoError(t, err)
+
+	loginURL, err := p.LoginURL(t.Context(), "xyz")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(loginURL, server.URL+"/login/oauth/authorize?"), loginURL)
+
+	profile, err := p.Callback(t.Context(), httptest.NewRequest(http.MethodGet, "/api/callback/ghe?code=the-code&state=xyz", nil))
+	require.NoError(t, err)
+	require.Equal(t, "ghe|12345", profile.Subject, "enterprise subjects are prefixed with the provider name")
+	require.Equal(t, "octocat", profile.Name)
+	require.Equal(t, "https://avatars/1", profile.Picture)
+
+	_, err = p.Callback(t.Context(), httptest.NewRequest(http.MethodGet, "/api/callback/ghe?error=access_denied", nil))
+	require.ErrorIs(t, err, ErrLoginFailed)
+
+	public, err := NewGitHubProvider(ProviderConfig{Name: "gh", ClientID: "id", ClientSecret: "secret"})
+	require.NoError(t, err)
+	require.Equal(t, "github", public.subjectPrefix, "github.com subjects match the ones issued through Auth0")
+}
+
+func TestOIDCClaimMapping(t *testing.T) {
+	p, err := NewOIDCProvider(ProviderConfig{
+		Name: "keycloak", Issuer: "https://keycloak.example.com/realms/faas", ClientID: "faas",
+		Claims: map[string]string{"name": "given_name"},
+	})
+	require.NoError(t, err)
+
+	profile, err := p.profile(map[string]interface{}{
+		"sub":                "f81d4fae",
+		"given_name":         "Jane",
+		"preferred_username": "jane",
+		"email":              "jane@example.com",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "keycloak|f81d4fae", profile.Subject)
+	require.Equal(t, "Jane", profile.Name)
+	require.Equal(t, "jane", profile.Nickname)
+
+	_, err = p.profile(map[string]interface{}{"name": "no subject"})
+	require.ErrorIs(t, err, ErrLoginFailed)
+
+	_, err = NewOIDCProvider(ProviderConfig{Name: "x", Issuer: "https://x", ClientID: "x", Claims: map[string]string{"avatar": "pic"}})
+	require.Error(t, err)
+}
+
+func TestAuth0Provider(t *testing.T) {
+	p, err := NewAuth0Provider(ProviderConfig{Name: "auth0", Domain: "tenant.eu.auth0.com", ClientID: "client"})
+	require.NoError(t, err)
+
+	profile, err := p.profile(map[string]interface{}{"sub": "github|12345", "name": "Jane", "nickname": "jane"})
+	require.NoError(t, err)
+	require.Equal(t, "github|12345", profile.Subject, "auth0 subjects are kept unchanged")
+	require.Equal(t, "jane", profile.Nickname)
+
+	logout, err := url.Parse(p.LogoutURL("https://www.faas.test"))
+	require.NoError(t, err)
+	require.Equal(t, "tenant.eu.auth0.com", logout.Host)
+	require.Equal(t, "/v2/logout", logout.Path)
+	require.Equal(t, "https://www.faas.test", logout.Query().Get("returnTo"))
+	require.Equal(t, "client", logout.Query().Get("client_id"))
+}
+
+func TestProvidersConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "providers.yml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+providers:
+  - name: dev
+    type: static
+    users:
+      - {username: jane, password: jane}
+  - name: keycloak
+    type: oidc
+    title: Keycloak
+    issuer: https://keycloak.example.com/realms/faas
+    clientID: faas
+    clientSecret: keycloak-secret
+`), 0o600))
+
+	cfg, err := LoadProvidersConfig(file)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"jane", "keycloak-secret"}, cfg.Secrets())
+	providers, err := cfg.Build()
+	require.NoError(t, err)
+
+	auth, err := NewWithProviders(providers, nil)
+	require.NoError(t, err)
+	def, ok := auth.Provider("")
+	require.True(t, ok)
+	require.Equal(t, "dev", def.Name(), "the first provider is the default")
+	keycloak, ok := auth.Provider("keycloak")
+	require.True(t, ok)
+	require.Equal(t, "Keycloak", keycloak.Title())
+	_, ok = auth.Provider("missing")
+	require.False(t, ok)
+
+	_, err = NewWithProviders([]Provider{providers[0], providers[0]}, nil)
+	require.Error(t, err, "provider names must be unique")
+
+	_, err = (&ProvidersConfig{Providers: []ProviderConfig{{Name: "x", Type: "saml"}}}).Build()
+	require.Error(t, err)
+}
+
+func TestProvidersConfigRefusesClashingSubjects(t *testing.T) {
+	static := func(name string) ProviderConfig {
+		return ProviderConfig{Name: name, Type: TypeStatic, Users: []StaticUser{{Username: "jane", Password: "jane"}}}
+	}
+	auth0 := func(name string) ProviderConfig {
+		return ProviderConfig{Name: name, Type: TypeAuth0, Domain: name + ".eu.auth0.com", ClientID: "client"}
+	}
+	github := func(name, baseURL string) ProviderConfig {
+		return ProviderConfig{Name: name, Type: TypeGitHub, BaseURL: baseURL, ClientID: "id", ClientSecret: "secret"}
+	}
+
+	tests := []struct {
+		name      string
+		providers []ProviderConfig
+		valid     bool
+	}{
+		{"auth0 and github.com", []ProviderConfig{auth0("auth0"), github("github", "")}, true},
+		{"github enterprise", []ProviderConfig{github("ghe", "https://ghe.example.com")}, true},
+		{"static named after a connection", []ProviderConfig{static("github")}, false},
+		{"static named after auth0 database", []ProviderConfig{static("auth0")}, false},
+		{"github enterprise named github", []ProviderConfig{github("github", "https://ghe.example.com")}, false},
+		{"oidc named google-oauth2", []ProviderConfig{{Name: "google-oauth2", Type: TypeOIDC, Issuer: "https://accounts.google.com", ClientID: "x"}}, false},
+		{"duplicate names", []ProviderConfig{static("dev"), static("dev")}, false},
+		{"two auth0 tenants", []ProviderConfig{auth0("eu"), auth0("us")}, false},
+		{"separator in name", []ProviderConfig{static("dev|github")}, false},
+		{"static named after organizations", []ProviderConfig{static("org")}, false},
+		{"oidc named after organizations", []ProviderConfig{{Name: "org", Type: TypeOIDC, Issuer: "https://accounts.google.com", ClientID: "x"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&ProvidersConfig{Providers: tt.providers}).Build()
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package authenticator
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// StaticUser is a user of a static provider. Passwords are given either as a bcrypt
+// hash or, for throwaway development setups, in plain text.
+type StaticUser struct {
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	PasswordHash string `json:"passwordHash"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+}
+
+// StaticProvider logs in users listed in its configuration with a password form
+// served by the platform. It needs no network access, which makes it suitable for
+// local development and tests. Subjects have the form "<provider name>|<username>".
+type StaticProvider struct {
+	name  string
+	title string
+	users map[string]StaticUser
+}
+
+func NewStaticProvider(cfg ProviderConfig) (*StaticProvider, error) {
+	if len(cfg.Users) == 0 {
+		return nil, fmt.Errorf("at least one user is required")
+	}
+	users := make(map[string]StaticUser, len(cfg.Users))
+	for _, u := range cfg.Users {
+		if u.Username == "" {
+			return nil, fmt.Errorf("user without username")
+		}
+		if u.Password == "" && u.PasswordHash == "" {
+			return nil, fmt.Errorf("user %s has no password or passwordHash", u.Username)
+		}
+		if _, ok := users[u.Username]; ok {
+			return nil, fmt.Errorf("user %s is listed twice", u.Username)
+		}
+		users[u.Username] = u
+	}
+	return &StaticProvider{name: cfg.Name, title: cfg.Title, users: users}, nil
+}
+
+func (p *StaticProvider) Name() string  { return p.name }
+func (p *StaticProvider) Title() string { return p.title }
+
+// PasswordLogin marks the provider as using the platform's login form.
+func (p *StaticProvider) PasswordLogin() {}
+
+func (p *StaticProvider) LoginURL(_ context.Context, state string) (string, error) {
+	return "/api/login/" + url.PathEscape(p.name) + "/form?state=" + url.QueryEscape(state), nil
+}
+
+// Callback checks the username and password posted by the login form.
+func (p *StaticProvider) Callback(_ context.Context, r *http.Request) (*Profile, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLoginFailed, err)
+	}
+	username := r.PostForm.Get("username")
+	password := r.PostForm.Get("password")
+
+	user, ok := p.users[username]
+	if !ok || !user.checkPassword(password) {
+		return nil, fmt.Errorf("%w: invalid username or password", ErrLoginFailed)
+	}
+
+	return &Profile{
+		Subject:  p.name + "|" + user.Username,
+		Name:     firstNonEmpty(user.Name, user.Username),
+		Nickname: user.Username,
+		Email:    user.Email,
+	}, nil
+}
+
+func (u StaticUser) checkPassword(password string) bool {
+	if u.PasswordHash != "" {
+		return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1
+}
+
+func (p *StaticProvider) LogoutURL(returnTo string) string {
+	return returnTo
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"faas-api/internal/apierror"
+	"faas-api/internal/logging"
+	"faas-api/internal/pat"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessTokenKey is the context key of the *pat.Token a request was authenticated with.
+const accessTokenKey = "access_token"
+
+func accessTokenFromRequest(r *http.Request) string {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && pat.IsToken(bearer) {
+		return bearer
+	}
+	return ""
+}
+
+// authenticateAccessToken authenticates the request as the owner of a personal access token.
+func (a *Auth) authenticateAccessToken(ctx *gin.Context, presented string) {
+	token, err := a.Tokens.Authenticate(ctx, presented)
+	if err != nil {
+		switch {
+		case errors.Is(err, pat.ErrInvalidToken), errors.Is(err, pat.ErrRevoked), errors.Is(err, pat.ErrExpired):
+			apierror.Abort(ctx, apierror.Wrap(err, apiv1.CodeUnauthenticated, ""))
+		default:
+			logging.From(ctx).WithError(err).Error("failed to verify access token")
+			apierror.Abort(ctx, apierror.New(apiv1.CodeInternal, "failed to verify access token"))
+		}
+		return
+	}
+
+	ctx.Set("sub", token.Subject)
+	ctx.Set("display_name", token.DisplayName)
+	ctx.Set("username", token.Username)
+	ctx.Set("provider", token.Provider)
+	ctx.Set(accessTokenKey, token)
+	ctx.Next()
+}
+
+// RequireScope rejects requests authenticated with a personal access token that
+// lacks scope. Session and API key requests are not affected.
+func RequireScope(scope pat.Scope) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if token, ok := ctx.Value(accessTokenKey).(*pat.Token); ok && !token.Allows(scope) {
+			apierror.Abort(ctx, apierror.New(apiv1.CodeForbidden, "access token requires the %s scope", scope))
+			return
+		}
+		ctx.Next()
+	}
+}
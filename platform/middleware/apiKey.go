@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"faas-api/internal/apierror"
+	"faas-api/internal/apikey"
+	"faas-api/internal/logging"
+	apiv1 "faas-api/pkg/api/v1"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IsAuthenticatedOrAPIKey accepts a function API key from the X-API-Key header or
+// an "Authorization: Bearer" header, and falls back to IsAuthenticated otherwise.
+// On routes with a :name parameter the key must be valid for that function; other
+// routes get the key's function scope as "apikey_function" and must check it themselves.
+func (a *Auth) IsAuthenticatedOrAPIKey(ctx *gin.Context) {
+	token := apiKeyFromRequest(ctx.Request)
+	if token == "" {
+		a.IsAuthenticated(ctx)
+		return
+	}
+
+	key, err := a.APIKeys.Authenticate(ctx, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, apikey.ErrInvalidKey), errors.Is(err, apikey.ErrRevoked), errors.Is(err, apikey.ErrExpired):
+			apierror.Abort(ctx, apierror.Wrap(err, apiv1.CodeUnauthenticated, ""))
+		default:
+			logging.From(ctx).WithError(err).Error("failed to verify api key")
+			apierror.Abort(ctx, apierror.New(apiv1.CodeInternal, "failed to verify api key"))
+		}
+		return
+	}
+
+	if name := ctx.Param("name"); name != "" && !key.Allows(name) {
+		apierror.Abort(ctx, apierror.New(apiv1.CodeForbidden, "api key is not valid for this function"))
+		return
+	}
+
+	ctx.Set("sub", "apikey:"+key.ID)
+	ctx.Set("username", "apikey:"+key.ID)
+	ctx.Set("provider", "apikey")
+	ctx.Set("namespace", key.Namespace)
+	ctx.Set("apikey_function", key.Function)
+	ctx.Next()
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && apikey.IsKey(bearer) {
+		return bearer
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+const (
+	// CSRFHeader carries the CSRF token of the session on state-changing requests.
+	CSRFHeader = "X-CSRF-Token"
+	// CSRFTokenKey is the context key of the CSRF token of the session, and the name
+	// of the form field it can be posted in instead of the header.
+	CSRFTokenKey = "csrf_token"
+)
+
+// csrfTokenFromRequest returns the CSRF token sent in the header or, for plain HTML
+// forms, in the form body.
+func csrfTokenFromRequest(r *http.Request) string {
+	if token := r.Header.Get(CSRFHeader); token != "" {
+		return token
+	}
+	return r.PostFormValue(CSRFTokenKey)
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -1,29 +1,74 @@
 package middleware
 
 import (
-	"log"
 	"net/http"
-	"strings"
 
-	"github.com/gin-contrib/sessions"
+	"faas-api/internal/apierror"
+	"faas-api/internal/apikey"
+	"faas-api/internal/org"
+	"faas-api/internal/pat"
+	"faas-api/internal/session"
+	apiv1 "faas-api/pkg/api/v1"
+
 	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/client-go/dynamic"
 )
 
+// Auth authenticates requests with a browser session, a personal access token, a
+// machine JWT or, on the invocation routes, an API key.
+type Auth struct {
+	Sessions *session.Manager
+	Tokens   *pat.Manager
+	APIKeys  *apikey.Manager
+	Orgs     *org.Manager
+	// Machines verifies machine JWTs; nil refuses them.
+	Machines MachineTokenVerifier
+	// Providers renews expired logins with the refresh token of the session; nil
+	// never renews them.
+	Providers IdentityProviders
+
+	// refreshes collapses concurrent refreshes of the same session. Providers rotate
+	// refresh tokens, so a second refresh with the token the first one used would be
+	// rejected and end the session.
+	refreshes singleflight.Group
+}
+
+// NewAuth returns the middleware checking sessions with sessions and the other
+// credentials against the records kept with client.
+func NewAuth(client dynamic.Interface, sessions *session.Manager) *Auth {
+	return &Auth{
+		Sessions: sessions,
+		Tokens:   pat.NewManager(client),
+		APIKeys:  apikey.NewManager(client),
+		Orgs:     org.NewManager(client),
+	}
+}
+
 // IsAuthenticated is a middleware that checks if
 // the user has already been authenticated previously.
-func IsAuthenticated(ctx *gin.Context) {
-
-	profile := sessions.Default(ctx).Get("profile")
-	if profile == nil {
-		ctx.Redirect(http.StatusSeeOther, "/")
+// A personal access token or a trusted machine JWT in an
+// "Authorization: Bearer" header is accepted instead of the session.
+func (a *Auth) IsAuthenticated(ctx *gin.Context) {
+	if token := accessTokenFromRequest(ctx.Request); token != "" {
+		a.authenticateAccessToken(ctx, token)
+		return
+	}
+	if token := machineTokenFromRequest(ctx.Request); token != "" && a.Machines != nil {
+		a.authenticateMachineToken(ctx, token)
+		return
 	}
-	log.Println("user profile:", profile)
-	username := profile.(map[string]interface{})["name"].(string)
-	sub := profile.(map[string]interface{})["sub"].(string)
 
-	provider := strings.Split(sub, "|")[0]
+	a.authenticateSession(ctx)
+}
 
-	ctx.Set("username", strings.ToLower(username))
-	ctx.Set("provider", provider)
-	ctx.Next()
+// unauthenticated stops a request without a valid login. Browsers asking for a page
+// are sent to the login page; API clients get a 401.
+func unauthenticated(ctx *gin.Context) {
+	if ctx.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		ctx.Redirect(http.StatusSeeOther, "/")
+		ctx.Abort()
+		return
+	}
+	apierror.Abort(ctx, apierror.New(apiv1.CodeUnauthenticated, "authentication required"))
 }
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"faas-api/internal/apierror"
+	"faas-api/internal/logging"
+	"faas-api/internal/org"
+	apiv1 "faas-api/pkg/api/v1"
+	"faas-api/platform/authenticator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MachineTokenVerifier verifies JWTs presented by workloads and maps them to a tenant.
+type MachineTokenVerifier interface {
+	VerifyMachineToken(ctx context.Context, raw string) (*authenticator.MachineIdentity, error)
+}
+
+func machineTokenFromRequest(r *http.Request) string {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && authenticator.IsJWT(bearer) {
+		return bearer
+	}
+	return ""
+}
+
+// authenticateMachineToken authenticates a workload. Machine identities act on the
+// namespace of the organization their rule maps them to, with the rule's role.
+func (a *Auth) authenticateMachineToken(ctx *gin.Context, raw string) {
+	identity, err := a.Machines.VerifyMachineToken(ctx, raw)
+	if err != nil {
+		switch {
+		case errors.Is(err, authenticator.ErrUntrustedToken):
+			apierror.Abort(ctx, apierror.Wrap(authenticator.ErrUntrustedToken, apiv1.CodeUnauthenticated, ""))
+		case errors.Is(err, authenticator.ErrNoMatchingRule):
+			apierror.Abort(ctx, apierror.Wrap(err, apiv1.CodeForbidden, ""))
+		default:
+			logging.From(ctx).WithError(err).Error("failed to verify machine token")
+			apierror.Abort(ctx, apierror.New(apiv1.CodeUnavailable, "failed to verify machine token"))
+		}
+		return
+	}
+
+	o, err := a.Orgs.Get(ctx, identity.Org)
+	if err != nil {
+		if errors.Is(err, org.ErrNotFound) {
+			logging.From(ctx).WithField("org", identity.Org).Warn("machine identity rule refers to a missing organization")
+			apierror.Abort(ctx, apierror.New(apiv1.CodeForbidden, "organization of this machine identity does not exist"))
+			return
+		}
+		logging.From(ctx).WithError(err).Error("failed to get organization of machine identity")
+		apierror.Abort(ctx, apierror.New(apiv1.CodeInternal, "failed to verify machine token"))
+		return
+	}
+
+	ctx.Set("sub", "machine:"+identity.Issuer+"#"+identity.Subject)
+	ctx.Set("username", identity.Subject)
+	ctx.Set("provider", "machine")
+	ctx.Set("namespace", o.Namespace)
+	ctx.Set("namespace_role", identity.Role)
+	ctx.Next()
+}
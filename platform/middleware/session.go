@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"faas-api/internal/apierror"
+	"faas-api/internal/k8/store"
+	"faas-api/internal/logging"
+	"faas-api/internal/session"
+	apiv1 "faas-api/pkg/api/v1"
+	"faas-api/platform/authenticator"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// SessionCookieKey is the key of the session token in the session cookie.
+	SessionCookieKey = "session"
+	// SessionIDKey is the context key of the id of the session a request was authenticated with.
+	SessionIDKey = "session_id"
+	// ProfileKey is the context key of the profile of the logged-in user.
+	ProfileKey = "profile"
+)
+
+// IdentityProviders looks up the provider a session was created with.
+type IdentityProviders interface {
+	Provider(name string) (authenticator.Provider, bool)
+}
+
+// authenticateSession authenticates the request with the server-side session the
+// session cookie refers to.
+func (a *Auth) authenticateSession(ctx *gin.Context) {
+	token, _ := sessions.Default(ctx).Get(SessionCookieKey).(string)
+	if token == "" || a.Sessions == nil {
+		unauthenticated(ctx)
+		return
+	}
+
+	s, err := a.Sessions.Authenticate(ctx, token)
+	if err != nil {
+		if !errors.Is(err, session.ErrInvalidSession) && !errors.Is(err, session.ErrExpired) {
+			logging.From(ctx).WithError(err).Error("failed to verify session")
+			apierror.Abort(ctx, apierror.New(apiv1.CodeInternal, "failed to verify session"))
+			return
+		}
+		unauthenticated(ctx)
+		return
+	}
+	if !a.refreshSession(ctx, s) {
+		unauthenticated(ctx)
+		return
+	}
+	// Browsers attach the session cookie to cross-site requests too, so
+	// state-changing requests must also prove they come from our pages.
+	if !safeMethod(ctx.Request.Method) && !s.CheckCSRFToken(csrfTokenFromRequest(ctx.Request)) {
+		apierror.Abort(ctx, apierror.New(apiv1.CodeForbidden, "missing or invalid CSRF token"))
+		return
+	}
+
+	name, _ := s.Profile["name"].(string)
+	ctx.Set("sub", s.Subject)
+	ctx.Set("display_name", name)
+	ctx.Set("username", strings.ToLower(name))
+	ctx.Set("provider", strings.Split(s.Subject, "|")[0])
+	ctx.Set(SessionIDKey, s.ID)
+	ctx.Set(ProfileKey, s.Profile)
+	ctx.Set(CSRFTokenKey, s.CSRFToken)
+	ctx.Header(CSRFHeader, s.CSRFToken)
+	ctx.Next()
+}
+
+// refreshSession renews the login of s once its token has expired. It returns false
+// if the provider rejected the refresh token, e.g. because the user's access was
+// revoked, in which case the session is ended. If the provider cannot be reached the
+// session stays valid and the refresh is retried on the next request.
+func (a *Auth) refreshSession(ctx context.Context, s *session.Session) bool {
+	if !refreshDue(s) || a.Providers == nil {
+		return true
+	}
+	provider, ok := a.Providers.Provider(s.Provider)
+	if !ok {
+		return true
+	}
+	refresher, ok := provider.(authenticator.Refresher)
+	if !ok {
+		return true
+	}
+
+	// The refresh is shared by the requests waiting for it, so it must not be
+	// cancelled with the request that started it.
+	ctx = context.WithoutCancel(ctx)
+	valid, _, _ := a.refreshes.Do(s.ID, func() (interface{}, error) {
+		return a.refresh(ctx, refresher, s.ID), nil
+	})
+	return valid.(bool)
+}
+
+// refresh renews the login of the session id. The session is read again first, as a
+// request served by another replica may have refreshed it already.
+func (a *Auth) refresh(ctx context.Context, refresher authenticator.Refresher, id string) bool {
+	logger := logging.FromContext(ctx).WithField("session", id)
+	s, err := a.Sessions.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false
+		}
+		logger.WithError(err).Warn("failed to load session to refresh")
+		return true
+	}
+	if !refreshDue(s) {
+		return true
+	}
+
+	logger = logger.WithField("provider", s.Provider)
+	token, err := refresher.Refresh(ctx, &oauth2.Token{RefreshToken: s.RefreshToken})
+	if err != nil {
+		var rejected *oauth2.RetrieveError
+		if !errors.As(err, &rejected) {
+			logger.WithError(err).Warn("failed to refresh session")
+			return true
+		}
+		// A rejected token that has been replaced since was rotated by a concurrent
+		// refresh, and says nothing about the user's access.
+		current, getErr := a.Sessions.Get(ctx, id)
+		if getErr != nil {
+			return !errors.Is(getErr, store.ErrNotFound)
+		}
+		if current.RefreshToken != s.RefreshToken {
+			return true
+		}
+		logger.WithError(err).Info("refresh token rejected, ending session")
+		if err := a.Sessions.Revoke(ctx, id); err != nil {
+			logger.WithError(err).Warn("failed to delete session")
+		}
+		return false
+	}
+
+	refreshToken := token.RefreshToken
+	if refreshToken == "" {
+		refreshToken = s.RefreshToken
+	}
+	if err := a.Sessions.UpdateToken(ctx, s, refreshToken, tokenExpiry(token)); err != nil {
+		logger.WithError(err).Warn("failed to store refreshed token")
+	}
+	return true
+}
+
+// refreshDue reports whether the login of s has expired and can be renewed.
+func refreshDue(s *session.Session) bool {
+	return s.RefreshToken != "" && s.TokenExpiry != nil && !time.Now().Before(*s.TokenExpiry)
+}
+
+// tokenExpiry returns when token expires, or nil if it does not.
+func tokenExpiry(token *oauth2.Token) *time.Time {
+	if token == nil || token.Expiry.IsZero() {
+		return nil
+	}
+	expiry := token.Expiry.UTC()
+	return &expiry
+}
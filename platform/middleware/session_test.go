@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"faas-api/internal/k8/store"
+	"faas-api/internal/k8/store/storetest"
+	"faas-api/internal/session"
+	apiv1 "faas-api/pkg/api/v1"
+	"faas-api/platform/authenticator"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// requireProblem checks that w is a problem with code and detail.
+func requireProblem(t *testing.T, w *httptest.ResponseRecorder, code, detail string) {
+	t.Helper()
+	require.Equal(t, apiv1.ProblemContentType, w.Header().Get("Content-Type"))
+	var p apiv1.ProblemDetails
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	require.Equal(t, code, p.Code)
+	require.Equal(t, detail, p.Detail)
+	require.Equal(t, detail, p.Error, "clients of the former error body keep working")
+}
+
+// newTestAuth returns the middleware backed by an in-memory cluster.
+func newTestAuth() *Auth {
+	client := storetest.NewClient()
+	return NewAuth(client, session.NewManager(client, ""))
+}
+
+// newTestRouter returns a router with a GET and POST route protected by a, and a
+// route that logs in as jane.
+func newTestRouter(t *testing.T, a *Auth) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+
+	calls := 0
+	handler := func(ctx *gin.Context) {
+		calls++
+		ctx.JSON(http.StatusOK, gin.H{"sub": ctx.GetString("sub")})
+	}
+
+	router := gin.New()
+	router.Use(sessions.Sessions("auth-session", cookie.NewStore([]byte("test-secret"))))
+	router.GET("/login", func(ctx *gin.Context) {
+		token, err := a.Sessions.Create(ctx, &session.Session{
+			Subject: "github|1",
+			Profile: map[string]interface{}{"name": "Jane"},
+		})
+		require.NoError(t, err)
+		s := sessions.Default(ctx)
+		s.Set(SessionCookieKey, token)
+		require.NoError(t, s.Save())
+	})
+	router.GET("/api/functions", a.IsAuthenticated, handler)
+	router.POST("/api/functions", a.IsAuthenticated, handler)
+	return router, &calls
+}
+
+func serve(router *gin.Engine, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func login(t *testing.T, router *gin.Engine) *http.Cookie {
+	w := serve(router, httptest.NewRequest(http.MethodGet, "/login", nil))
+	require.Len(t, w.Result().Cookies(), 1)
+	return w.Result().Cookies()[0]
+}
+
+func TestUnauthenticated(t *testing.T) {
+	router, calls := newTestRouter(t, newTestAuth())
+
+	r := httptest.NewRequest(http.MethodGet, "/api/functions", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	w := serve(router, r)
+	require.Equal(t, http.StatusSeeOther, w.Code, "browsers are redirected to the login page")
+	require.Equal(t, "/", w.Header().Get("Location"))
+
+	for _, accept := range []string{"", "*/*", "application/json"} {
+		r = httptest.NewRequest(http.MethodGet, "/api/functions", nil)
+		r.Header.Set("Accept", accept)
+		w = serve(router, r)
+		require.Equal(t, http.StatusUnauthorized, w.Code, "accept %q", accept)
+		requireProblem(t, w, apiv1.CodeUnauthenticated, "authentication required")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/functions", nil)
+	r.AddCookie(&http.Cookie{Name: "auth-session", Value: "forged"})
+	require.Equal(t, http.StatusUnauthorized, serve(router, r).Code)
+
+	require.Zero(t, *calls, "handlers must not run after a failed authentication")
+}
+
+func TestSessionAuthentication(t *testing.T) {
+	a := newTestAuth()
+	router, calls := newTestRouter(t, a)
+	cookie := login(t, router)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/functions", nil)
+	r.AddCookie(cookie)
+	w := serve(router, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"sub":"github|1"}`, w.Body.String())
+	csrfToken := w.Header().Get(CSRFHeader)
+	require.NotEmpty(t, csrfToken)
+
+	sessions, err := a.Sessions.List(t.Context(), "github|1")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.NoError(t, a.Sessions.Revoke(t.Context(), sessions[0].ID))
+
+	r = httptest.NewRequest(http.MethodGet, "/api/functions", nil)
+	r.AddCookie(cookie)
+	require.Equal(t, http.StatusUnauthorized, serve(router, r).Code, "revoked sessions are rejected")
+	require.Equal(t, 1, *calls)
+}
+
+func TestCSRFProtection(t *testing.T) {
+	router, calls := newTestRouter(t, newTestAuth())
+	cookie := login(t, router)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/functions", nil)
+	r.AddCookie(cookie)
+	csrfToken := serve(router, r).Header().Get(CSRFHeader)
+	*calls = 0
+
+	r = httptest.NewRequest(http.MethodPost, "/api/functions", nil)
+	r.AddCookie(cookie)
+	w := serve(router, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	requireProblem(t, w, apiv1.CodeForbidden, "missing or invalid CSRF token")
+
+	r = httptest.NewRequest(http.MethodPost, "/api/functions", nil)
+	r.AddCookie(cookie)
+	r.Header.Set(CSRFHeader, "wrong")
+	require.Equal(t, http.StatusForbidden, serve(router, r).Code)
+	require.Zero(t, *calls)
+
+	r = httptest.NewRequest(http.MethodPost, "/api/functions", nil)
+	r.AddCookie(cookie)
+	r.Header.Set(CSRFHeader, csrfToken)
+	require.Equal(t, http.StatusOK, serve(router, r).Code)
+
+	form := url.Values{CSRFTokenKey: {csrfToken}}
+	r = httptest.NewRequest(http.MethodPost, "/api/functions", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(cookie)
+	require.Equal(t, http.StatusOK, serve(router, r).Code, "HTML forms can post the token as a field")
+	require.Equal(t, 2, *calls)
+}
+
+// rotatingProvider accepts each refresh token once and issues a new one, like
+// providers rotating refresh tokens. onRefresh, if set, runs before the token is
+// checked.
+type rotatingProvider struct {
+	authenticator.Provider
+
+	mu        sync.Mutex
+	current   string
+	calls     atomic.Int32
+	onRefresh func()
+}
+
+// providers serves p whatever the name.
+type providers struct{ p authenticator.Provider }
+
+func (ps providers) Provider(string) (authenticator.Provider, bool) { return ps.p, true }
+
+func (p *rotatingProvider) Refresh(_ context.Context, token *oauth2.Token) (*oauth2.Token, error) {
+	p.calls.Add(1)
+	if p.onRefresh != nil {
+		p.onRefresh()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if token.RefreshToken != p.current {
+		return nil, &oauth2.RetrieveError{ErrorCode: "invalid_grant"}
+	}
+	p.current += "+"
+	return &oauth2.Token{RefreshToken: p.current, Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+// newExpiredSession stores a session whose login expired, with refresh token "r",
+// and returns it with the middleware renewing it with p.
+func newExpiredSession(t *testing.T, p *rotatingProvider) (*Auth, *session.Session) {
+	a := newTestAuth()
+	a.Providers = providers{p}
+
+	expired := time.Now().Add(-time.Minute)
+	s := &session.Session{Subject: "github|1", Provider: "github", RefreshToken: "r", TokenExpiry: &expired}
+	_, err := a.Sessions.Create(t.Context(), s)
+	require.NoError(t, err)
+	p.current = "r"
+	return a, s
+}
+
+func TestConcurrentRefreshesShareOneToken(t *testing.T) {
+	p := &rotatingProvider{}
+	a, s := newExpiredSession(t, p)
+
+	var wg sync.WaitGroup
+	valid := make([]bool, 8)
+	for i := range valid {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stale := *s
+			valid[i] = a.refreshSession(t.Context(), &stale)
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, []bool{true, true, true, true, true, true, true, true}, valid)
+	require.EqualValues(t, 1, p.calls.Load(), "the rotated token must not be used again")
+	stored, err := a.Sessions.Get(t.Context(), s.ID)
+	require.NoError(t, err)
+	require.Equal(t, "r+", stored.RefreshToken)
+}
+
+func TestRefreshRejection(t *testing.T) {
+	p := &rotatingProvider{}
+	a, s := newExpiredSession(t, p)
+	// Another replica rotates the token while this one is refreshing.
+	p.onRefresh = func() {
+		p.onRefresh = nil
+		require.NoError(t, a.Sessions.UpdateToken(t.Context(), s, "elsewhere", s.TokenExpiry))
+		p.current = "elsewhere"
+	}
+	require.True(t, a.refreshSession(t.Context(), s), "a token rotated concurrently does not end the session")
+	_, err := a.Sessions.Get(t.Context(), s.ID)
+	require.NoError(t, err)
+
+	p.current = "revoked"
+	require.False(t, a.refreshSession(t.Context(), s), "a rejected current token ends the session")
+	_, err = a.Sessions.Get(t.Context(), s.ID)
+	require.ErrorIs(t, err, store.ErrNotFound)
+}
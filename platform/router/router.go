@@ -1,17 +1,31 @@
 package router
 
 import (
-	"encoding/gob"
+	"context"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 
 	handler "faas-api/internal"
+	"faas-api/internal/apierror"
+	"faas-api/internal/audit"
+	"faas-api/internal/config"
 	"faas-api/internal/function"
+	"faas-api/internal/health"
+	"faas-api/internal/k8/namespace"
+	"faas-api/internal/k8/tenant"
+	"faas-api/internal/logging"
+	"faas-api/internal/metrics"
+	"faas-api/internal/pat"
+	"faas-api/internal/resource"
 	"faas-api/internal/service"
+	"faas-api/internal/session"
+	"faas-api/internal/tracing"
+	apiv1 "faas-api/pkg/api/v1"
 	"faas-api/platform/authenticator"
 	"faas-api/platform/middleware"
 	"faas-api/web/app/app"
@@ -24,56 +38,120 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// New registers the routes and returns the router.
-func New(auth *authenticator.Authenticator) *gin.Engine {
-	if err := function.ConfigDockerClient(); err != nil {
-		log.WithError(err).Error("failed to create docker client")
+// New registers the routes and returns the router. cfg must have been validated.
+// Background work stops when ctx is done, and readiness fails from then on.
+func New(ctx context.Context, cfg *config.Config, auth *authenticator.Authenticator) *gin.Engine {
+	m := metrics.New(metrics.Options{
+		FunctionLabels: cfg.Metrics.FunctionLabels,
+		Runtimes:       cfg.Metrics.Runtimes,
+	})
+
+	images, err := function.NewDockerBuilder(cfg.Registry, m)
+	if err != nil {
+		log.WithError(err).Error("docker daemon not available")
 		os.Exit(1)
 	}
 
-	if err := service.ConfigK8Client(); err != nil {
-		log.WithError(err).Error("failed to create k8s client")
+	client, kube, err := service.Connect(cfg.Kubernetes)
+	if err != nil {
+		log.WithError(err).Error("failed to connect to kubernetes")
 		os.Exit(1)
 	}
 
-	router := gin.Default()
-
-	// To store custom types in our cookies,
-	// we must first register them using gob.Register
-	gob.Register(map[string]interface{}{})
+	tenants, err := tenant.NewProvisioner(client, cfg.Tenant.TemplateFile)
+	if err != nil {
+		log.WithError(err).Error("failed to load tenant template")
+		os.Exit(1)
+	}
+	go tenants.Run(ctx, cfg.Tenant.ReconcileInterval.Std())
+	m.CountInventory(func(ctx context.Context) (metrics.Inventory, error) {
+		namespaces, functions, err := tenants.Count(ctx)
+		return metrics.Inventory{Functions: functions, Tenants: namespaces}, err
+	})
 
-	secret := os.Getenv("COOKIE_SECRET")
-	if secret == "" {
-		log.Fatal("COOKIE_SECRET environment variable is not set")
+	auditLog, err := audit.Open(cfg.Audit.LogFile)
+	if err != nil {
+		log.WithError(err).Error("failed to open audit log")
 		os.Exit(1)
 	}
 
-	store := cookie.NewStore([]byte(secret))
+	sessionManager := session.NewManager(client, cfg.Session.Namespace)
+	sessionManager.IdleTimeout = cfg.Session.IdleTimeout.Std()
+	sessionManager.AbsoluteTimeout = cfg.Session.AbsoluteTimeout.Std()
+	sessionManager.Admins = cfg.PlatformAdmins
+	go sessionManager.Run(ctx, 10*time.Minute)
+
+	h := &handler.Platform{
+		Images:      images,
+		Functions:   resource.NewKnative(client, kube),
+		Namespaces:  namespace.NewManager(client, tenants),
+		Client:      client,
+		KubeClient:  kube,
+		Metrics:     m,
+		Sessions:    sessionManager,
+		Audit:       auditLog,
+		Gateway:     handler.NewGateway(cfg.Invoke),
+		Invocations: handler.NewInvocationRunner(cfg.Invoke.Async),
+	}
+
+	probes := health.New(ctx)
+	probes.Add("docker", images.Ping)
+	probes.Add("registry", images.CheckRegistry)
+	probes.Add("kubernetes", func(ctx context.Context) error { return service.CheckAPI(ctx, kube) })
 
-	cookieDomain := os.Getenv("COOKIE_DOMAIN")
-	cookieSecure := os.Getenv("COOKIE_SECURE")
+	return newRouter(cfg, auth, h, probes)
+}
+
+// newRouter registers every route, served by h and probes. It is separate from New,
+// which connects to Docker and Kubernetes, so that tests see the same routes.
+func newRouter(cfg *config.Config, auth *authenticator.Authenticator, h *handler.Platform, probes *health.Probes) *gin.Engine {
+	m := h.Metrics
+	mw := middleware.NewAuth(h.Client, h.Sessions)
+	if auth != nil {
+		mw.Machines = auth
+		mw.Providers = auth
+	}
+	audited := h.Audit.Middleware
+
+	// Requests are logged by logging.Middleware, and panics through the standard
+	// logger, so that both are structured and redacted. Panics and unknown routes
+	// are answered with problems like every other error.
+	router := gin.New()
+	// Handlers pass c as the context of their calls: it must end with the request
+	// and carry its trace span.
+	router.ContextWithFallback = true
+	router.Use(
+		gin.CustomRecoveryWithWriter(log.StandardLogger().WriterLevel(log.ErrorLevel), func(c *gin.Context, _ any) {
+			apierror.Abort(c, apierror.New(apiv1.CodeInternal, "internal error"))
+		}),
+		logging.Middleware,
+		tracing.Middleware,
+		m.Middleware,
+	)
+	router.NoRoute(func(c *gin.Context) {
+		apierror.Abort(c, apierror.New(apiv1.CodeNotFound, "no route for %s %s", c.Request.Method, c.Request.URL.Path))
+	})
+	// Scraped inside the cluster; the ingress only routes /api to the server.
+	router.GET("/metrics", gin.WrapH(m.Handler()))
+
+	store := cookie.NewStore([]byte(cfg.Cookie.Secret.Value()))
 
 	// Default: local development
+	cookieDomain := cfg.Cookie.Domain
 	secure := false
 	sameSite := http.SameSiteLaxMode
-	if cookieDomain == "" || cookieDomain == "localhost" {
+	if cookieDomain == "localhost" {
 		cookieDomain = ""
-		secure = false
-		sameSite = http.SameSiteLaxMode
-	} else {
+	} else if cookieDomain != "" && cfg.Cookie.Secure {
 		// In cluster/production
-		secure = cookieSecure == "true"
-		if secure {
-			sameSite = http.SameSiteNoneMode
-		} else {
-			sameSite = http.SameSiteLaxMode
-		}
+		secure = true
+		sameSite = http.SameSiteNoneMode
 	}
 
 	store.Options(sessions.Options{
 		Domain:   cookieDomain,
 		Path:     "/",
-		MaxAge:   86400 * 7, // 7 days
+		MaxAge:   int(cfg.Session.AbsoluteTimeout.Std().Seconds()), // the server-side session decides validity
 		Secure:   secure,
 		HttpOnly: true,
 		SameSite: sameSite,
@@ -85,25 +163,91 @@ func New(auth *authenticator.Authenticator) *gin.Engine {
 
 	api := router.Group("/api")
 
-	api.GET("/", home.Handler)
+	api.GET("/", home.Handler(auth))
 	api.GET("/login", login.Handler(auth))
-	api.GET("/callback", callback.Handler(auth))
-	api.GET("/user", middleware.IsAuthenticated, user.Handler)
-	api.GET("/logout", logout.Handler)
+	api.GET("/login/:provider", login.Handler(auth))
+	api.GET("/login/:provider/form", login.FormHandler(auth))
+	api.GET("/callback", callback.Handler(auth, h.Sessions, h.Audit))
+	api.GET("/callback/:provider", callback.Handler(auth, h.Sessions, h.Audit))
+	api.POST("/callback/:provider", callback.Handler(auth, h.Sessions, h.Audit))
+	api.GET("/user", mw.IsAuthenticated, user.Handler)
+	api.GET("/logout", logout.Handler(auth, h.Sessions, h.Audit))
 
-	api.GET("/health", func(c *gin.Context) {
-		c.String(200, "OK")
-	})
+	api.GET("/health", probes.Live)
+	api.GET("/livez", probes.Live)
+	api.GET("/readyz", probes.Ready)
+
+	api.GET("/openapi.json", openAPIHandler())
+
+	// Personal access tokens are limited to the routes their scope allows.
+	read := middleware.RequireScope(pat.ScopeRead)
+	deploy := middleware.RequireScope(pat.ScopeDeploy)
+	admin := middleware.RequireScope(pat.ScopeAdmin)
+
+	protectedAPI := api.Group("", mw.IsAuthenticated)
+
+	protectedAPI.GET("/app", read, app.Handler)
+
+	protectedAPI.POST("/functions", audited("function.deploy", "function"), deploy, h.PostFunctionHandler)
+
+	protectedAPI.GET("/functions/:name", read, h.GetFunctionHandler)
+
+	protectedAPI.GET("/functions", read, h.ListFunctionsHandler)
 
-	protectedAPI := api.Group("", middleware.IsAuthenticated)
+	protectedAPI.GET("/functions/:name/status", read, h.GetFunctionStatusHandler)
 
-	protectedAPI.GET("/app", app.Handler)
+	protectedAPI.GET("/functions/:name/logs", read, h.GetFunctionLogsHandler)
 
-	protectedAPI.POST("/functions", handler.PostFunctionHandler)
+	protectedAPI.DELETE("/functions/:name", audited("function.delete", "function"), admin, h.DeleteFunctionHandler)
 
-	protectedAPI.GET("/functions/:name", handler.GetFunctionHandler)
+	protectedAPI.POST("/apikeys", audited("apikey.create", "apikey"), admin, h.CreateAPIKeyHandler)
 
-	protectedAPI.GET("/functions", handler.ListFunctionsHandler)
+	protectedAPI.GET("/apikeys", read, h.ListAPIKeysHandler)
+
+	protectedAPI.DELETE("/apikeys/:id", audited("apikey.revoke", "apikey"), admin, h.RevokeAPIKeyHandler)
+
+	protectedAPI.POST("/orgs", audited("org.create", "org"), admin, h.CreateOrgHandler)
+
+	protectedAPI.GET("/orgs", read, h.ListOrgsHandler)
+
+	protectedAPI.GET("/orgs/:org", read, h.GetOrgHandler)
+
+	protectedAPI.PUT("/orgs/:org/members", audited("org.member.set", "org"), admin, h.SetOrgMemberHandler)
+
+	protectedAPI.DELETE("/orgs/:org/members/:subject", audited("org.member.remove", "org"), admin, h.RemoveOrgMemberHandler)
+
+	protectedAPI.POST("/tokens", audited("token.create", "token"), admin, h.CreateTokenHandler)
+
+	protectedAPI.GET("/tokens", admin, h.ListTokensHandler)
+
+	protectedAPI.DELETE("/tokens/:id", audited("token.revoke", "token"), admin, h.RevokeTokenHandler)
+
+	protectedAPI.GET("/sessions", read, h.ListSessionsHandler)
+
+	protectedAPI.DELETE("/sessions/:id", audited("session.revoke", "session"), admin, h.RevokeSessionHandler)
+
+	protectedAPI.GET("/audit", read, h.ListAuditEventsHandler)
+
+	protectedAPI.GET("/audit/export", read, h.ExportAuditEventsHandler)
+
+	// The invocation gateway also accepts function API keys instead of a session.
+	api.Any("/functions/:name/invoke/*path", mw.IsAuthenticatedOrAPIKey, read, h.InvokeFunctionHandler)
+
+	api.POST("/functions/:name/invoke-async", mw.IsAuthenticatedOrAPIKey, read, h.InvokeFunctionAsyncHandler)
+
+	api.GET("/invocations/:id", mw.IsAuthenticatedOrAPIKey, read, h.GetInvocationHandler)
 
 	return router
 }
+
+// openAPIHandler serves the OpenAPI document of the API.
+func openAPIHandler() gin.HandlerFunc {
+	doc, err := apiv1.OpenAPI()
+	if err != nil {
+		log.WithError(err).Error("failed to load the OpenAPI document")
+		os.Exit(1)
+	}
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", doc)
+	}
+}
@@ -0,0 +1,64 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	handler "faas-api/internal"
+	"faas-api/internal/config"
+	"faas-api/internal/health"
+	"faas-api/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// pathParam matches the :name and *path parameters of gin routes.
+var pathParam = regexp.MustCompile(`[:*](\w+)`)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	// Templates and static files are found relative to the repository root.
+	t.Chdir("../..")
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	cfg.Cookie.Secret = config.NewSecret("test-secret")
+	router := newRouter(cfg, nil, &handler.Platform{Metrics: metrics.New(metrics.Options{})}, health.New(t.Context()))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc struct {
+		OpenAPI string                               `json:"openapi"`
+		Paths   map[string]map[string]map[string]any `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	require.Equal(t, "3.1.0", doc.OpenAPI)
+
+	var documented []string
+	operationIDs := map[string]bool{}
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+			id, _ := op["operationId"].(string)
+			require.NotEmpty(t, id, "%s %s has no operationId", method, path)
+			require.False(t, operationIDs[id], "operationId %s is not unique", id)
+			operationIDs[id] = true
+		}
+	}
+
+	var registered []string
+	for _, route := range router.Routes() {
+		// Static assets are not part of the API, and OpenAPI cannot describe CONNECT,
+		// which the invocation gateway accepts along with every other method.
+		if strings.HasPrefix(route.Path, "/public/") || route.Method == http.MethodConnect {
+			continue
+		}
+		registered = append(registered, route.Method+" "+pathParam.ReplaceAllString(route.Path, "{$1}"))
+	}
+
+	require.ElementsMatch(t, registered, documented)
+}
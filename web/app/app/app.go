@@ -3,13 +3,14 @@ package app
 import (
 	"net/http"
 
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+
+	"faas-api/platform/middleware"
 )
 
 func Handler(ctx *gin.Context) {
-	session := sessions.Default(ctx)
-	profile := session.Get("profile")
-
-	ctx.HTML(http.StatusOK, "app.html", profile)
+	ctx.HTML(http.StatusOK, "app.html", gin.H{
+		"profile":    ctx.Value(middleware.ProfileKey),
+		"csrf_token": ctx.GetString(middleware.CSRFTokenKey),
+	})
 }
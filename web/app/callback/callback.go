@@ -1,50 +1,89 @@
 package callback
 
 import (
-	"log"
+	"errors"
 	"net/http"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 
+	"faas-api/internal/audit"
+	"faas-api/internal/logging"
+	"faas-api/internal/session"
 	"faas-api/platform/authenticator"
+	"faas-api/platform/middleware"
 )
 
-// Handler for our callback.
-func Handler(auth *authenticator.Authenticator) gin.HandlerFunc {
+// Handler for our callback. The provider is taken from the :provider path parameter
+// and defaults to the first configured one. Logins are kept in sessions and
+// recorded in auditLog.
+func Handler(auth *authenticator.Authenticator, sessionManager *session.Manager, auditLog *audit.Log) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		session := sessions.Default(ctx)
-		log.Printf(`
-		state from query: %s
-		state from session: %s
-	`, ctx.Query("state"), session.Get("state"))
-		if ctx.Query("state") != session.Get("state") {
+		provider, ok := auth.Provider(ctx.Param("provider"))
+		if !ok {
+			ctx.String(http.StatusNotFound, "Unknown identity provider.")
+			return
+		}
+
+		cookie := sessions.Default(ctx)
+		if ctx.Request.FormValue("state") != cookie.Get("state") || cookie.Get("login_provider") != provider.Name() {
 			ctx.String(http.StatusBadRequest, "Invalid state parameter.")
+			return
 		}
 
-		// Exchange an authorization code for a token.
-		token, err := auth.Exchange(ctx.Request.Context(), ctx.Query("code"))
+		profile, err := provider.Callback(ctx.Request.Context(), ctx.Request)
 		if err != nil {
-			ctx.String(http.StatusUnauthorized, "Failed to convert an authorization code into a token.")
+			if errors.Is(err, authenticator.ErrLoginFailed) {
+				auditLog.Record(ctx, audit.Event{
+					Action:   "session.login",
+					Result:   audit.ResultDenied,
+					Status:   http.StatusUnauthorized,
+					Actor:    audit.Actor{Subject: "anonymous", Provider: provider.Name()},
+					Resource: audit.Resource{Kind: "session"},
+					Error:    err.Error(),
+				})
+				ctx.String(http.StatusUnauthorized, err.Error())
+				return
+			}
+			logging.From(ctx).WithError(err).WithField("provider", provider.Name()).Error("failed to complete login")
+			ctx.String(http.StatusInternalServerError, "Failed to complete the login.")
+			return
 		}
 
-		idToken, err := auth.VerifyIDToken(ctx.Request.Context(), token)
+		// The profile and tokens stay on the server; the cookie only refers to them.
+		s := &session.Session{
+			Subject:   profile.Subject,
+			Provider:  provider.Name(),
+			Profile:   profile.Session(),
+			UserAgent: ctx.Request.UserAgent(),
+			IPAddress: ctx.ClientIP(),
+		}
+		if profile.Token != nil && profile.Token.RefreshToken != "" && !profile.Token.Expiry.IsZero() {
+			expiry := profile.Token.Expiry.UTC()
+			s.RefreshToken = profile.Token.RefreshToken
+			s.TokenExpiry = &expiry
+		}
+		token, err := sessionManager.Create(ctx.Request.Context(), s)
 		if err != nil {
-			ctx.String(http.StatusInternalServerError, "Failed to verify ID Token.")
+			logging.From(ctx).WithError(err).Error("failed to create session")
+			ctx.String(http.StatusInternalServerError, "Failed to complete the login.")
+			return
 		}
 
-		var profile map[string]interface{}
-		if err := idToken.Claims(&profile); err != nil {
-			ctx.String(http.StatusInternalServerError, err.Error())
-		}
+		auditLog.Record(ctx, audit.Event{
+			Action:   "session.login",
+			Actor:    audit.Actor{Subject: s.Subject, Username: profile.Name, Provider: provider.Name()},
+			Resource: audit.Resource{Kind: "session", Name: s.ID},
+		})
 
-		session.Set("access_token", token.AccessToken)
-		session.Set("profile", profile)
-		if err := session.Save(); err != nil {
+		cookie.Clear()
+		cookie.Set(middleware.SessionCookieKey, token)
+		if err := cookie.Save(); err != nil {
 			ctx.String(http.StatusInternalServerError, err.Error())
+			return
 		}
 
 		// Redirect to logged in page.
-		ctx.Redirect(http.StatusTemporaryRedirect, "/api/user")
+		ctx.Redirect(http.StatusSeeOther, "/api/user")
 	}
 }
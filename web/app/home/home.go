@@ -4,9 +4,13 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"faas-api/platform/authenticator"
 )
 
-// Handler for our home page.
-func Handler(ctx *gin.Context) {
-	ctx.HTML(http.StatusOK, "home.html", nil)
+// Handler for our home page, offering a login with every configured provider.
+func Handler(auth *authenticator.Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.HTML(http.StatusOK, "home.html", gin.H{"providers": auth.Providers()})
+	}
 }
@@ -3,34 +3,69 @@ package login
 import (
 	"crypto/rand"
 	"encoding/base64"
-	"log"
 	"net/http"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 
+	"faas-api/internal/logging"
 	"faas-api/platform/authenticator"
 )
 
-// Handler for our login.
+// Handler for our login. The provider is taken from the :provider path parameter
+// and defaults to the first configured one.
 func Handler(auth *authenticator.Authenticator) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		provider, ok := auth.Provider(ctx.Param("provider"))
+		if !ok {
+			ctx.String(http.StatusNotFound, "Unknown identity provider.")
+			return
+		}
+
 		state, err := generateRandomState()
 		if err != nil {
 			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		loginURL, err := provider.LoginURL(ctx.Request.Context(), state)
+		if err != nil {
+			logging.From(ctx).WithError(err).WithField("provider", provider.Name()).Error("failed to start login")
+			ctx.String(http.StatusBadGateway, "The identity provider is not available.")
+			return
 		}
 
 		// Save the state inside the session.
 		session := sessions.Default(ctx)
 		session.Set("state", state)
+		session.Set("login_provider", provider.Name())
 		if err := session.Save(); err != nil {
 			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		ctx.Redirect(http.StatusTemporaryRedirect, loginURL)
+	}
+}
+
+// FormHandler renders the login form of providers that check passwords themselves.
+func FormHandler(auth *authenticator.Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		provider, ok := auth.Provider(ctx.Param("provider"))
+		if !ok {
+			ctx.String(http.StatusNotFound, "Unknown identity provider.")
+			return
+		}
+		if _, ok := provider.(authenticator.PasswordProvider); !ok {
+			ctx.String(http.StatusNotFound, "This identity provider has no login form.")
+			return
 		}
 
-		//test saved state value in session
-		stateTest := session.Get("state")
-		log.Println("State previously stored in session:", stateTest)
-		ctx.Redirect(http.StatusTemporaryRedirect, auth.AuthCodeURL(state))
+		ctx.HTML(http.StatusOK, "login_form.html", gin.H{
+			"title":  provider.Title(),
+			"action": "/api/callback/" + provider.Name(),
+			"state":  ctx.Query("state"),
+		})
 	}
 }
 
@@ -3,34 +3,58 @@ package logout
 import (
 	"net/http"
 	"net/url"
-	"os"
 
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-)
 
-// Handler for our logout.
-func Handler(ctx *gin.Context) {
-	logoutUrl, err := url.Parse("https://" + os.Getenv("AUTH0_DOMAIN") + "/v2/logout")
-	if err != nil {
-		ctx.String(http.StatusInternalServerError, err.Error())
-		return
-	}
+	"faas-api/internal/audit"
+	"faas-api/internal/logging"
+	"faas-api/internal/session"
+	"faas-api/platform/authenticator"
+	"faas-api/platform/middleware"
+)
 
-	scheme := "http"
-	if ctx.Request.TLS != nil {
-		scheme = "https"
-	}
+// Handler for our logout. It ends the server-side session, clears the cookie and lets the provider the user
+// logged in with end its own session.
+func Handler(auth *authenticator.Authenticator, sessionManager *session.Manager, auditLog *audit.Log) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scheme := "http"
+		if ctx.Request.TLS != nil {
+			scheme = "https"
+		}
 
-	returnTo, err := url.Parse(scheme + "://" + ctx.Request.Host)
-	if err != nil {
-		ctx.String(http.StatusInternalServerError, err.Error())
-		return
-	}
+		returnTo, err := url.Parse(scheme + "://" + ctx.Request.Host)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
 
-	parameters := url.Values{}
-	parameters.Add("returnTo", returnTo.String())
-	parameters.Add("client_id", os.Getenv("AUTH0_CLIENT_ID"))
-	logoutUrl.RawQuery = parameters.Encode()
+		var name string
+		cookie := sessions.Default(ctx)
+		if token, _ := cookie.Get(middleware.SessionCookieKey).(string); token != "" {
+			if s, err := sessionManager.Authenticate(ctx.Request.Context(), token); err == nil {
+				name = s.Provider
+				if err := sessionManager.Revoke(ctx.Request.Context(), s.ID); err != nil {
+					logging.From(ctx).WithError(err).WithField("session", s.ID).Error("failed to delete session")
+				}
+				username, _ := s.Profile["name"].(string)
+				auditLog.Record(ctx, audit.Event{
+					Action:   "session.logout",
+					Actor:    audit.Actor{Subject: s.Subject, Username: username, Provider: s.Provider},
+					Resource: audit.Resource{Kind: "session", Name: s.ID},
+				})
+			}
+		}
+		cookie.Clear()
+		if err := cookie.Save(); err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
 
-	ctx.Redirect(http.StatusTemporaryRedirect, logoutUrl.String())
+		logoutURL := returnTo.String()
+		if provider, ok := auth.Provider(name); ok {
+			logoutURL = provider.LogoutURL(returnTo.String())
+		}
+		ctx.Redirect(http.StatusTemporaryRedirect, logoutURL)
+	}
 }
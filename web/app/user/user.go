@@ -3,14 +3,14 @@ package user
 import (
 	"net/http"
 
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+
+	"faas-api/platform/middleware"
 )
 
 // Handler for our logged-in user page.
 func Handler(ctx *gin.Context) {
-	session := sessions.Default(ctx)
-	profile := session.Get("profile")
+	profile := ctx.Value(middleware.ProfileKey)
 
 	ctx.HTML(http.StatusOK, "user.html", profile)
 }